@@ -1,7 +1,11 @@
 package main
 
 import (
+	models "API/internal/Models"
 	"API/internal/database"
+	"API/internal/jobs"
+	"API/internal/mail"
+	"API/internal/media"
 	"API/internal/server"
 	"API/internal/utils"
 	"context"
@@ -42,7 +46,62 @@ func gracefulShutdown(fiberServer *server.FiberServer, done chan bool) {
 
 func main() {
 
-	server := server.New()
+	// Redis backs the token deny-list, AuthRequired cannot work without it
+	if err := utils.InitRedis(); err != nil {
+		log.Fatal("Failed to connect to Redis:", err)
+	}
+
+	if err := utils.InitJWT(); err != nil {
+		log.Fatal("Failed to load JWT signing keys:", err)
+	}
+
+	if err := utils.InitSMS(); err != nil {
+		log.Fatal("Failed to set up SMS provider:", err)
+	}
+
+	if err := utils.InitWebAuthn(); err != nil {
+		log.Fatal("Failed to configure passkeys:", err)
+	}
+
+	if err := utils.InitOIDC(context.Background()); err != nil {
+		log.Fatal("Failed to configure social login providers:", err)
+	}
+
+	if err := utils.InitBreachedPasswords(); err != nil {
+		log.Fatal("Failed to load breached password list:", err)
+	}
+
+	if err := utils.InitUnsubscribe(); err != nil {
+		log.Fatal("Failed to set up digest unsubscribe links:", err)
+	}
+
+	store, err := media.New(context.Background(), media.ConfigFromEnv())
+	if err != nil {
+		log.Fatal("Failed to set up media storage:", err)
+	}
+
+	spool, err := media.NewSpool(media.SpoolDirFromEnv())
+	if err != nil {
+		log.Fatal("Failed to set up the upload spool:", err)
+	}
+
+	mailCfg := mail.ConfigFromEnv()
+	mailer, err := mail.New(mailCfg)
+	if err != nil {
+		log.Fatal("Failed to set up email delivery:", err)
+	}
+
+	emails, err := mail.NewEmails(mailer, mailCfg.BaseURL, mailCfg.APIBaseURL)
+	if err != nil {
+		log.Fatal("Failed to load email templates:", err)
+	}
+
+	proxy, err := server.ProxyConfigFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure the proxy in front of the server:", err)
+	}
+
+	server := server.New(store, spool, emails, proxy)
 
 	server.RegisterFiberRoutes()
 
@@ -54,6 +113,24 @@ func main() {
 		}
 	}()
 
+	// Background jobs stop once the server has shut down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	go jobs.Every(jobsCtx, "purge-trashed-posts", time.Hour, jobs.PurgeTrashedPosts(db, store))
+	go jobs.Every(jobsCtx, "expire-uploads", time.Hour, jobs.ExpireUploads(db, store, spool))
+	go jobs.Every(jobsCtx, "collect-media-garbage", time.Hour, jobs.CollectMediaGarbage(db, store, models.MediaGCGracePeriod))
+	go jobs.Every(jobsCtx, "deliver-outbox", 5*time.Second, jobs.DeliverOutbox(db, emails))
+	go jobs.Every(jobsCtx, "prune-outbox", time.Hour, jobs.PruneOutbox(db))
+	go jobs.Every(jobsCtx, "send-digests", 15*time.Minute, jobs.SendDigests(db, emails))
+
+	// Without ffmpeg uploaded videos wait in the queue for an instance that has it
+	if processor, err := media.NewFFmpegProcessor(); err != nil {
+		log.Printf("Video processing disabled on this instance: %v", err)
+	} else {
+		go jobs.Every(jobsCtx, "process-media", 5*time.Second, jobs.ProcessMediaJobs(db, store, processor))
+	}
+
 	// Create a done channel to signal when the shutdown is complete
 	done := make(chan bool, 1)
 
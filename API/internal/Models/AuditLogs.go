@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+)
+
+// Audit log actions
+const (
+	AuditUserBanned       = "user.banned"
+	AuditUserUnbanned     = "user.unbanned"
+	AuditUserVerified     = "user.verified"
+	AuditUserUnverified   = "user.unverified"
+	AuditUserRoleChanged  = "user.role_changed"
+	AuditUserForcedLogout = "user.forced_logout"
+
+	AuditImageBlocked        = "image.blocked"
+	AuditImageUnblocked      = "image.unblocked"
+	AuditMediaReviewResolved = "media.review_resolved"
+
+	AuditOutboxRetried = "outbox.retried"
+)
+
+// What an audit log entry is about when it is not a user
+const (
+	AuditTargetBlockedImage = "blocked_image"
+	AuditTargetMediaAsset   = "media_asset"
+	AuditTargetOutbox       = "outbox_message"
+)
+
+// AuditLog records one action taken by staff. Rows are append-only: a trigger
+// created in AutoMigrate rejects any UPDATE, DELETE or TRUNCATE, which is why
+// there is no gorm.Model (no soft delete) and no foreign key that could
+// cascade a delete when a user is removed.
+//
+// TargetUserID is the user the action is about. Actions on anything else,
+// like a blocklist entry, name it with TargetType and TargetID and only set
+// TargetUserID when it belongs to a user.
+type AuditLog struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement"`
+	ActorID      uint      `gorm:"not null;index"`
+	ActorRole    string    `gorm:"not null;size:20"`
+	Action       string    `gorm:"not null;size:64;index"`
+	TargetUserID *uint     `gorm:"index"`
+	TargetType   string    `gorm:"size:30;index:idx_audit_log_target"`
+	TargetID     *uint     `gorm:"index:idx_audit_log_target"`
+	Reason       string    `gorm:"size:500"`
+	Metadata     string    `gorm:"type:jsonb;not null;default:'{}'"` // Action specific details, e.g. the previous value
+	IP           string    `gorm:"size:45"`
+	CreatedAt    time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"math/bits"
+
+	"gorm.io/gorm"
+)
+
+// What happens to an upload matching a BlockedImage
+const (
+	BlockActionReject = "reject" // The upload is refused
+	BlockActionReview = "review" // The upload goes through but waits for a moderator
+)
+
+// BlockedImageDistance is how many of the 64 bits of two perceptual hashes
+// may differ for an upload to match a BlockedImage
+const BlockedImageDistance = 10
+
+// BlockedImage is a known abusive image on the moderators' blocklist. Only
+// its perceptual hash is kept, never the image itself.
+type BlockedImage struct {
+	gorm.Model
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	DHash     int64  `gorm:"not null"`
+	Action    string `gorm:"not null;size:10;default:reject"`
+	Reason    string `gorm:"size:500"`
+	AddedByID uint   `gorm:"not null;index"`
+}
+
+// Distance is how many bits the hash differs from the blocked one in.
+func (b *BlockedImage) Distance(hash int64) int {
+	return bits.OnesCount64(uint64(b.DHash ^ hash))
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Collection is a named, private folder of saved posts. The "All posts"
+// collection is virtual: it is every row in user_saved_posts for the user.
+type Collection struct {
+	gorm.Model
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	UserID    uint   `gorm:"not null;index"`
+	Name      string `gorm:"not null;size:100"`
+	PostCount int64  `gorm:"->;-:migration"` // Filled in by listing queries
+	User      User   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// SavedPost is the join model behind User.SavedPosts (user_saved_posts).
+// A saved post belongs to at most one collection; a nil CollectionID means
+// it only shows up in "All posts".
+type SavedPost struct {
+	UserID       uint  `gorm:"primaryKey"`
+	PostID       uint  `gorm:"primaryKey"`
+	CollectionID *uint `gorm:"index"`
+	CreatedAt    time.Time
+}
+
+func (SavedPost) TableName() string {
+	return "user_saved_posts"
+}
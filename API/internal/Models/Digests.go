@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+const (
+	// DigestWeekday and DigestHour are when the weekly digest goes out, in
+	// the time zone of the user
+	DigestWeekday = time.Monday
+	DigestHour    = 9
+	// DigestPeriod is what a digest covers. Users who opened the app within
+	// it do not get one.
+	DigestPeriod = 7 * 24 * time.Hour
+	// DigestTopPosts is how many posts of followed accounts a digest shows
+	DigestTopPosts = 3
+)
+
+// DigestActivity is what a weekly digest sums up, it is not stored.
+type DigestActivity struct {
+	NewFollowers        int64
+	TopPosts            []Post // With User and Media
+	UnreadNotifications int64
+}
+
+// Empty reports whether there is nothing worth an email.
+func (a DigestActivity) Empty() bool {
+	return a.NewFollowers == 0 && len(a.TopPosts) == 0 && a.UnreadNotifications == 0
+}
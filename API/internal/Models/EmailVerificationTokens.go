@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EmailVerificationTTL is how long an email verification link stays valid
+const EmailVerificationTTL = 24 * time.Hour
+
+// EmailVerificationToken proves the user owns Email. For a new account Email
+// is the address they signed up with; for an email change it is the pending
+// address, which only replaces User.Email once verified. Only the SHA-256 hash
+// of the token is stored.
+type EmailVerificationToken struct {
+	gorm.Model
+	ID        uint       `gorm:"primaryKey;autoIncrement"`
+	UserID    uint       `gorm:"not null;index"`
+	Email     string     `gorm:"not null;size:255"`
+	TokenHash string     `gorm:"not null;size:64;uniqueIndex"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // Set once the email has been verified with it
+	User      User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// What a MediaAssetRef points at, RefID is the ID of the user, post, story
+// or highlight
+const (
+	MediaRefAvatar    = "avatar"
+	MediaRefPost      = "post"
+	MediaRefStory     = "story"
+	MediaRefHighlight = "highlight"
+)
+
+// MediaGCGracePeriod is how long an asset can go without references before
+// the garbage collector deletes it, covering the time between storing a
+// file and saving what uses it.
+const MediaGCGracePeriod = 48 * time.Hour
+
+// MediaAsset is one object in the media store. It is recorded as soon as
+// the object is stored and gains a MediaAssetRef once the avatar, post,
+// story or highlight using it is saved. Files of unfinished uploads and
+// media jobs are not collected while those are still around.
+//
+// Processed images and videos with the same SHA256 share one asset, which
+// is why only the garbage collector deletes the file of a recorded asset.
+type MediaAsset struct {
+	ID          uint            `gorm:"primaryKey;autoIncrement"`
+	Key         string          `gorm:"not null;size:512;uniqueIndex"`
+	URL         string          `gorm:"not null;size:512;index"`
+	UserID      *uint           `gorm:"index"` // Owner, nil for an avatar stored before its account existed
+	User        *User           `gorm:"foreignKey:UserID;constraint:OnDelete:SET NULL" json:"-"`
+	ContentType string          `gorm:"size:100"`
+	Size        int64           `gorm:"not null;default:0"`
+	SHA256      string          `gorm:"size:64;index"`
+	DHash       *int64          // Perceptual hash of images and poster frames, see media.DHash
+	ReviewMatch *uint           `gorm:"index"` // BlockedImage it resembles, until a moderator has looked at it
+	Refs        []MediaAssetRef `gorm:"foreignKey:AssetID;constraint:OnDelete:CASCADE" json:"-"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time `gorm:"index"` // Also moved when the asset loses a reference
+}
+
+// MediaAssetRef records that an avatar, post, story or highlight uses an asset.
+type MediaAssetRef struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	RefType   string `gorm:"not null;size:20;uniqueIndex:idx_media_asset_ref"`
+	RefID     uint   `gorm:"not null;uniqueIndex:idx_media_asset_ref"`
+	AssetID   uint   `gorm:"not null;uniqueIndex:idx_media_asset_ref;index"`
+	UserID    uint   `gorm:"not null;index"` // Whose avatar, post, story or highlight it is
+	CreatedAt time.Time
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Processing states of a post or story, only videos are ever not ready
+const (
+	MediaProcessing = "processing"
+	MediaReady      = "ready"
+	MediaFailed     = "failed"
+)
+
+// States of a MediaJob
+const (
+	MediaJobQueued  = "queued"
+	MediaJobRunning = "running"
+	MediaJobDone    = "done"
+	MediaJobFailed  = "failed"
+)
+
+// What a MediaJob produces media for
+const (
+	MediaJobTargetPost  = "post"
+	MediaJobTargetStory = "story"
+)
+
+const (
+	// MaxMediaJobAttempts is how often a job is tried before it fails for good
+	MaxMediaJobAttempts = 3
+	// MediaJobTimeout is how long a job may run before it is assumed its
+	// worker died and it is picked up again
+	MediaJobTimeout = 30 * time.Minute
+)
+
+// MediaJob processes an uploaded video in the background. The original
+// upload sits in the media store under SourceKey until the job is done.
+type MediaJob struct {
+	gorm.Model
+	ID         uint      `gorm:"primaryKey;autoIncrement"`
+	UserID     uint      `gorm:"not null;index"`
+	User       User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	TargetType string    `gorm:"not null;size:20"` // post or story
+	TargetID   uint      `gorm:"not null"`
+	SourceKey  string    `gorm:"not null;size:512" json:"-"`
+	Status     string    `gorm:"not null;size:20;default:queued;index"`
+	Attempts   int       `gorm:"default:0"`
+	Error      string    `gorm:"type:text"`
+	RunAfter   time.Time `gorm:"not null"` // Retries back off
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+}
@@ -18,6 +18,8 @@ const (
 	NotifTypePostTag       NotificationType = "post_tag"
 	NotifTypePostLocation  NotificationType = "post_location"
 	NotifTypePostHashtag   NotificationType = "post_hashtag"
+	NotifTypeMediaReady    NotificationType = "media_ready"
+	NotifTypeMediaFailed   NotificationType = "media_failed"
 )
 
 type Notification struct {
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// States of an OutboxMessage
+const (
+	OutboxPending = "pending"
+	OutboxSending = "sending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead" // Gave up, waits for an admin to retry it
+)
+
+const (
+	// MaxOutboxAttempts is how often delivery is tried before the message
+	// is dead-lettered, the retries span about two hours
+	MaxOutboxAttempts = 8
+	// OutboxRetryDelay is the wait after the first failed attempt, it
+	// doubles with every further one
+	OutboxRetryDelay = time.Minute
+	// OutboxSendTimeout is how long a delivery may take before it is
+	// assumed its worker died and the message is picked up again
+	OutboxSendTimeout = 5 * time.Minute
+	// OutboxRetention is how long sent messages are kept for inspection
+	OutboxRetention = 30 * 24 * time.Hour
+)
+
+// OutboxMessage is an email waiting to be delivered. It is saved in the
+// same transaction as the change it is about, e.g. a password reset token,
+// so neither exists without the other, and a worker delivers it later.
+type OutboxMessage struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement"`
+	UserID        *uint     `gorm:"index"` // Nil for messages not about an account
+	User          *User     `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Template      string    `gorm:"not null;size:50;index"` // Which email, see mail.Email
+	Recipient     string    `gorm:"not null;size:255"`
+	Payload       string    `gorm:"type:jsonb" json:"-"` // The mail.Email, may hold a raw token and is cleared once sent
+	Status        string    `gorm:"not null;size:20;default:pending;index:idx_outbox_due"`
+	Attempts      int       `gorm:"default:0"`
+	NextAttemptAt time.Time `gorm:"not null;index:idx_outbox_due"`
+	LastError     string    `gorm:"type:text"`
+	StartedAt     *time.Time
+	SentAt        *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
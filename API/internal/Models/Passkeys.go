@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Passkey is a WebAuthn credential the user can sign in with instead of a
+// password. Credential holds the JSON encoded webauthn.Credential (public key,
+// sign counter, flags, attestation) and is rewritten after every login.
+type Passkey struct {
+	gorm.Model
+	ID           uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID       uint       `gorm:"not null;index" json:"-"`
+	Name         string     `gorm:"not null;size:64" json:"name"`
+	CredentialID []byte     `gorm:"not null;uniqueIndex" json:"-"`
+	Credential   []byte     `gorm:"not null" json:"-"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	User         User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PasswordResetTTL is how long a password reset link stays valid
+const PasswordResetTTL = 30 * time.Minute
+
+// PasswordResetToken is a single-use password reset link. Only the SHA-256
+// hash of the token is stored.
+type PasswordResetToken struct {
+	gorm.Model
+	ID        uint       `gorm:"primaryKey;autoIncrement"`
+	UserID    uint       `gorm:"not null;index"`
+	TokenHash string     `gorm:"not null;size:64;uniqueIndex"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // Set once the password has been reset with it
+	User      User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Media types of a PostMedia
+const (
+	MediaTypeImage = "image"
+	MediaTypeVideo = "video"
+)
+
+// PostMedia is one photo or video of a post, in the order it appears in a
+// carousel. Width, Height and BlurHash come from the server side processing,
+// never from the client. For a video URL is the transcoded rendition, the
+// other URLs and BlurHash are those of its poster frame, and all of them are
+// empty until its MediaJob is done.
+type PostMedia struct {
+	gorm.Model
+	ID           uint    `gorm:"primaryKey;autoIncrement"`
+	PostID       uint    `gorm:"not null;index"`
+	Position     int     `gorm:"not null"`
+	MediaType    string  `gorm:"not null;size:20"`
+	URL          string  `gorm:"not null;size:512"` // Full size, at most 1080px wide
+	MediumURL    string  `gorm:"size:512"`
+	ThumbnailURL string  `gorm:"size:512"` // Square crop for the profile grid
+	Width        int     `gorm:"not null"`
+	Height       int     `gorm:"not null"`
+	BlurHash     string  `gorm:"size:64"`  // Placeholder shown while the image loads
+	PosterURL    string  `gorm:"size:512"` // Videos only, full size poster frame
+	Duration     float64 // Videos only, in seconds
+}
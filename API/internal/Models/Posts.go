@@ -1,26 +1,46 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
+const (
+	// MaxPinnedPosts is how many posts can be pinned to a profile at once
+	MaxPinnedPosts = 3
+	// TrashRetention is how long a deleted post stays in "recently deleted"
+	TrashRetention = 30 * 24 * time.Hour
+	// MaxPostMedia is how many photos a carousel can hold
+	MaxPostMedia = 10
+	// MinAspectRatio and MaxAspectRatio are the portrait (4:5) and landscape
+	// (1.91:1) limits a post is shown in, anything beyond is cropped
+	MinAspectRatio = 0.8
+	MaxAspectRatio = 1.91
+	// MaxPostVideoDuration is how long a video post can be
+	MaxPostVideoDuration = 15 * time.Minute
+)
+
 type Post struct {
 	gorm.Model
-	ID            uint      `gorm:"primaryKey;autoIncrement"`
-	UserID        uint      `gorm:"not null"`
-	User          User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
-	Caption       string    `gorm:"type:text;size:2200"` // Instagram caption limit
-	MediaURLs     []string  `gorm:"type:text[]"`         // Multiple media support
-	Location      string    `gorm:"size:255"`
-	PostType      string    `gorm:"not null;size:20"` // photo, video, carousel
-	Filter        string    `gorm:"size:50"`
-	AspectRatio   float64   `gorm:"default:1.0"`
-	IsArchived    bool      `gorm:"default:false"`
-	IsPinned      bool      `gorm:"default:false"`
-	LikesCount    int       `gorm:"default:0"`
-	CommentsCount int       `gorm:"default:0"`
-	Likes         []Like    `gorm:"foreignKey:PostID"`
-	Comments      []Comment `gorm:"foreignKey:PostID"`
-	Hashtags      []Hashtag `gorm:"many2many:post_hashtags"`
-	TaggedUsers   []User    `gorm:"many2many:post_tagged_users"`
+	ID            uint        `gorm:"primaryKey;autoIncrement"`
+	UserID        uint        `gorm:"not null"`
+	User          User        `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Caption       string      `gorm:"type:text;size:2200"` // Instagram caption limit
+	MediaURLs     []string    `gorm:"type:text[]"`         // Full size URL of every item in Media
+	Media         []PostMedia `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE"`
+	Location      string      `gorm:"size:255"`
+	PostType      string      `gorm:"not null;size:20"`               // photo, video, carousel
+	Status        string      `gorm:"not null;size:20;default:ready"` // processing until a video's MediaJob is done
+	Filter        string      `gorm:"size:50"`
+	AspectRatio   float64     `gorm:"default:1.0"` // Derived from the first media item
+	IsArchived    bool        `gorm:"default:false"`
+	IsPinned      bool        `gorm:"default:false"`
+	LikesCount    int         `gorm:"default:0"`
+	CommentsCount int         `gorm:"default:0"`
+	SavesCount    int         `gorm:"default:0"` // Only surfaced to the owner through insights
+	Likes         []Like      `gorm:"foreignKey:PostID"`
+	Comments      []Comment   `gorm:"foreignKey:PostID"`
+	Hashtags      []Hashtag   `gorm:"many2many:post_hashtags"`
+	TaggedUsers   []User      `gorm:"many2many:post_tagged_users"`
 }
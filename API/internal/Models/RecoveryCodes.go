@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecoveryCodeCount is how many recovery codes are issued at a time
+const RecoveryCodeCount = 10
+
+// RecoveryCode is a one-time backup code for signing in when the
+// authenticator app is not available. Only the SHA-256 hash is stored.
+type RecoveryCode struct {
+	gorm.Model
+	ID       uint       `gorm:"primaryKey;autoIncrement"`
+	UserID   uint       `gorm:"not null;index"`
+	CodeHash string     `gorm:"not null;size:64;index"`
+	UsedAt   *time.Time // Set once the code has been used to sign in
+	User     User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken is one link in a rotation chain. Every login starts a new
+// family; each refresh marks the presented token used and issues the next
+// one in the same family. Only the SHA-256 hash of the token is stored.
+type RefreshToken struct {
+	gorm.Model
+	ID        uint       `gorm:"primaryKey;autoIncrement"`
+	UserID    uint       `gorm:"not null;index"`
+	FamilyID  string     `gorm:"not null;size:64;index"`
+	TokenHash string     `gorm:"not null;size:64;uniqueIndex"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // Set once the token has been exchanged for a new one
+	RevokedAt *time.Time // Set on logout or when the family is revoked
+	User      User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
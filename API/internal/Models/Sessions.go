@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session describes one login on one device. FamilyID ties it to its refresh
+// token family and is the sid claim of the access tokens issued for it.
+type Session struct {
+	gorm.Model
+	ID         uint       `gorm:"primaryKey;autoIncrement"`
+	UserID     uint       `gorm:"not null;index"`
+	FamilyID   string     `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	Device     string     `gorm:"size:100"`               // e.g. "Chrome on Windows"
+	DeviceHash string     `gorm:"size:64;index" json:"-"` // Hash of the X-Device-ID the client keeps
+	UserAgent  string     `gorm:"size:512"`
+	IP         string     `gorm:"size:45"`
+	Location   string     `gorm:"size:255"` // Approximate, derived from the IP
+	LastUsedAt time.Time  `gorm:"not null"`
+	RevokedAt  *time.Time `json:"-"`
+	User       User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
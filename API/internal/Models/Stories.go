@@ -1,16 +1,26 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaxStoryVideoDuration is how long a video story can be
+const MaxStoryVideoDuration = 60 * time.Second
 
 type Story struct {
 	gorm.Model
-	ID        uint   `gorm:"primaryKey;autoIncrement"`
-	UserID    uint   `gorm:"not null"`
-	User      User   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
-	MediaURL  string `gorm:"not null"`
-	StoryType string `gorm:"not null"`   // photo or video
-	Duration  int    `gorm:"default:24"` // hours
-	ViewCount int    `gorm:"default:0"`
-	IsExpired bool   `gorm:"default:false"`
-	ViewedBy  []User `gorm:"many2many:story_views"`
+	ID            uint    `gorm:"primaryKey;autoIncrement"`
+	UserID        uint    `gorm:"not null"`
+	User          User    `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	MediaURL      string  `gorm:"not null"`
+	StoryType     string  `gorm:"not null"`                       // photo or video
+	Status        string  `gorm:"not null;size:20;default:ready"` // processing until a video's MediaJob is done
+	PosterURL     string  `gorm:"size:512"`                       // Videos only
+	VideoDuration float64 // Videos only, in seconds
+	Duration      int     `gorm:"default:24"` // hours
+	ViewCount     int     `gorm:"default:0"`
+	IsExpired     bool    `gorm:"default:false"`
+	ViewedBy      []User  `gorm:"many2many:story_views"`
 }
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+const (
+	// MaxUploadSize is the largest file a resumable upload can hold
+	MaxUploadSize = 1 << 30 // 1GB
+	// MaxUploadChunkSize is the largest body a single PATCH may carry
+	MaxUploadChunkSize = 16 << 20 // 16MB
+	// UploadSessionTTL is how long an upload can sit without a new chunk, and
+	// how long a finished one waits to be used in a post or story, before it
+	// is removed
+	UploadSessionTTL = 24 * time.Hour
+	// DirectUploadURLTTL is how long a signed direct upload URL can be used
+	DirectUploadURLTTL = 15 * time.Minute
+)
+
+// UploadSession is a resumable (tus) upload. Chunks are spooled on disk
+// until Offset reaches Size, then the file goes to the media store under
+// MediaKey. A Direct upload is sent by the client straight to the store
+// under MediaKey instead and completed once the API has checked it.
+// Creating a post or story from it deletes the session, which is why there
+// is no soft delete.
+type UploadSession struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement"`
+	UploadID    string `gorm:"not null;size:36;uniqueIndex"` // Public ID in the upload URL
+	UserID      uint   `gorm:"not null;index"`
+	User        User   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Filename    string `gorm:"not null;size:255"`
+	ContentType string `gorm:"size:100"`
+	Size        int64  `gorm:"not null"`
+	Offset      int64  `gorm:"not null;default:0"`
+	MediaKey    string `gorm:"size:512"`
+	Direct      bool   `gorm:"default:false"`
+	CompletedAt *time.Time
+	ExpiresAt   time.Time `gorm:"not null;index"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// IsComplete reports whether the whole file is in the media store.
+func (u *UploadSession) IsComplete() bool {
+	return u.CompletedAt != nil
+}
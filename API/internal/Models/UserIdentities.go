@@ -0,0 +1,17 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// UserIdentity links a user to an account at an OpenID Connect provider.
+// Subject is the provider's stable user ID; the email can change over time.
+type UserIdentity struct {
+	gorm.Model
+	ID       uint   `gorm:"primaryKey;autoIncrement"`
+	UserID   uint   `gorm:"not null;index"`
+	Provider string `gorm:"not null;size:32;uniqueIndex:idx_identity_provider_subject"`
+	Subject  string `gorm:"not null;size:255;uniqueIndex:idx_identity_provider_subject"`
+	Email    string `gorm:"size:255"`
+	User     User   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
@@ -6,31 +6,58 @@ import (
 	"gorm.io/gorm"
 )
 
+// Roles a user can hold. Moderators handle other users' accounts, admins can
+// additionally verify accounts, change roles and read the audit log.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
 type User struct {
 	gorm.Model
-	ID             uint        `gorm:"primaryKey;autoIncrement"`
-	Username       string      `gorm:"unique;not null;size:30"` // Instagram-style username
-	Name           string      `gorm:"not null;size:255"`
-	Avatar         string      `gorm:"size:255;default:'https://res.cloudinary.com/difubp42o/image/upload/v1738815446/tiktok-clone/zuklvs37gmezb5d0zzr6.jpg'"`
-	Bio            string      `gorm:"size:150"` // Instagram bio limit
-	Website        string      `gorm:"size:255"`
-	Email          string      `gorm:"unique;not null"`
-	Phone          string      `gorm:"unique;not null"`
-	FollowerCount  int         `gorm:"default:0"`
-	FollowingCount int         `gorm:"default:0"`
-	PostCount      int         `gorm:"default:0"`
-	Privacy        bool        `gorm:"default:false"`
-	IsVerified     bool        `gorm:"default:false"` // Blue check mark
-	EmailVerified  bool        `gorm:"default:false"`
-	Password       string      `gorm:"not null" json:"-"`
-	Token          string      `gorm:"not null;size:255" json:"-"`
-	Language       string      `gorm:"not null;size:20"`
-	Posts          []Post      `gorm:"foreignKey:UserID"`
-	Likes          []Like      `gorm:"foreignKey:UserID"`
-	Comments       []Comment   `gorm:"foreignKey:UserID"`
-	Stories        []Story     `gorm:"foreignKey:UserID"`
-	SavedPosts     []Post      `gorm:"many2many:user_saved_posts"`
-	Highlights     []Highlight `gorm:"foreignKey:UserID"`
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	ID               uint        `gorm:"primaryKey;autoIncrement"`
+	Username         string      `gorm:"unique;not null;size:30"` // Instagram-style username
+	Name             string      `gorm:"not null;size:255"`
+	Avatar           string      `gorm:"size:255;default:'https://res.cloudinary.com/difubp42o/image/upload/v1738815446/tiktok-clone/zuklvs37gmezb5d0zzr6.jpg'"`
+	Bio              string      `gorm:"size:150"` // Instagram bio limit
+	Website          string      `gorm:"size:255"`
+	Email            string      `gorm:"unique;not null"`
+	Phone            *string     `gorm:"unique"` // E.164, nil for accounts created through social login
+	FollowerCount    int         `gorm:"default:0"`
+	FollowingCount   int         `gorm:"default:0"`
+	PostCount        int         `gorm:"default:0"`
+	Privacy          bool        `gorm:"default:false"`
+	IsVerified       bool        `gorm:"default:false"` // Blue check mark
+	EmailVerified    bool        `gorm:"default:false"`
+	PhoneVerified    bool        `gorm:"default:false"`
+	PendingEmail     string      `gorm:"size:255"` // New address waiting for verification
+	TwoFactorEnabled bool        `gorm:"default:false"`
+	TOTPSecret       string      `gorm:"size:64" json:"-"` // Base32 secret of the enrolled authenticator app
+	Role             string      `gorm:"not null;size:20;default:'user'"`
+	BannedAt         *time.Time  // Set while the account is banned or suspended
+	BanExpiresAt     *time.Time  // End of a suspension, nil for a permanent ban
+	BanReason        string      `gorm:"size:500"`
+	Password         string      `gorm:"not null" json:"-"`
+	Token            string      `gorm:"not null;size:255" json:"-"`
+	Language         string      `gorm:"not null;size:20"`
+	Timezone         string      `gorm:"not null;size:64;default:'UTC'"` // IANA name, when the weekly digest goes out
+	DigestOptIn      bool        `gorm:"default:false"`                  // Wants the weekly digest email
+	LastDigestAt     *time.Time  `json:"-"`
+	Posts            []Post      `gorm:"foreignKey:UserID"`
+	Likes            []Like      `gorm:"foreignKey:UserID"`
+	Comments         []Comment   `gorm:"foreignKey:UserID"`
+	Stories          []Story     `gorm:"foreignKey:UserID"`
+	SavedPosts       []Post      `gorm:"many2many:user_saved_posts"`
+	Highlights       []Highlight `gorm:"foreignKey:UserID"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// IsBanned reports whether the account is banned, or suspended until after now.
+func (u *User) IsBanned(now time.Time) bool {
+	if u.BannedAt == nil {
+		return false
+	}
+	return u.BanExpiresAt == nil || u.BanExpiresAt.After(now)
 }
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// Supported JWT signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// SigningKey is one JWT key, identified in token headers by its kid.
+// Private is nil for verify-only keys (e.g. a retired asymmetric key that
+// only has its public half left). For HS256 both halves are the secret.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   interface{} // []byte, *rsa.PrivateKey or ed25519.PrivateKey
+	Public    interface{} // []byte, *rsa.PublicKey or ed25519.PublicKey
+}
+
+// JWTKeys holds every key that can verify tokens, and the one signing new ones.
+type JWTKeys struct {
+	Active *SigningKey
+	Keys   map[string]*SigningKey
+}
+
+// LoadJWTKeys reads the JWT keys from the environment.
+//
+//	JWT_KEYS       comma separated kid:alg:path entries, e.g.
+//	               "2026-10:EdDSA:/run/secrets/jwt-2026-10.pem,2026-04:RS256:/run/secrets/jwt-2026-04.pem".
+//	               RS256 and EdDSA paths hold a PEM private key (or a public key
+//	               for verify-only keys), HS256 paths hold the raw secret.
+//	JWT_ACTIVE_KID the kid used to sign new tokens, defaults to the first entry.
+//	JWT_SECRET     shortcut for a single HS256 key (kid "default") when
+//	               JWT_KEYS is not set.
+//
+// Keeping the previous key in JWT_KEYS while JWT_ACTIVE_KID points at the new
+// one lets tokens signed before a rotation stay valid until they expire.
+func LoadJWTKeys() (*JWTKeys, error) {
+	godotenv.Load()
+
+	keys := &JWTKeys{Keys: make(map[string]*SigningKey)}
+	var order []string
+
+	if entries := strings.TrimSpace(os.Getenv("JWT_KEYS")); entries != "" {
+		for _, entry := range strings.Split(entries, ",") {
+			parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+			if len(parts) != 3 {
+				return nil, fmt.Errorf("invalid JWT_KEYS entry %q, expected kid:alg:path", entry)
+			}
+
+			data, err := os.ReadFile(parts[2])
+			if err != nil {
+				return nil, fmt.Errorf("failed to read JWT key %s: %v", parts[0], err)
+			}
+
+			key, err := ParseSigningKey(parts[0], parts[1], data)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := keys.Keys[key.ID]; exists {
+				return nil, fmt.Errorf("duplicate JWT kid %s", key.ID)
+			}
+
+			keys.Keys[key.ID] = key
+			order = append(order, key.ID)
+		}
+	} else if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		key, err := ParseSigningKey("default", AlgHS256, []byte(secret))
+		if err != nil {
+			return nil, err
+		}
+		keys.Keys[key.ID] = key
+		order = append(order, key.ID)
+	} else {
+		return nil, fmt.Errorf("no JWT signing keys configured, set JWT_KEYS or JWT_SECRET")
+	}
+
+	activeID := os.Getenv("JWT_ACTIVE_KID")
+	if activeID == "" {
+		activeID = order[0]
+	}
+
+	active, ok := keys.Keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("JWT_ACTIVE_KID %s is not in JWT_KEYS", activeID)
+	}
+	if active.Private == nil {
+		return nil, fmt.Errorf("JWT key %s is verify-only and cannot be the active key", activeID)
+	}
+	keys.Active = active
+
+	return keys, nil
+}
+
+// ParseSigningKey builds a SigningKey from its raw material: the secret for
+// HS256, a PEM encoded private or public key for RS256 and EdDSA.
+func ParseSigningKey(kid, alg string, data []byte) (*SigningKey, error) {
+	if kid == "" {
+		return nil, fmt.Errorf("JWT key id cannot be empty")
+	}
+
+	key := &SigningKey{ID: kid, Algorithm: alg}
+
+	if alg == AlgHS256 {
+		secret := []byte(strings.TrimSpace(string(data)))
+		if len(secret) < 32 {
+			return nil, fmt.Errorf("HS256 key %s must be at least 32 bytes", kid)
+		}
+		key.Private = secret
+		key.Public = secret
+		return key, nil
+	}
+
+	if alg != AlgRS256 && alg != AlgEdDSA {
+		return nil, fmt.Errorf("unsupported JWT algorithm %s for key %s", alg, kid)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("JWT key %s is not PEM encoded", kid)
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %s: %v", kid, err)
+		}
+		key.Public = public
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key %s: %v", kid, err)
+		}
+		key.Private = private
+		key.Public = &private.PublicKey
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key %s: %v", kid, err)
+		}
+		switch private := private.(type) {
+		case *rsa.PrivateKey:
+			key.Private = private
+			key.Public = &private.PublicKey
+		case ed25519.PrivateKey:
+			key.Private = private
+			key.Public = private.Public()
+		default:
+			return nil, fmt.Errorf("unsupported private key type for %s", kid)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %s for key %s", block.Type, kid)
+	}
+
+	// The key type has to match the algorithm it was declared with
+	switch public := key.Public.(type) {
+	case *rsa.PublicKey:
+		if alg != AlgRS256 {
+			return nil, fmt.Errorf("JWT key %s is an RSA key but declared as %s", kid, alg)
+		}
+		if public.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA key %s must be at least 2048 bits", kid)
+		}
+	case ed25519.PublicKey:
+		if alg != AlgEdDSA {
+			return nil, fmt.Errorf("JWT key %s is an Ed25519 key but declared as %s", kid, alg)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported public key type for %s", kid)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,694 @@
+package controllers
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/media"
+	"API/internal/middleware"
+	"API/internal/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type AdminController struct {
+	db       database.Service    // The database service to interact with the database.
+	validate *validator.Validate // Validator instance for validating user inputs.
+}
+
+func NewAdminController(db database.Service) *AdminController {
+	return &AdminController{
+		db:       db,
+		validate: utils.NewValidator(),
+	}
+}
+
+// adminUser is the full picture of an account staff get to see.
+func adminUser(user *models.User) fiber.Map {
+	return fiber.Map{
+		"user":           user,
+		"role":           user.Role,
+		"email_verified": user.EmailVerified,
+		"phone_verified": user.PhoneVerified,
+		"two_factor":     user.TwoFactorEnabled,
+		"banned":         user.IsBanned(time.Now()),
+		"ban_reason":     user.BanReason,
+		"banned_at":      user.BannedAt,
+		"ban_expires_at": user.BanExpiresAt,
+	}
+}
+
+// findTarget loads the user named by :ID and checks the caller may act on
+// them: nobody acts on themselves and moderators cannot act on other staff.
+func (ac *AdminController) findTarget(c *fiber.Ctx) (*models.User, error) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return nil, utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	userID, err := parseIDParam(c, "ID")
+	if err != nil {
+		return nil, utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid user ID", nil)
+	}
+
+	user, err := ac.db.FindUserById(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.SendErrorResponse(c, fiber.StatusNotFound, "User not found", nil)
+		}
+		return nil, utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+
+	if user.ID == principal.UserID {
+		return nil, utils.SendErrorResponse(c, fiber.StatusForbidden, "You cannot do this to your own account", nil)
+	}
+	if !principal.HasRole(models.RoleAdmin) && user.Role != models.RoleUser && user.Role != "" {
+		return nil, utils.SendErrorResponse(c, fiber.StatusForbidden, "Only admins can act on staff accounts", nil)
+	}
+
+	return user, nil
+}
+
+// auditEntry describes an action of the current principal on the target.
+func auditEntry(c *fiber.Ctx, action string, target uint, reason string, metadata fiber.Map) models.AuditLog {
+	entry := newAuditEntry(c, action, reason, metadata)
+	entry.TargetUserID = &target
+	return entry
+}
+
+// auditEntryOn describes an action of the current principal on something
+// other than a user. targetID is 0 for a row that does not exist yet, the
+// database fills it in.
+func auditEntryOn(c *fiber.Ctx, action, targetType string, targetID uint, reason string, metadata fiber.Map) models.AuditLog {
+	entry := newAuditEntry(c, action, reason, metadata)
+	entry.TargetType = targetType
+	if targetID != 0 {
+		entry.TargetID = &targetID
+	}
+	return entry
+}
+
+func newAuditEntry(c *fiber.Ctx, action string, reason string, metadata fiber.Map) models.AuditLog {
+	principal, _ := middleware.CurrentPrincipal(c)
+
+	details := []byte("{}")
+	if metadata != nil {
+		if encoded, err := json.Marshal(metadata); err == nil {
+			details = encoded
+		}
+	}
+
+	return models.AuditLog{
+		ActorID:   principal.UserID,
+		ActorRole: principal.User.Role,
+		Action:    action,
+		Reason:    reason,
+		Metadata:  string(details),
+		IP:        c.IP(),
+		CreatedAt: time.Now(),
+	}
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the User lookup logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// GetUser returns any account by ID.
+func (ac *AdminController) GetUser(c *fiber.Ctx) error {
+	userID, err := parseIDParam(c, "ID")
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid user ID", nil)
+	}
+
+	user, err := ac.db.FindUserById(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.SendErrorResponse(c, fiber.StatusNotFound, "User not found", nil)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  fiber.StatusOK,
+		"account": adminUser(user),
+	})
+}
+
+// SearchUser finds an account by email, username or phone number in ?q=.
+func (ac *AdminController) SearchUser(c *fiber.Ctx) error {
+	query := c.Query("q")
+	if query == "" {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{"q": "q is required"})
+	}
+
+	user, err := findUserByIdentifier(ac.db, query)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.SendErrorResponse(c, fiber.StatusNotFound, "User not found", nil)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  fiber.StatusOK,
+		"account": adminUser(user),
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the User lookup logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Ban logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+type BanUserRequest struct {
+	Reason    string     `json:"reason" validate:"required,max=500"`
+	ExpiresAt *time.Time `json:"expires_at"` // Suspension end, leave empty for a permanent ban
+}
+
+// BanUser bans or suspends an account and logs it out everywhere.
+func (ac *AdminController) BanUser(c *fiber.Ctx) error {
+	user, response := ac.findTarget(c)
+	if user == nil {
+		return response
+	}
+
+	var req BanUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+
+	if err := ac.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{"ExpiresAt": "ExpiresAt must be in the future"})
+	}
+
+	entry := auditEntry(c, models.AuditUserBanned, user.ID, req.Reason, fiber.Map{"expires_at": req.ExpiresAt})
+	if err := ac.db.BanUser(user.ID, req.Reason, req.ExpiresAt, entry); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to ban user", err.Error())
+	}
+
+	if err := revokeAllSessions(ac.db, user.ID); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "User banned but logging them out failed", err.Error())
+	}
+
+	message := "User banned"
+	if req.ExpiresAt != nil {
+		message = "User suspended"
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": message,
+		"status":  fiber.StatusOK,
+	})
+}
+
+type UnbanUserRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// UnbanUser lifts a ban or suspension early.
+func (ac *AdminController) UnbanUser(c *fiber.Ctx) error {
+	user, response := ac.findTarget(c)
+	if user == nil {
+		return response
+	}
+
+	var req UnbanUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+
+	if err := ac.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	if user.BannedAt == nil {
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "User is not banned", nil)
+	}
+
+	entry := auditEntry(c, models.AuditUserUnbanned, user.ID, req.Reason, fiber.Map{
+		"previous_reason": user.BanReason,
+		"expires_at":      user.BanExpiresAt,
+	})
+	if err := ac.db.UnbanUser(user.ID, entry); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to unban user", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User unbanned",
+		"status":  fiber.StatusOK,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Ban logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Account management logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+type SetVerifiedRequest struct {
+	Verified *bool  `json:"verified" validate:"required"`
+	Reason   string `json:"reason" validate:"max=500"`
+}
+
+// SetVerified grants or removes the blue check mark.
+func (ac *AdminController) SetVerified(c *fiber.Ctx) error {
+	user, response := ac.findTarget(c)
+	if user == nil {
+		return response
+	}
+
+	var req SetVerifiedRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+
+	if err := ac.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	action := models.AuditUserUnverified
+	if *req.Verified {
+		action = models.AuditUserVerified
+	}
+
+	entry := auditEntry(c, action, user.ID, req.Reason, fiber.Map{"previous": user.IsVerified})
+	if err := ac.db.SetUserVerified(user.ID, *req.Verified, entry); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to update user", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":     "Verification updated",
+		"status":      fiber.StatusOK,
+		"is_verified": *req.Verified,
+	})
+}
+
+type SetRoleRequest struct {
+	Role   string `json:"role" validate:"required,oneof=user moderator admin"`
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// SetRole promotes or demotes an account. Tokens carry no authority of their
+// own, AuthRequired reads the role from the user, so it applies immediately.
+func (ac *AdminController) SetRole(c *fiber.Ctx) error {
+	user, response := ac.findTarget(c)
+	if user == nil {
+		return response
+	}
+
+	var req SetRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+
+	if err := ac.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	entry := auditEntry(c, models.AuditUserRoleChanged, user.ID, req.Reason, fiber.Map{
+		"previous": user.Role,
+		"role":     req.Role,
+	})
+	if err := ac.db.SetUserRole(user.ID, req.Role, entry); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to update user", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Role updated",
+		"status":  fiber.StatusOK,
+		"role":    req.Role,
+	})
+}
+
+type ForceLogoutRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// ForceLogout ends every session of the account.
+func (ac *AdminController) ForceLogout(c *fiber.Ctx) error {
+	user, response := ac.findTarget(c)
+	if user == nil {
+		return response
+	}
+
+	var req ForceLogoutRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+		}
+	}
+
+	if err := ac.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	// Log first, a logout that happened must never be missing from the log
+	if err := ac.db.CreateAuditLog(auditEntry(c, models.AuditUserForcedLogout, user.ID, req.Reason, nil)); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to log out user", err.Error())
+	}
+
+	if err := revokeAllSessions(ac.db, user.ID); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to log out user", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User logged out of all sessions",
+		"status":  fiber.StatusOK,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Account management logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// ListAuditLogs pages through the audit log, newest first. ?user= narrows it
+// down to the actions taken on one account.
+func (ac *AdminController) ListAuditLogs(c *fiber.Ctx) error {
+	limit, offset := utils.ParsePagination(c)
+
+	targetUserID := uint(c.QueryInt("user", 0))
+	entries, total, err := ac.db.FindAuditLogs(targetUserID, limit, offset)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to load audit log", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  fiber.StatusOK,
+		"entries": entries,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// ListOrphanedMedia is a dry run of the media garbage collector: the files it
+// would delete if it ran now, oldest first, and how much space that frees.
+func (ac *AdminController) ListOrphanedMedia(c *fiber.Ctx) error {
+	limit, offset := utils.ParsePagination(c)
+	before := time.Now().Add(-models.MediaGCGracePeriod)
+
+	total, size, err := ac.db.CountOrphanedMediaAssets(before)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to load orphaned media", err.Error())
+	}
+	assets, err := ac.db.FindOrphanedMediaAssets(before, limit, offset)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to load orphaned media", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":       fiber.StatusOK,
+		"unused_since": before,
+		"assets":       assets,
+		"total":        total,
+		"total_size":   size,
+		"limit":        limit,
+		"offset":       offset,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Image blocklist logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// ListBlockedImages pages through the blocklist, newest first.
+func (ac *AdminController) ListBlockedImages(c *fiber.Ctx) error {
+	limit, offset := utils.ParsePagination(c)
+
+	images, total, err := ac.db.FindBlockedImages(limit, offset)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to load blocklist", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": fiber.StatusOK,
+		"images": images,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+type BlockImageRequest struct {
+	Hash   string `form:"hash" validate:"omitempty,hexadecimal,len=16"` // Perceptual hash, instead of sending the image
+	Action string `form:"action" validate:"omitempty,oneof=reject review"`
+	Reason string `form:"reason" validate:"required,max=500"`
+}
+
+// BlockImage puts an image on the blocklist, sent as "image" or as the hex
+// encoded perceptual hash of one. Only the hash is kept. Uploads resembling
+// it are rejected, or queued for review when action is "review".
+func (ac *AdminController) BlockImage(c *fiber.Ctx) error {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	var req BlockImageRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+	if err := ac.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	var hash uint64
+	if file, err := c.FormFile("image"); err == nil {
+		src, err := file.Open()
+		if err != nil {
+			return uploadErrorResponse(c, err)
+		}
+		defer src.Close()
+		processed, err := media.ProcessImage(src, nil)
+		if err != nil {
+			return uploadErrorResponse(c, err)
+		}
+		hash = processed.DHash
+	} else if req.Hash != "" {
+		// The hexadecimal validator also lets a 0x prefix through
+		if hash, err = strconv.ParseUint(req.Hash, 16, 64); err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{
+				"hash": "Must be 16 hexadecimal digits",
+			})
+		}
+	} else {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{
+			"image": "An image or its hash is required",
+		})
+	}
+
+	action := req.Action
+	if action == "" {
+		action = models.BlockActionReject
+	}
+
+	entry := auditEntryOn(c, models.AuditImageBlocked, models.AuditTargetBlockedImage, 0, req.Reason, fiber.Map{
+		"hash":   fmt.Sprintf("%016x", hash),
+		"action": action,
+	})
+	image, err := ac.db.CreateBlockedImage(models.BlockedImage{
+		DHash:     int64(hash),
+		Action:    action,
+		Reason:    req.Reason,
+		AddedByID: uint(principal.UserID),
+	}, entry)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to block image", err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Image blocked",
+		"status":  fiber.StatusCreated,
+		"image":   image,
+		"hash":    fmt.Sprintf("%016x", hash),
+	})
+}
+
+// ReasonRequest is the optional body of the actions that take nothing but
+// a reason for the audit log.
+type ReasonRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// parseReason reads a ReasonRequest, the body may be empty. It answers the
+// request itself and returns nil when the body is invalid.
+func (ac *AdminController) parseReason(c *fiber.Ctx) (*ReasonRequest, error) {
+	var req ReasonRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return nil, utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+		}
+	}
+
+	if err := ac.validate.Struct(req); err != nil {
+		return nil, utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+	return &req, nil
+}
+
+// UnblockImage takes an entry off the blocklist. Uploads it already
+// rejected stay rejected.
+func (ac *AdminController) UnblockImage(c *fiber.Ctx) error {
+	id, err := parseIDParam(c, "ID")
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid blocklist entry ID", nil)
+	}
+
+	req, response := ac.parseReason(c)
+	if req == nil {
+		return response
+	}
+
+	entry := auditEntryOn(c, models.AuditImageUnblocked, models.AuditTargetBlockedImage, id, req.Reason, nil)
+	deleted, err := ac.db.DeleteBlockedImage(id, entry)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to unblock image", err.Error())
+	}
+	if !deleted {
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Blocklist entry not found", nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Image unblocked",
+		"status":  fiber.StatusOK,
+	})
+}
+
+// ListMediaForReview is the moderators' queue of uploaded files resembling a
+// blocklist entry set to review, with the avatars, posts and stories using them.
+func (ac *AdminController) ListMediaForReview(c *fiber.Ctx) error {
+	limit, offset := utils.ParsePagination(c)
+
+	assets, total, err := ac.db.FindMediaAssetsForReview(limit, offset)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to load review queue", err.Error())
+	}
+
+	items := make([]fiber.Map, 0, len(assets))
+	for _, asset := range assets {
+		items = append(items, fiber.Map{
+			"asset":   asset,
+			"used_by": asset.Refs,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": fiber.StatusOK,
+		"items":  items,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// ResolveMediaReview takes a file off the review queue once a moderator has
+// dealt with it, e.g. by banning its owner or finding it harmless. The reason
+// is where the outcome goes.
+func (ac *AdminController) ResolveMediaReview(c *fiber.Ctx) error {
+	id, err := parseIDParam(c, "ID")
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid asset ID", nil)
+	}
+
+	req, response := ac.parseReason(c)
+	if req == nil {
+		return response
+	}
+
+	entry := auditEntryOn(c, models.AuditMediaReviewResolved, models.AuditTargetMediaAsset, id, req.Reason, nil)
+	resolved, err := ac.db.ClearMediaAssetReview(id, entry)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to resolve review", err.Error())
+	}
+	if !resolved {
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Asset is not waiting for review", nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Review resolved",
+		"status":  fiber.StatusOK,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Image blocklist logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Email outbox logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// ListOutbox pages through the email outbox, newest first. ?status= narrows
+// it down, e.g. to the dead messages waiting for a retry. Payloads are never
+// shown, they may hold tokens.
+func (ac *AdminController) ListOutbox(c *fiber.Ctx) error {
+	limit, offset := utils.ParsePagination(c)
+
+	status := c.Query("status")
+	switch status {
+	case "", models.OutboxPending, models.OutboxSending, models.OutboxSent, models.OutboxDead:
+	default:
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{
+			"status": "Must be one of pending, sending, sent or dead",
+		})
+	}
+
+	messages, total, err := ac.db.FindOutboxMessages(status, limit, offset)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to load outbox", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":   fiber.StatusOK,
+		"messages": messages,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// RetryOutboxMessage puts a dead message back in the queue with a fresh set
+// of attempts, e.g. once the SMTP server is reachable again.
+func (ac *AdminController) RetryOutboxMessage(c *fiber.Ctx) error {
+	id, err := parseIDParam(c, "ID")
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid message ID", nil)
+	}
+
+	req, response := ac.parseReason(c)
+	if req == nil {
+		return response
+	}
+
+	entry := auditEntryOn(c, models.AuditOutboxRetried, models.AuditTargetOutbox, id, req.Reason, nil)
+	requeued, err := ac.db.RequeueOutboxMessage(id, entry)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retry message", err.Error())
+	}
+	if !requeued {
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Message not found or not dead", nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Message queued for delivery",
+		"status":  fiber.StatusOK,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Email outbox logic -------------------------
+// --------------------------------------------------------------------------------------------------
@@ -2,40 +2,104 @@ package controllers
 
 import (
 	models "API/internal/Models"
-	"API/internal/config"
 	"API/internal/database"
+	"API/internal/mail"
+	"API/internal/media"
+	"API/internal/middleware"
 	"API/internal/utils"
 	"context"
 	"errors"
 	"fmt"
 	"html"
+	"io"
 	"log"
 	"mime/multipart"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-playground/validator"
 	"github.com/gofiber/fiber/v2"
 	"golang.org/x/crypto/bcrypt"
-	"golang.org/x/time/rate"
 	"gorm.io/gorm"
 )
 
 type AuthController struct {
 	db       database.Service    // The database service to interact with the database.
+	media    media.MediaStore    // Where avatars are stored.
+	emails   *mail.Emails        // Verification, password reset and security emails.
 	validate *validator.Validate // Validator instance for validating user inputs.
 }
 
-func NewAuthController(db database.Service) *AuthController {
+func NewAuthController(db database.Service, store media.MediaStore, emails *mail.Emails) *AuthController {
 	return &AuthController{
-		db:       db,              // Setting the provided database service.
-		validate: validator.New(), // Initializing a new validator instance.
+		db:       db,                   // Setting the provided database service.
+		media:    store,                // Setting the provided media store.
+		emails:   emails,               // Setting the provided emails.
+		validate: utils.NewValidator(), // Initializing a new validator instance.
 	}
 }
 
-var (
-	Limiter = rate.NewLimiter(rate.Every(100*time.Millisecond), 100) // More permissive for bursts
-)
+// uploadAvatar crops the image to a square without its EXIF data and stores
+// it, returning its public URL.
+func (ac *AuthController) uploadAvatar(ctx context.Context, userID uint, file *multipart.FileHeader) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	return ac.storeAvatar(ctx, userID, src)
+}
+
+// avatarFromUpload turns a finished upload into an avatar. The original is
+// deleted either way, only the cropped avatar is kept.
+func (ac *AuthController) avatarFromUpload(c *fiber.Ctx, userID uint, uploadID string) (string, error) {
+	upload, err := consumeUpload(c, ac.db, userID, uploadID)
+	if upload == nil {
+		return "", err
+	}
+
+	ctx := context.Background()
+	defer func() {
+		if err := ac.media.Delete(ctx, upload.MediaKey); err != nil {
+			log.Printf("Error deleting the original of upload %s: %v", upload.UploadID, err)
+		}
+	}()
+	if !utils.IsImageFilename(upload.Filename) {
+		return "", utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{
+			"upload_id": "An avatar has to be a photo",
+		})
+	}
+
+	src, err := ac.media.Open(ctx, upload.MediaKey)
+	if err != nil {
+		return "", uploadErrorResponse(c, err)
+	}
+	defer src.Close()
+
+	url, err := ac.storeAvatar(ctx, userID, src)
+	if err != nil {
+		return "", uploadErrorResponse(c, err)
+	}
+	return url, nil
+}
+
+// storeAvatar stores the avatar as a media asset of userID, 0 while
+// registering. Replaced avatars are not deleted here, the garbage collector
+// removes them once the user row no longer refers to them.
+func (ac *AuthController) storeAvatar(ctx context.Context, userID uint, src io.Reader) (string, error) {
+	processed, err := media.ProcessImage(src, media.AvatarVariants)
+	if err != nil {
+		return "", err
+	}
+
+	stored, err := storeImage(ctx, ac.db, ac.media, userID, "avatars", processed)
+	if err != nil {
+		return "", err
+	}
+	return stored["avatar"].URL, nil
+}
 
 // --------------------------------------------------------------------------------------------------
 //------------------------------ these is the start of the registration logic -------------------------
@@ -45,7 +109,7 @@ type RegisterRequest struct {
 	Username string `form:"username" validate:"required,max=30"`
 	Name     string `form:"name" validate:"required,max=255"`
 	Email    string `form:"email" validate:"required,email,max=255"`
-	Password string `form:"password" validate:"required,max=255,min=8"`
+	Password string `form:"password" validate:"required,password,notbreached"`
 	Bio      string `form:"bio" validate:"max=150"`
 	Website  string `form:"website" validate:"omitempty,url,max=255"`
 	Phone    string `form:"phone" validate:"required,max=255"`
@@ -56,9 +120,6 @@ type RegisterRequest struct {
 func (ac *AuthController) Register(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	if !Limiter.Allow() {
-		return utils.SendErrorResponse(c, fiber.StatusTooManyRequests, "Too many registration attempts", nil)
-	}
 
 	var req RegisterRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -69,10 +130,10 @@ func (ac *AuthController) Register(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
 	}
 
-	uploadChan := make(chan struct {
-		url string
-		err error
-	})
+	phone, err := utils.NormalizePhone(req.Phone)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{"Phone": err.Error()})
+	}
 
 	var avatarURL string
 
@@ -81,49 +142,10 @@ func (ac *AuthController) Register(c *fiber.Ctx) error {
 	if err != nil {
 		avatarURL = utils.GetDefaultAvatar()
 	} else {
-		// Get Cloudinary instance before goroutine
-		cld, err := config.InitCloudinary()
+		avatarURL, err = ac.uploadAvatar(ctx, 0, file)
 		if err != nil {
-			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to initialize Cloudinary", err.Error())
+			return uploadErrorResponse(c, err)
 		}
-
-		go func(file *multipart.FileHeader) {
-			var result struct {
-				url string
-				err error
-			}
-
-			if err := utils.ValidateImageFile(file); err != nil {
-				result.err = err
-				uploadChan <- result
-				return
-			}
-
-			fileHeader, err := file.Open()
-			if err != nil {
-				result.err = err
-				uploadChan <- result
-				return
-			}
-			defer fileHeader.Close()
-
-			url, err := utils.UploadToCloudinary(cld, ctx, fileHeader)
-			if err != nil {
-				result.err = err
-				uploadChan <- result
-				return
-			}
-
-			result.url = url
-			uploadChan <- result
-
-		}(file)
-
-		uploadResult := <-uploadChan
-		if uploadResult.err != nil {
-			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to upload image", uploadResult.err.Error())
-		}
-		avatarURL = uploadResult.url
 	}
 
 	// Use the existing context
@@ -149,13 +171,19 @@ func (ac *AuthController) Register(c *fiber.Ctx) error {
 		Avatar:   avatarURL,
 		// Avatar:   utils.GetDefaultAvatar(), // HERE'S THE FIRE ADDITION! 🔥
 		Website:  html.EscapeString(req.Website),
-		Phone:    html.EscapeString(req.Phone),
+		Phone:    &phone,
 		Language: html.EscapeString(req.Language),
 		Privacy:  req.Privacy,
 		Username: html.EscapeString(req.Username),
 		Token:    token,
 	}
 
+	// The verification email is queued with the account, never one without the other
+	verification, err := newEmailVerification(ac.emails, &createUserData, createUserData.Email)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to prepare verification email", err.Error())
+	}
+
 	var newUser models.User
 	// Wrap the user creation in a transaction
 	err = ac.db.GetDB().Transaction(func(tx *gorm.DB) error {
@@ -164,7 +192,7 @@ func (ac *AuthController) Register(c *fiber.Ctx) error {
 		var userPtr *models.User
 		// Retry mechanism for user creation
 		for attempts := 1; attempts <= 3; attempts++ {
-			userPtr, err = ac.db.CreateUser(createUserData)
+			userPtr, err = ac.db.CreateUser(createUserData, verification)
 			go func() {
 				utils.TrackRegistration(req.Email, true, attempts)
 			}()
@@ -179,13 +207,6 @@ func (ac *AuthController) Register(c *fiber.Ctx) error {
 		}
 		newUser = *userPtr
 
-		// Send verification email asynchronously
-		// go func() {
-		// 	if err := utils.SendVerificationEmail(newUser.Email, newUser.Token); err != nil {
-		// 		log.Printf("Failed to send verification email: %v", err)
-		// 	}
-		// }()
-
 		return nil
 	})
 
@@ -205,47 +226,108 @@ func (ac *AuthController) Register(c *fiber.Ctx) error {
 //------------------------------ these is the start of the Verify Email logic -------------------------
 // --------------------------------------------------------------------------------------------------
 
-func (ac *AuthController) VerifyEmail(c *fiber.Ctx) error {
-	GodTOken := html.EscapeString(c.Params("token"))
+// newEmailVerification issues a verification token for email and builds the
+// email carrying it, in the language of the user. The user may not exist
+// yet, the database fills in its ID.
+func newEmailVerification(emails *mail.Emails, user *models.User, email string) (*database.EmailVerification, error) {
+	rawToken, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
 
-	var updateResult models.User
-	err := ac.db.GetDB().Transaction(func(tx *gorm.DB) error {
-		var err error
-		var userPtr *models.User
+	to := mail.To(user)
+	to.Email = email
+	msg, err := emails.Verification(to, rawToken).Outbox(user.ID)
+	if err != nil {
+		return nil, err
+	}
 
-		for attempts := 1; attempts <= 3; attempts++ {
-			userPtr, err = ac.db.VerifyUserAndUpdate(GodTOken)
-			utils.TrackFindUserByToken(userPtr.Email, true, attempts)
-			if err == nil {
-				break
-			}
-			time.Sleep(time.Second * time.Duration(attempts))
+	return &database.EmailVerification{
+		Token: models.EmailVerificationToken{
+			UserID:    user.ID,
+			Email:     email,
+			TokenHash: utils.HashToken(rawToken),
+			ExpiresAt: time.Now().Add(models.EmailVerificationTTL),
+		},
+		Email: msg,
+	}, nil
+}
+
+// sendEmailVerification queues a new verification email for an existing
+// account, in the outbox.
+func sendEmailVerification(db database.Service, emails *mail.Emails, user *models.User, email string) error {
+	verification, err := newEmailVerification(emails, user, email)
+	if err != nil {
+		return err
+	}
+	_, err = db.CreateEmailVerificationToken(verification.Token, verification.Email)
+	return err
+}
+
+func (ac *AuthController) VerifyEmail(c *fiber.Ctx) error {
+	token := c.Params("token")
+
+	user, err := ac.db.VerifyEmail(utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, database.ErrVerificationTokenInvalid) {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Verification link is invalid or has expired", nil)
 		}
-		if err != nil {
-			return err
+		if errors.Is(err, database.ErrEmailTaken) {
+			return utils.SendErrorResponse(c, fiber.StatusConflict, "This email address is already in use", nil)
 		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to verify email", err.Error())
+	}
+	utils.TrackFindUserByToken(user.Email, true, 1)
 
-		updateResult = *userPtr
+	// The link proves the email, not the account, so 2FA and bans still apply
+	return respondWithLogin(ac.db, ac.emails, user, c)
+}
 
-		return nil
-	})
+// Resending is limited per account, every resend is a real email. The route
+// is only under the per-user API limit, which lets hundreds through a minute.
+const (
+	verificationResendLimit  = 3
+	verificationResendWindow = time.Hour
+)
+
+// ResendVerification sends a new verification link to the pending email, or
+// to the account email if it was never verified.
+func (ac *AuthController) ResendVerification(c *fiber.Ctx) error {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
 
+	user, err := ac.db.FindUserById(principal.UserID)
 	if err != nil {
-		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Bad Verification token", err.Error())
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "User not found", err.Error())
+	}
+
+	email := user.PendingEmail
+	if email == "" {
+		if user.EmailVerified {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Email is already verified", nil)
+		}
+		email = user.Email
 	}
 
-	JWT, err := utils.GenerateToken(updateResult.ID, updateResult.Email, updateResult.Name, updateResult.Username, updateResult.Avatar, updateResult.Token, updateResult.Bio, updateResult.Website, updateResult.Phone, updateResult.Language, updateResult.EmailVerified, updateResult.Privacy, updateResult.EmailVerified, updateResult.FollowingCount, updateResult.FollowerCount)
+	allowed, retryAfter, err := utils.Throttle(context.Background(),
+		fmt.Sprintf("verify-resend:%d", user.ID), verificationResendLimit, verificationResendWindow)
 	if err != nil {
-		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to generate JWT token", err.Error())
+		return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Please try again later", err.Error())
+	}
+	if !allowed {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(retryAfter.Seconds())))
+		return utils.SendErrorResponse(c, fiber.StatusTooManyRequests, "Too many verification emails, please try again later", nil)
+	}
+
+	if err := sendEmailVerification(ac.db, ac.emails, user, email); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to send verification email", err.Error())
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"detail": "User have been verify successfully",
-		"status": fiber.StatusOK,
-		"JWT":    JWT,
-		"user": fiber.Map{
-			"User": updateResult,
-		},
+		"message": "Verification email sent",
+		"status":  fiber.StatusOK,
 	})
 }
 
@@ -258,17 +340,14 @@ func (ac *AuthController) VerifyEmail(c *fiber.Ctx) error {
 // --------------------------------------------------------------------------------------------------
 
 type LoginRequest struct {
-	Email    string `json:"email" validate:"required,email,max=255"`    // Must be a valid email
-	Password string `json:"password" validate:"required,max=255,min=8"` // Cannot be empty
+	Identifier string `json:"identifier" validate:"omitempty,max=255"`    // Email, username or phone number
+	Email      string `json:"email" validate:"omitempty,email,max=255"`   // Older clients only send the email
+	Password   string `json:"password" validate:"required,max=255,min=8"` // Cannot be empty
 }
 
 func (ac *AuthController) Login(c *fiber.Ctx) error {
 	var req LoginRequest
 
-	if !Limiter.Allow() {
-		return utils.SendErrorResponse(c, fiber.StatusTooManyRequests, "Too many registration attempts", nil)
-	}
-
 	if err := c.BodyParser(&req); err != nil {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
 	}
@@ -277,14 +356,22 @@ func (ac *AuthController) Login(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
 	}
 
+	identifier := req.Identifier
+	if identifier == "" {
+		identifier = req.Email
+	}
+	if identifier == "" {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{"Identifier": "Identifier is required"})
+	}
+
 	var user *models.User
 	err := ac.db.GetDB().Transaction(func(tx *gorm.DB) error {
 		var err error
 
 		for attempts := 1; attempts <= 3; attempts++ {
-			user, err = ac.db.FindUserByEmail(html.EscapeString(req.Email))
-			utils.TrackFindUserByEMAIL(req.Email, true, attempts)
-			if err == nil {
+			user, err = findUserByIdentifier(ac.db, identifier)
+			utils.TrackFindUserByEMAIL(identifier, true, attempts)
+			if err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
 				break
 			}
 			time.Sleep(time.Second * time.Duration(attempts))
@@ -297,27 +384,85 @@ func (ac *AuthController) Login(c *fiber.Ctx) error {
 		return nil
 	})
 
-	if err != nil {
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Error during login", utils.FormatValidationErrors(err))
 	}
 
-	if user == nil {
-		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Error during login", utils.FormatValidationErrors(err))
+	account := loginAccountKey(user, identifier)
+	ctx := context.Background()
+
+	wait, err := utils.LoginRetryAfter(ctx, account, c.IP())
+	if err != nil {
+		log.Printf("Failed to check login lockout for %s: %v", account, err)
+	}
+	if wait > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+		return utils.SendErrorResponse(c, fiber.StatusTooManyRequests, "Too many failed login attempts, try again later", nil)
+	}
+
+	// Same answer for an unknown email and a wrong password, in the same time.
+	// Accounts from social login have no password to compare either.
+	hasPassword := user != nil && user.Password != ""
+	passwordHash := dummyPasswordHash()
+	if hasPassword {
+		passwordHash = []byte(user.Password)
+	}
+	if bcrypt.CompareHashAndPassword(passwordHash, []byte(req.Password)) != nil || !hasPassword {
+		recordLoginFailure(ac.db, ac.emails, c, user, account)
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid login or password", nil)
+	}
+
+	// With 2FA the password is only half the login, TwoFactorController.Verify
+	// clears the failures once the code is right too
+	if !user.TwoFactorEnabled {
+		if err := utils.ResetLoginFailures(ctx, account); err != nil {
+			log.Printf("Failed to reset login failures for %s: %v", account, err)
+		}
 	}
-	JWT, err := utils.GenerateToken(user.ID, user.Email, user.Name, user.Username, user.Avatar, user.Token, user.Bio, user.Website, user.Phone, user.Language, user.EmailVerified, user.Privacy, user.EmailVerified, user.FollowingCount, user.FollowerCount)
 
+	return respondWithLogin(ac.db, ac.emails, user, c)
+}
+
+// recordLoginFailure counts a failed password or second factor against the
+// account and IP, and tells the owner when it locked the account. user is
+// nil for identifiers matching no account.
+func recordLoginFailure(db database.Service, emails *mail.Emails, c *fiber.Ctx, user *models.User, account string) {
+	locked, err := utils.RecordLoginFailure(context.Background(), account, c.IP())
 	if err != nil {
-		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to generate JWT token", err.Error())
+		log.Printf("Failed to record login failure for %s: %v", account, err)
+	}
+	if !locked || user == nil {
+		return
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"detail": "User have been verify successfully",
-		"status": fiber.StatusOK,
-		"JWT":    JWT,
-		"user": fiber.Map{
-			"User": user,
-		},
-	})
+	until := time.Now().Add(utils.LoginLockoutDuration)
+	msg, err := emails.AccountLocked(mail.To(user), c.IP(), until).Outbox(user.ID)
+	if err == nil {
+		err = db.EnqueueOutboxMessage(msg)
+	}
+	if err != nil {
+		log.Printf("Failed to queue account locked email for user %d: %v", user.ID, err)
+	}
+}
+
+// dummyPasswordHash is compared against when no account matches, so an
+// unknown identifier costs the same bcrypt run as a wrong password.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// loginAccountKey is what failed logins are counted against: the user when
+// the identifier matched one, so email, username and phone share a counter,
+// otherwise the identifier itself.
+func loginAccountKey(user *models.User, identifier string) string {
+	if user != nil {
+		return "user:" + strconv.FormatUint(uint64(user.ID), 10)
+	}
+	return "identifier:" + strings.ToLower(strings.TrimSpace(identifier))
 }
 
 // --------------------------------------------------------------------------------------------------
@@ -332,13 +477,18 @@ type ForgotPasswordRequest struct {
 	Email string `json:"email" validate:"required,email,max=255"` // Must be a valid email
 }
 
+// forgotPasswordResponse is sent whether or not the email is registered, so the
+// endpoint cannot be used to find out who has an account.
+func forgotPasswordResponse(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "If an account exists for this email, a reset link has been sent",
+		"status":  fiber.StatusOK,
+	})
+}
+
 func (ac *AuthController) ForgotPassword(c *fiber.Ctx) error {
 	var req ForgotPasswordRequest
 
-	if !Limiter.Allow() {
-		return utils.SendErrorResponse(c, fiber.StatusTooManyRequests, "Too many registration attempts", nil)
-	}
-
 	if err := c.BodyParser(&req); err != nil {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
 	}
@@ -347,47 +497,38 @@ func (ac *AuthController) ForgotPassword(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
 	}
 
-	var user *models.User
-	err := ac.db.GetDB().Transaction(func(tx *gorm.DB) error {
-		var err error
-
-		for attempts := 1; attempts <= 3; attempts++ {
-			user, err = ac.db.FindUserByEmail(html.EscapeString(req.Email))
-			utils.TrackFindUserByEMAIL(req.Email, true, attempts)
-			if err == nil {
-				break
-			}
-			time.Sleep(time.Second * time.Duration(attempts))
-		}
-
-		if err != nil {
-			return err
+	user, err := ac.db.FindUserByEmail(req.Email)
+	utils.TrackFindUserByEMAIL(req.Email, err == nil, 1)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error looking up user for password reset: %v", err)
 		}
+		return forgotPasswordResponse(c)
+	}
 
-		return nil
-	})
+	rawToken, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		log.Printf("Error generating password reset token: %v", err)
+		return forgotPasswordResponse(c)
+	}
 
-	if err != nil && err != gorm.ErrRecordNotFound {
-		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to check user existence", err.Error())
+	msg, err := ac.emails.PasswordReset(mail.To(user), rawToken).Outbox(user.ID)
+	if err != nil {
+		log.Printf("Error building password reset email for user %d: %v", user.ID, err)
+		return forgotPasswordResponse(c)
 	}
 
-	go func() {
-		// Assume you have a function that sends the email
-		err := utils.SendVerificationPassword(user.Email, user.Token)
-		if err != nil {
-			// Return an error response if sending the verification email fails.
-			c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":  "Failed to send verification email", // Error message.
-				"status": fiber.StatusInternalServerError,     // Internal server error status code.
-				"TO":     user.Email,
-			})
-		}
-	}()
+	// The token and its email are saved together, the outbox delivers it
+	if _, err := ac.db.CreatePasswordResetToken(models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(rawToken),
+		ExpiresAt: time.Now().Add(models.PasswordResetTTL),
+	}, msg); err != nil {
+		log.Printf("Error storing password reset token for user %d: %v", user.ID, err)
+		return forgotPasswordResponse(c)
+	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message": "Reset Password Email have been send please check you email", // Success message.
-		"status":  fiber.StatusCreated,                                          // Created status code.
-	})
+	return forgotPasswordResponse(c)
 }
 
 // -----------------------------------------------------------------------------------------------------
@@ -398,57 +539,155 @@ func (ac *AuthController) ForgotPassword(c *fiber.Ctx) error {
 // ------------------------------ these is the start  of the RestPasswordRequest logic -------------------------
 // ------------------------------------------------------------------------------------------------------------
 
-func (ac *AuthController) RestPassword(c *fiber.Ctx) error {
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required,max=255"`
+	NewPassword string `json:"new_password" validate:"required,password,notbreached"`
+}
 
-	Token := html.EscapeString(c.Params("Token"))
+// ResetPassword sets a new password with a token from the reset email and logs
+// the user out of every session, since whoever had the old password may be
+// one of them.
+func (ac *AuthController) ResetPassword(c *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
 
-	var user *models.User
-	err := ac.db.GetDB().Transaction(func(tx *gorm.DB) error {
-		var err error
+	if err := ac.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
 
-		for attempts := 1; attempts <= 3; attempts++ {
-			user, err = ac.db.FindUserByToken(Token)
-			utils.TrackFindUserByToken(user.Email, true, attempts)
-			if err == nil {
-				break
-			}
-			time.Sleep(time.Second * time.Duration(attempts))
-		}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to hash password", err.Error())
+	}
 
-		if err != nil {
-			return err
+	user, err := ac.db.ResetPassword(utils.HashToken(req.Token), string(hashedPassword))
+	if err != nil {
+		if errors.Is(err, database.ErrResetTokenInvalid) {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Reset link is invalid or has expired", nil)
 		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to reset password", err.Error())
+	}
 
-		return nil
+	if err := revokeAllSessions(ac.db, user.ID); err != nil {
+		log.Printf("Error revoking sessions after password reset for user %d: %v", user.ID, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Password has been reset, please log in with your new password",
+		"status":  fiber.StatusOK,
 	})
+}
 
-	if err != nil && err != gorm.ErrRecordNotFound {
-		// Return an error response if there is an error other than record not found.
-		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+// ----------------------------------- -------------------------------------------------------------------------
+// ------------------------------ these is the End of the RestPasswordRequest logic -------------------------
+// ------------------------------------------------------------------------------------------------------------
+
+// ------------------------------------------------------------------------------------------------------------
+// ------------------------------ these is the Start of the Phone Verification logic -------------------------
+// ------------------------------------------------------------------------------------------------------------
+
+// Every code is a paid SMS, so sending is limited per account
+const (
+	phoneCodeLimit  = 3
+	phoneCodeWindow = time.Hour
+)
+
+// SendPhoneCode texts a 6-digit code to the user's phone number.
+func (ac *AuthController) SendPhoneCode(c *fiber.Ctx) error {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
 	}
 
-	if user == nil {
-		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	user := principal.User
+	if user.PhoneVerified {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Phone number is already verified", nil)
+	}
+	if user.Phone == nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Add a phone number to your account first", nil)
 	}
 
-	JWT, err := utils.GenerateToken(user.ID, user.Email, user.Name, user.Username, user.Avatar, user.Token, user.Bio, user.Website, user.Phone, user.Language, user.EmailVerified, user.Privacy, user.EmailVerified, user.FollowingCount, user.FollowerCount)
+	ctx := context.Background()
+	allowed, retryAfter, err := utils.Throttle(ctx, fmt.Sprintf("phone-code:%d", user.ID), phoneCodeLimit, phoneCodeWindow)
 	if err != nil {
-		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to generate JWT token", err.Error())
+		return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Please try again later", err.Error())
+	}
+	if !allowed {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(retryAfter.Seconds())))
+		return utils.SendErrorResponse(c, fiber.StatusTooManyRequests, "Too many codes requested, please try again later", nil)
 	}
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 
-		"detail": "User have been verify successfully",
-		"status": fiber.StatusOK,
-		"JWT":    JWT,
-		"user": fiber.Map{
-			"User": user,
-		},
+	code, err := utils.GeneratePhoneOTP()
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to generate code", err.Error())
+	}
+
+	if err := utils.StorePhoneOTP(ctx, user.ID, *user.Phone, code); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Failed to store code", err.Error())
+	}
+
+	message := fmt.Sprintf("Your %s verification code is %s. It expires in %d minutes.", utils.TOTPIssuer, code, int(utils.PhoneOTPTTL.Minutes()))
+	if err := utils.SMS.Send(ctx, *user.Phone, message); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadGateway, "Failed to send SMS", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":    "Verification code sent",
+		"status":     fiber.StatusOK,
+		"expires_in": int(utils.PhoneOTPTTL.Seconds()),
 	})
+}
 
+type VerifyPhoneRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
 }
 
-// ----------------------------------- -------------------------------------------------------------------------
-// ------------------------------ these is the End of the RestPasswordRequest logic -------------------------
+// VerifyPhone checks the code sent by SendPhoneCode.
+func (ac *AuthController) VerifyPhone(c *fiber.Ctx) error {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	var req VerifyPhoneRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+
+	if err := ac.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	if principal.User.Phone == nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Add a phone number to your account first", nil)
+	}
+
+	phone := *principal.User.Phone
+	valid, err := utils.CheckPhoneOTP(context.Background(), principal.UserID, phone, req.Code)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Please try again later", err.Error())
+	}
+	if !valid {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid or expired code", nil)
+	}
+
+	if err := ac.db.MarkPhoneVerified(principal.UserID, phone); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.SendErrorResponse(c, fiber.StatusConflict, "Phone number changed, please request a new code", nil)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to verify phone number", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Phone number verified",
+		"status":  fiber.StatusOK,
+	})
+}
+
+// ------------------------------------------------------------------------------------------------------------
+// ------------------------------ these is the End of the Phone Verification logic -------------------------
 // ------------------------------------------------------------------------------------------------------------
 
 // ------------------------------------------------------------------------------------------------------------
@@ -457,32 +696,28 @@ func (ac *AuthController) RestPassword(c *fiber.Ctx) error {
 
 // DeleteUser - Clean and secure user deletion
 func (ac *AuthController) DeleteUser(c *fiber.Ctx) error {
-	claims, ok := c.Locals("user").(*utils.Claims)
-	if !ok || claims == nil {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
 		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
 	}
 
 	ID := html.EscapeString(c.Params("ID"))
 
-	if claims.ID != ID {
+	if strconv.FormatUint(uint64(principal.UserID), 10) != ID {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "You are not authorized to delete this account", nil)
 	}
 
-	// Convert string ID to uint
-	userID, err := strconv.ParseUint(claims.ID, 10, 32)
-	if err != nil {
-		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid user ID format", err.Error())
-	}
+	userID := principal.UserID
 
 	// deleteUser, err := ac.db.FindUserById(uint(userID))
 
 	var deleteUser *models.User
-	err = ac.db.GetDB().Transaction(func(tx *gorm.DB) error {
+	err := ac.db.GetDB().Transaction(func(tx *gorm.DB) error {
 		var err error
 
 		for attempts := 1; attempts <= 3; attempts++ {
 			deleteUser, err = ac.db.FindUserById(uint(userID))
-			utils.TrackFindUserByID(claims.Email, true, attempts)
+			utils.TrackFindUserByID(principal.User.Email, true, attempts)
 			if err == nil {
 				break
 			}
@@ -530,7 +765,7 @@ func (ac *AuthController) DeleteUser(c *fiber.Ctx) error {
 		}
 
 		// Proceed with user deletion
-		_, err := ac.db.DeleteUser(claims.ID)
+		_, err := ac.db.DeleteUser(ID)
 		if err != nil {
 			return err
 		}
@@ -541,25 +776,9 @@ func (ac *AuthController) DeleteUser(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete user", err.Error())
 	}
 
-	// Handle avatar deletion in background if it exists
-	if deleteUser.Avatar != "" {
-		go func() {
-			publicID, err := utils.ExtractPublicID(deleteUser.Avatar)
-			if err != nil {
-				log.Printf("Error extracting public ID: %v", err)
-				return
-			}
-
-			cld, err := config.InitCloudinary()
-			if err != nil {
-				log.Printf("Error initializing Cloudinary: %v", err)
-				return
-			}
-
-			if err := utils.DeleteImageFromCloudinary(cld, publicID); err != nil {
-				log.Printf("Error deleting image from Cloudinary: %v", err)
-			}
-		}()
+	// Tokens of a deleted account must stop working right away
+	if err := revokeAllSessions(ac.db, deleteUser.ID); err != nil {
+		log.Printf("Error revoking sessions of deleted user %d: %v", deleteUser.ID, err)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -579,14 +798,21 @@ func (ac *AuthController) DeleteUser(c *fiber.Ctx) error {
 // ------------------------------------------------------------------------------------------------------------
 
 type EditUserRequest struct {
-	Name     string `form:"name" validate:"omitempty,max=255"`
-	Email    string `form:"email" validate:"omitempty,email,max=255"`
-	Password string `form:"password" validate:"omitempty,max=255,min=8"`
-	Bio      string `form:"bio" validate:"omitempty,max=255"`
+	Name            string `form:"name" validate:"omitempty,max=255"`
+	Email           string `form:"email" validate:"omitempty,email,max=255"`
+	Password        string `form:"password" validate:"omitempty,password,notbreached"`
+	CurrentPassword string `form:"current_password" validate:"omitempty,max=255"` // Needed to change the email or password
+	Bio             string `form:"bio" validate:"omitempty,max=255"`
+	UploadID        string `form:"upload_id" validate:"omitempty,uuid"`  // A finished upload to use as the avatar
+	Timezone        string `form:"timezone" validate:"omitempty,max=64"` // IANA name, e.g. Europe/Paris
+	Digest          *bool  `form:"digest"`                               // Weekly digest email on or off
 }
 
 func (ac *AuthController) EditUser(c *fiber.Ctx) error {
-	claims := c.Locals("user").(*utils.Claims)
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
 	var req EditUserRequest
 
 	if err := c.BodyParser(&req); err != nil {
@@ -596,80 +822,68 @@ func (ac *AuthController) EditUser(c *fiber.Ctx) error {
 	if err := ac.validate.Struct(req); err != nil {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
 	}
+	// Postgres schedules the digest with this name, so Postgres has to know it
+	if req.Timezone != "" {
+		known, err := ac.db.IsKnownTimezone(req.Timezone)
+		if err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to check time zone", err.Error())
+		}
+		if !known {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{
+				"timezone": "Must be an IANA time zone, e.g. Europe/Paris",
+			})
+		}
+	}
 
 	// Get existing user
-	existingUser, err := ac.db.FindUserById(uint(claims.UserID))
+	existingUser, err := ac.db.FindUserById(uint(principal.UserID))
 	if err != nil {
 		return utils.SendErrorResponse(c, fiber.StatusNotFound, "User not found", err.Error())
 	}
 
-	// Handle avatar upload if provided
-	file, err := c.FormFile("avatar")
-	if err == nil {
-		uploadChan := make(chan struct {
-			url string
-			err error
-		})
-
-		cld, err := config.InitCloudinary()
-		if err != nil {
-			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to initialize Cloudinary", err.Error())
+	// Either change hands over the account, a stolen session alone must not do it
+	changesEmail := req.Email != "" && req.Email != existingUser.Email
+	if req.Password != "" || changesEmail {
+		if req.CurrentPassword == "" {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{
+				"current_password": "Required to change the email or password",
+			})
 		}
+		if bcrypt.CompareHashAndPassword([]byte(existingUser.Password), []byte(req.CurrentPassword)) != nil {
+			return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Incorrect password", nil)
+		}
+	}
 
-		ctx := context.Background()
-
-		go func(file *multipart.FileHeader) {
-			var result struct {
-				url string
-				err error
-			}
-
-			if err := utils.ValidateImageFile(file); err != nil {
-				result.err = err
-				uploadChan <- result
-				return
-			}
-
-			fileHeader, err := file.Open()
-			if err != nil {
-				result.err = err
-				uploadChan <- result
-				return
-			}
-			defer fileHeader.Close()
-
-			// Delete old avatar if exists
-			if existingUser.Avatar != "" {
-				publicID, err := utils.ExtractPublicID(existingUser.Avatar)
-				if err == nil {
-					utils.DeleteImageFromCloudinary(cld, publicID)
-				}
-			}
-
-			url, err := utils.UploadToCloudinary(cld, ctx, fileHeader)
-			if err != nil {
-				result.err = err
-				uploadChan <- result
-				return
-			}
-
-			result.url = url
-			uploadChan <- result
-		}(file)
-
-		uploadResult := <-uploadChan
-		if uploadResult.err != nil {
-			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to upload image", uploadResult.err.Error())
+	// Handle avatar upload if provided, the old one is left to the garbage collector
+	if req.UploadID != "" {
+		url, err := ac.avatarFromUpload(c, existingUser.ID, req.UploadID)
+		if url == "" {
+			return err
 		}
-		existingUser.Avatar = uploadResult.url
+		existingUser.Avatar = url
+	} else if file, err := c.FormFile("avatar"); err == nil {
+		url, err := ac.uploadAvatar(context.Background(), existingUser.ID, file)
+		if err != nil {
+			return uploadErrorResponse(c, err)
+		}
+		existingUser.Avatar = url
 	}
 
 	// Update user fields if provided
 	if req.Name != "" {
 		existingUser.Name = html.EscapeString(req.Name)
 	}
-	if req.Email != "" {
-		existingUser.Email = html.EscapeString(req.Email)
+	// A new email only takes effect once the user proves they own it
+	var verification *database.EmailVerification
+	if changesEmail {
+		if other, err := ac.db.FindUserByEmail(req.Email); err == nil && other.ID != existingUser.ID {
+			return utils.SendErrorResponse(c, fiber.StatusConflict, "This email address is already in use", nil)
+		}
+		verification, err = newEmailVerification(ac.emails, existingUser, req.Email)
+		if err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to prepare verification email", err.Error())
+		}
+		existingUser.PendingEmail = req.Email
 	}
 	if req.Password != "" {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
@@ -681,22 +895,43 @@ func (ac *AuthController) EditUser(c *fiber.Ctx) error {
 	if req.Bio != "" {
 		existingUser.Bio = html.EscapeString(req.Bio)
 	}
+	if req.Timezone != "" {
+		existingUser.Timezone = req.Timezone
+	}
+	if req.Digest != nil {
+		existingUser.DigestOptIn = *req.Digest
+	}
 
 	// Update user in database
-	updatedUser, err := ac.db.UpdateUser(*existingUser)
+	updatedUser, err := ac.db.UpdateUser(*existingUser, verification)
 	if err != nil {
 		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to update user", err.Error())
 	}
 
+	// As after a reset, whoever had the old password may be logged in elsewhere
+	if req.Password != "" {
+		if err := revokeOtherSessions(ac.db, updatedUser.ID, principal.SessionID); err != nil {
+			log.Printf("Error revoking sessions after password change for user %d: %v", updatedUser.ID, err)
+		}
+	}
+
+	message := "User updated successfully"
+	if verification != nil {
+		message = "User updated successfully, please check your new email address to confirm the change"
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "User updated successfully",
+		"message": message,
 		"status":  fiber.StatusOK,
 		"user": fiber.Map{
-			"id":     updatedUser.ID,
-			"name":   updatedUser.Name,
-			"email":  updatedUser.Email,
-			"bio":    updatedUser.Bio,
-			"avatar": updatedUser.Avatar,
+			"id":            updatedUser.ID,
+			"name":          updatedUser.Name,
+			"email":         updatedUser.Email,
+			"pending_email": updatedUser.PendingEmail,
+			"bio":           updatedUser.Bio,
+			"avatar":        updatedUser.Avatar,
+			"timezone":      updatedUser.Timezone,
+			"digest":        updatedUser.DigestOptIn,
 		},
 	})
 }
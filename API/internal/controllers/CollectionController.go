@@ -0,0 +1,423 @@
+package controllers
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/utils"
+	"errors"
+	"html"
+	"strings"
+
+	"github.com/go-playground/validator"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// AllPostsCollection is the ID of the virtual collection holding every saved post.
+const AllPostsCollection = "all"
+
+type CollectionController struct {
+	db       database.Service    // The database service to interact with the database.
+	validate *validator.Validate // Validator instance for validating user inputs.
+}
+
+func NewCollectionController(db database.Service) *CollectionController {
+	return &CollectionController{
+		db:       db,
+		validate: utils.NewValidator(),
+	}
+}
+
+// resolveCollection turns the :ID route param into a collection filter owned
+// by the user. "all" resolves to nil, the virtual "All posts" collection.
+func (cc *CollectionController) resolveCollection(c *fiber.Ctx, userID uint) (*uint, int, error) {
+	if c.Params("ID") == AllPostsCollection {
+		return nil, 0, nil
+	}
+
+	collectionID, err := parseIDParam(c, "ID")
+	if err != nil {
+		return nil, fiber.StatusBadRequest, errors.New("invalid collection ID")
+	}
+
+	collection, err := cc.db.FindCollectionById(collectionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fiber.StatusNotFound, errors.New("collection not found")
+		}
+		return nil, fiber.StatusInternalServerError, err
+	}
+
+	// Collections are private, so someone else's collection simply does not exist
+	if collection.UserID != userID {
+		return nil, fiber.StatusNotFound, errors.New("collection not found")
+	}
+
+	return &collection.ID, 0, nil
+}
+
+// hasCollectionNamed reports whether another of the user's collections
+// already uses the given escaped name, ignoring case.
+func (cc *CollectionController) hasCollectionNamed(userID uint, name string, exceptID uint) (bool, error) {
+	collections, err := cc.db.FindCollectionsByUser(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, collection := range collections {
+		if collection.ID != exceptID && strings.EqualFold(collection.Name, name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Save Post logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+type SavePostRequest struct {
+	CollectionID *uint `json:"collection_id"`
+}
+
+func (cc *CollectionController) SavePost(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	postID, err := parseIDParam(c, "ID")
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid post ID", err.Error())
+	}
+
+	var req SavePostRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+		}
+	}
+
+	if _, err := cc.db.FindPostById(postID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.SendErrorResponse(c, fiber.StatusNotFound, "Post not found", nil)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+
+	if req.CollectionID != nil {
+		collection, err := cc.db.FindCollectionById(*req.CollectionID)
+		if err != nil || collection.UserID != userID {
+			return utils.SendErrorResponse(c, fiber.StatusNotFound, "Collection not found", nil)
+		}
+	}
+
+	saved, err := cc.db.SavePost(userID, postID, req.CollectionID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to save post", err.Error())
+	}
+
+	message := "Post saved successfully"
+	if !saved {
+		message = "Post was already saved"
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": message,
+		"status":  fiber.StatusOK,
+		"saved":   true,
+	})
+}
+
+func (cc *CollectionController) UnsavePost(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	postID, err := parseIDParam(c, "ID")
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid post ID", err.Error())
+	}
+
+	removed, err := cc.db.UnsavePost(userID, postID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to unsave post", err.Error())
+	}
+
+	if !removed {
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Post is not saved", nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Post removed from saved posts",
+		"status":  fiber.StatusOK,
+		"saved":   false,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Save Post logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Collections logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+type CollectionRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+func (cc *CollectionController) ListCollections(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	allCount, err := cc.db.CountSavedPosts(userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to load collections", err.Error())
+	}
+
+	collections, err := cc.db.FindCollectionsByUser(userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to load collections", err.Error())
+	}
+
+	result := []fiber.Map{{
+		"id":         AllPostsCollection,
+		"name":       "All posts",
+		"post_count": allCount,
+	}}
+	for _, collection := range collections {
+		result = append(result, fiber.Map{
+			"id":         collection.ID,
+			"name":       collection.Name,
+			"post_count": collection.PostCount,
+			"created_at": collection.CreatedAt,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":      fiber.StatusOK,
+		"collections": result,
+	})
+}
+
+func (cc *CollectionController) CreateCollection(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	var req CollectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+
+	// Names are stored escaped, so the length limit is on the escaped name
+	req.Name = html.EscapeString(strings.TrimSpace(req.Name))
+	if err := cc.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	if strings.EqualFold(req.Name, AllPostsCollection) || strings.EqualFold(req.Name, "All posts") {
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "This collection name is reserved", nil)
+	}
+
+	exists, err := cc.hasCollectionNamed(userID, req.Name, 0)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+	if exists {
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "You already have a collection with this name", nil)
+	}
+
+	collection, err := cc.db.CreateCollection(models.Collection{
+		UserID: userID,
+		Name:   req.Name,
+	})
+	if errors.Is(err, database.ErrCollectionNameTaken) {
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "You already have a collection with this name", nil)
+	}
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create collection", err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":    "Collection created successfully",
+		"status":     fiber.StatusCreated,
+		"collection": collection,
+	})
+}
+
+func (cc *CollectionController) RenameCollection(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	if c.Params("ID") == AllPostsCollection {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "The All posts collection cannot be renamed", nil)
+	}
+
+	collectionID, status, err := cc.resolveCollection(c, userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, status, "Failed to find collection", err.Error())
+	}
+
+	var req CollectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+
+	// Names are stored escaped, so the length limit is on the escaped name
+	req.Name = html.EscapeString(strings.TrimSpace(req.Name))
+	if err := cc.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	exists, err := cc.hasCollectionNamed(userID, req.Name, *collectionID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+	if exists {
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "You already have a collection with this name", nil)
+	}
+
+	collection, err := cc.db.FindCollectionById(*collectionID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+
+	collection.Name = req.Name
+	updated, err := cc.db.UpdateCollection(*collection)
+	if errors.Is(err, database.ErrCollectionNameTaken) {
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "You already have a collection with this name", nil)
+	}
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to rename collection", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":    "Collection renamed successfully",
+		"status":     fiber.StatusOK,
+		"collection": updated,
+	})
+}
+
+func (cc *CollectionController) DeleteCollection(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	if c.Params("ID") == AllPostsCollection {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "The All posts collection cannot be deleted", nil)
+	}
+
+	collectionID, status, err := cc.resolveCollection(c, userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, status, "Failed to find collection", err.Error())
+	}
+
+	if err := cc.db.DeleteCollection(*collectionID); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete collection", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Collection deleted, its posts are still in All posts",
+		"status":  fiber.StatusOK,
+	})
+}
+
+func (cc *CollectionController) ListCollectionPosts(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	collectionID, status, err := cc.resolveCollection(c, userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, status, "Failed to find collection", err.Error())
+	}
+
+	limit, offset := utils.ParsePagination(c)
+	posts, total, err := cc.db.FindSavedPosts(userID, collectionID, limit, offset)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to load saved posts", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": fiber.StatusOK,
+		"posts":  posts,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+type MoveSavedPostsRequest struct {
+	PostIDs []uint `json:"post_ids" validate:"required,min=1,max=100"`
+}
+
+// MoveSavedPosts moves saved posts into the collection in the route. Moving
+// them to "all" takes them out of their current collection.
+func (cc *CollectionController) MoveSavedPosts(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	collectionID, status, err := cc.resolveCollection(c, userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, status, "Failed to find collection", err.Error())
+	}
+
+	var req MoveSavedPostsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+
+	if err := cc.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	moved, err := cc.db.MoveSavedPosts(userID, req.PostIDs, collectionID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to move saved posts", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Saved posts moved successfully",
+		"status":  fiber.StatusOK,
+		"moved":   moved,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Collections logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// Insights returns aggregated activity on the user's own posts. Saves are
+// only ever reported here as counts, never as individual notifications.
+func (cc *CollectionController) Insights(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	saves, total, err := cc.db.FindPostSaveInsights(userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to load insights", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": fiber.StatusOK,
+		"insights": fiber.Map{
+			string(models.NotifTypePostSave): fiber.Map{
+				"total": total,
+				"posts": saves,
+			},
+		},
+	})
+}
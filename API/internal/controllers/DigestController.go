@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"API/internal/database"
+	"API/internal/utils"
+	"bytes"
+	"html/template"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type DigestController struct {
+	db database.Service // The database service to interact with the database.
+}
+
+func NewDigestController(db database.Service) *DigestController {
+	return &DigestController{
+		db: db,
+	}
+}
+
+// unsubscribePage is what the unsubscribe link in the email opens. Opening
+// it changes nothing, mail scanners and link previews follow links too, the
+// form POSTs to Unsubscribe.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!doctype html>
+<html lang="en">
+    <head>
+        <meta charset="UTF-8">
+        <title>Weekly digest</title>
+    </head>
+    <body>
+        {{if .Done}}
+        <p>You will not receive the weekly digest anymore.</p>
+        {{else}}
+        <form method="post" action="{{.Action}}">
+            <p>Stop receiving the weekly digest?</p>
+            <input type="hidden" name="List-Unsubscribe" value="One-Click">
+            <button type="submit">Unsubscribe</button>
+        </form>
+        {{end}}
+    </body>
+</html>
+`))
+
+// verifiedUnsubscribe returns the user of a valid ?user= and ?sig= from
+// utils.SignUnsubscribe, or 0 after answering the request.
+func verifiedUnsubscribe(c *fiber.Ctx) (uint, error) {
+	userID := c.QueryInt("user", 0)
+	if userID <= 0 || !utils.VerifyUnsubscribe(uint(userID), c.Query("sig")) {
+		return 0, utils.SendErrorResponse(c, fiber.StatusBadRequest, "Unsubscribe link is invalid", nil)
+	}
+	return uint(userID), nil
+}
+
+func renderUnsubscribePage(c *fiber.Ctx, done bool) error {
+	var page bytes.Buffer
+	if err := unsubscribePage.Execute(&page, fiber.Map{"Action": c.OriginalURL(), "Done": done}); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to render page", err.Error())
+	}
+	c.Type("html", "utf-8")
+	return c.Status(fiber.StatusOK).Send(page.Bytes())
+}
+
+// ConfirmUnsubscribe is the link in the email, asking to confirm.
+func (dc *DigestController) ConfirmUnsubscribe(c *fiber.Ctx) error {
+	if userID, response := verifiedUnsubscribe(c); userID == 0 {
+		return response
+	}
+	return renderUnsubscribePage(c, false)
+}
+
+// Unsubscribe turns the weekly digest off without logging in, from the form
+// of ConfirmUnsubscribe or the one-click unsubscribe of mail clients
+// (RFC 8058), which POST to the same signed URL.
+func (dc *DigestController) Unsubscribe(c *fiber.Ctx) error {
+	userID, response := verifiedUnsubscribe(c)
+	if userID == 0 {
+		return response
+	}
+
+	found, err := dc.db.UnsubscribeFromDigest(userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to unsubscribe", err.Error())
+	}
+	if !found {
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "User not found", nil)
+	}
+
+	// Browsers get a page back, mail clients the JSON
+	if c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextHTML) == fiber.MIMETextHTML {
+		return renderUnsubscribePage(c, true)
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "You will not receive the weekly digest anymore",
+		"status":  fiber.StatusOK,
+	})
+}
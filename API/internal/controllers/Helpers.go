@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/media"
+	"API/internal/middleware"
+	"API/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// currentUserID returns the ID of the user authenticated by AuthRequired.
+func currentUserID(c *fiber.Ctx) (uint, bool) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return 0, false
+	}
+	return principal.UserID, true
+}
+
+// parseIDParam reads a numeric route parameter such as :ID.
+func parseIDParam(c *fiber.Ctx, name string) (uint, error) {
+	id, err := strconv.ParseUint(c.Params(name), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(id), nil
+}
+
+// uploadErrorResponse answers a failed upload: the client's fault for files
+// the image pipeline cannot take, a server error otherwise.
+func uploadErrorResponse(c *fiber.Ctx, err error) error {
+	if errors.Is(err, media.ErrUnsupportedImage) || errors.Is(err, media.ErrImageTooLarge) {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid image", err.Error())
+	}
+	if errors.Is(err, errBlockedImage) {
+		return utils.SendErrorResponse(c, fiber.StatusUnprocessableEntity, "This image cannot be uploaded", nil)
+	}
+	return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to upload image", err.Error())
+}
+
+// storeVideoUpload keeps the original of an uploaded video in the store for
+// its MediaJob. The file must have passed utils.ValidateVideoFile.
+func storeVideoUpload(ctx context.Context, db database.Service, store media.MediaStore, userID uint, file *multipart.FileHeader) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	key := media.NewKey("originals", file.Filename)
+	object, err := store.Put(ctx, key, src, file.Size, media.ContentTypeOf(key))
+	if err != nil {
+		return "", err
+	}
+	original := media.StoredVariant{Key: key, URL: object.URL, Size: object.Size}
+	if err := recordAssets(ctx, db, store, models.MediaAsset{UserID: &userID}, original); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// errBlockedImage is returned by storeImage for an image on the blocklist.
+var errBlockedImage = errors.New("this image cannot be uploaded")
+
+// storeImage stores a processed image for userID, 0 while registering. It is
+// refused if it matches a blocklist entry that rejects, and queued for the
+// moderators if it matches one that asks for review. Variants already
+// stored with the same content are shared instead of stored again.
+func storeImage(ctx context.Context, db database.Service, store media.MediaStore, userID uint, folder string, processed *media.ProcessedImage) (map[string]media.StoredVariant, error) {
+	hash := int64(processed.DHash)
+	match, err := db.MatchBlockedImage(hash)
+	if err != nil {
+		return nil, err
+	}
+	if match != nil && match.Action == models.BlockActionReject {
+		return nil, errBlockedImage
+	}
+
+	stored, err := media.StoreImage(ctx, store, db, folder, processed)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := models.MediaAsset{DHash: &hash}
+	if userID != 0 {
+		owner.UserID = &userID
+	}
+	if match != nil {
+		owner.ReviewMatch = &match.ID
+	}
+
+	files := make([]media.StoredVariant, 0, len(stored))
+	for _, variant := range stored {
+		files = append(files, variant)
+	}
+	if err := recordAssets(ctx, db, store, owner, files...); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// recordAssets registers freshly stored files as media assets, so the
+// garbage collector can remove them if nothing ends up using them. owner
+// carries what the files have in common, like who stored them. If recording
+// fails the files are deleted right away instead, reused ones excepted.
+// Once recorded, only the garbage collector deletes them.
+func recordAssets(ctx context.Context, db database.Service, store media.MediaStore, owner models.MediaAsset, files ...media.StoredVariant) error {
+	assets := make([]models.MediaAsset, 0, len(files))
+	for _, file := range files {
+		asset := owner
+		asset.Key = file.Key
+		asset.URL = file.URL
+		asset.ContentType = media.ContentTypeOf(file.Key)
+		asset.Size = file.Size
+		asset.SHA256 = file.SHA256
+		assets = append(assets, asset)
+	}
+
+	if err := db.RecordMediaAssets(assets); err != nil {
+		for _, file := range files {
+			if file.Reused {
+				continue
+			}
+			if err := store.Delete(ctx, file.Key); err != nil {
+				log.Printf("Error deleting unrecorded %s: %v", file.Key, err)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// consumeUpload claims a finished resumable upload of the user for a new
+// post or story, after which the stored file belongs to that. On failure it
+// has already written the response.
+func consumeUpload(c *fiber.Ctx, db database.Service, userID uint, uploadID string) (*models.UploadSession, error) {
+	upload, err := db.FindUploadSession(uploadID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+	if upload == nil || upload.UserID != userID || time.Now().After(upload.ExpiresAt) {
+		return nil, utils.SendErrorResponse(c, fiber.StatusNotFound, "Upload not found", nil)
+	}
+	if !upload.IsComplete() {
+		return nil, utils.SendErrorResponse(c, fiber.StatusConflict, "Upload is not finished yet", fiber.Map{
+			"offset": upload.Offset,
+			"size":   upload.Size,
+		})
+	}
+
+	consumed, err := db.ConsumeUploadSession(upload.ID)
+	if err != nil {
+		return nil, utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+	if !consumed {
+		return nil, utils.SendErrorResponse(c, fiber.StatusConflict, "Upload has already been used", nil)
+	}
+	return upload, nil
+}
+
+// mediaJobResponse is what the client polls while its video is processing.
+func mediaJobResponse(job *models.MediaJob) fiber.Map {
+	return fiber.Map{
+		"id":          job.ID,
+		"status":      job.Status,
+		"target_type": job.TargetType,
+		"target_id":   job.TargetID,
+		"attempts":    job.Attempts,
+		"error":       job.Error,
+		"created_at":  job.CreatedAt,
+		"finished_at": job.FinishedAt,
+		"status_url":  fmt.Sprintf("/api/v1/media-jobs/%d", job.ID),
+	}
+}
+
+// findUserByIdentifier resolves what was typed in the login form or the admin
+// user search: an email if it has an @, a phone number if it starts with + or
+// 00, otherwise a username.
+func findUserByIdentifier(db database.Service, identifier string) (*models.User, error) {
+	identifier = strings.TrimSpace(identifier)
+
+	switch {
+	case strings.Contains(identifier, "@"):
+		return db.FindUserByEmail(html.EscapeString(identifier))
+	case utils.LooksLikePhone(identifier):
+		phone, err := utils.NormalizePhone(identifier)
+		if err != nil {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return db.FindUserByPhone(phone)
+	default:
+		return db.FindUserByUsername(html.EscapeString(strings.TrimPrefix(identifier, "@")))
+	}
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"API/internal/database"
+	"API/internal/utils"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type MediaJobController struct {
+	db database.Service // The database service to interact with the database.
+}
+
+func NewMediaJobController(db database.Service) *MediaJobController {
+	return &MediaJobController{
+		db: db,
+	}
+}
+
+// GetMediaJob tells the owner how far processing of their video has come.
+// Someone else's job is reported as not found, not as forbidden, so job IDs
+// reveal nothing.
+func (mc *MediaJobController) GetMediaJob(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	jobID, err := parseIDParam(c, "ID")
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid job ID", err.Error())
+	}
+
+	job, err := mc.db.FindMediaJobById(jobID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+	if job == nil || job.UserID != userID {
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Job not found", nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": fiber.StatusOK,
+		"job":    mediaJobResponse(job),
+	})
+}
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/mail"
+	"API/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"math/rand/v2"
+
+	"github.com/go-playground/validator"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type OIDCController struct {
+	db       database.Service    // The database service to interact with the database.
+	emails   *mail.Emails        // New device login alerts.
+	validate *validator.Validate // Validator instance for validating user inputs.
+}
+
+func NewOIDCController(db database.Service, emails *mail.Emails) *OIDCController {
+	return &OIDCController{
+		db:       db,
+		emails:   emails,
+		validate: utils.NewValidator(),
+	}
+}
+
+// errEmailNotShared is returned when a new account cannot be created because
+// the provider did not tell us the user's email.
+var errEmailNotShared = errors.New("the provider did not share an email address")
+
+// errUnverifiedAccount is returned when the email belongs to a local account
+// that never verified it. Linking would hand that account, and whoever set its
+// password, to the person signing in with the provider.
+var errUnverifiedAccount = errors.New("an account with this email exists but its email was never verified")
+
+// uniqueUsername finds a free username, adding random digits to the
+// candidate when it is taken.
+func (oc *OIDCController) uniqueUsername(candidate string) (string, error) {
+	username := candidate
+	for attempts := 0; attempts < 10; attempts++ {
+		_, err := oc.db.FindUserByUsername(username)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return username, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		username = fmt.Sprintf("%s%04d", candidate, rand.IntN(10000))
+	}
+	return "", errors.New("could not find a free username")
+}
+
+// resolveUser returns the account for a provider identity: the one already
+// linked to it, an existing account with the same verified email (which gets
+// linked), or a brand new account.
+func (oc *OIDCController) resolveUser(provider string, identity *utils.OIDCIdentity) (*models.User, error) {
+	linked, err := oc.db.FindUserIdentity(provider, identity.Subject)
+	if err == nil {
+		return oc.db.FindUserById(linked.UserID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	link := models.UserIdentity{Provider: provider, Subject: identity.Subject, Email: identity.Email}
+
+	if identity.Email == "" {
+		return nil, errEmailNotShared
+	}
+
+	existing, err := oc.db.FindUserByEmail(identity.Email)
+	if err == nil {
+		if !identity.EmailVerified || !existing.EmailVerified {
+			return nil, errUnverifiedAccount
+		}
+		link.UserID = existing.ID
+		if _, err := oc.db.CreateUserIdentity(link); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	username, err := oc.uniqueUsername(utils.UsernameCandidate(identity))
+	if err != nil {
+		return nil, err
+	}
+
+	// There is no password, the account can only be used through the
+	// provider until the user sets one with a password reset
+	token, err := utils.GenerateVerificationToken()
+	if err != nil {
+		return nil, err
+	}
+
+	name := identity.Name
+	if name == "" {
+		name = username
+	}
+	avatar := identity.Picture
+	if avatar == "" || len(avatar) > 255 {
+		avatar = utils.GetDefaultAvatar()
+	}
+
+	return oc.db.CreateUserWithIdentity(models.User{
+		Username:      username,
+		Name:          html.EscapeString(name),
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		Avatar:        avatar,
+		Token:         token,
+		Language:      "en",
+	}, link)
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Social Login logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// Start redirects to the provider's sign in page.
+func (oc *OIDCController) Start(c *fiber.Ctx) error {
+	name := c.Params("provider")
+	provider, ok := utils.OIDCProviders[name]
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Unknown login provider", nil)
+	}
+
+	state, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to start login", err.Error())
+	}
+	verifier, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to start login", err.Error())
+	}
+	nonce, err := utils.GenerateSecureToken(16)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to start login", err.Error())
+	}
+
+	if err := utils.StoreOAuthState(context.Background(), state, utils.OAuthState{
+		Provider: name,
+		Verifier: verifier,
+		Nonce:    nonce,
+	}); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Failed to start login", err.Error())
+	}
+
+	return c.Redirect(provider.AuthCodeURL(state, verifier, nonce), fiber.StatusFound)
+}
+
+// Callback is where the provider sends the user back with an authorization code.
+func (oc *OIDCController) Callback(c *fiber.Ctx) error {
+	name := c.Params("provider")
+	provider, ok := utils.OIDCProviders[name]
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Unknown login provider", nil)
+	}
+
+	if providerError := c.Query("error"); providerError != "" {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Login was cancelled or refused", providerError)
+	}
+
+	ctx := context.Background()
+	state, err := utils.TakeOAuthState(ctx, c.Query("state"))
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Please try again later", err.Error())
+	}
+	if state == nil || state.Provider != name {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Login expired or was already used, please try again", nil)
+	}
+
+	identity, err := provider.Exchange(ctx, c.Query("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Could not verify the login with the provider", err.Error())
+	}
+
+	user, err := oc.resolveUser(name, identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, errEmailNotShared):
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Please allow access to your email address to sign up", nil)
+		case errors.Is(err, errUnverifiedAccount):
+			return utils.SendErrorResponse(c, fiber.StatusConflict, "An account with this email already exists, sign in with your password and verify your email first", nil)
+		default:
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to sign in", err.Error())
+		}
+	}
+
+	return respondWithLogin(oc.db, oc.emails, user, c)
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Social Login logic -------------------------
+// --------------------------------------------------------------------------------------------------
@@ -0,0 +1,328 @@
+package controllers
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/mail"
+	"API/internal/utils"
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	"github.com/go-playground/validator"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofiber/fiber/v2"
+)
+
+type PasskeyController struct {
+	db       database.Service    // The database service to interact with the database.
+	emails   *mail.Emails        // New device login alerts.
+	validate *validator.Validate // Validator instance for validating user inputs.
+}
+
+func NewPasskeyController(db database.Service, emails *mail.Emails) *PasskeyController {
+	return &PasskeyController{
+		db:       db,
+		emails:   emails,
+		validate: utils.NewValidator(),
+	}
+}
+
+// loadPasskeyUser returns the user with their passkeys, as the webauthn
+// library needs them.
+func (pc *PasskeyController) loadPasskeyUser(userID uint) (utils.PasskeyUser, error) {
+	user, err := pc.db.FindUserById(userID)
+	if err != nil {
+		return utils.PasskeyUser{}, err
+	}
+
+	passkeys, err := pc.db.FindPasskeysByUser(userID)
+	if err != nil {
+		return utils.PasskeyUser{}, err
+	}
+
+	return utils.PasskeyUser{User: user, Passkeys: passkeys}, nil
+}
+
+// findOwnPasskey loads the :ID passkey, making sure it belongs to the caller.
+// On failure the error response has already been written.
+func (pc *PasskeyController) findOwnPasskey(c *fiber.Ctx) (*models.Passkey, error) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	passkeyID, err := parseIDParam(c, "ID")
+	if err != nil {
+		return nil, utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid passkey ID", err.Error())
+	}
+
+	passkey, err := pc.db.FindPasskeyById(passkeyID)
+	if err != nil || passkey.UserID != userID {
+		return nil, utils.SendErrorResponse(c, fiber.StatusNotFound, "Passkey not found", nil)
+	}
+	return passkey, nil
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Passkey Registration logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// BeginRegistration returns the options for navigator.credentials.create().
+func (pc *PasskeyController) BeginRegistration(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	user, err := pc.loadPasskeyUser(userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+
+	creation, session, err := utils.WebAuthn.BeginRegistration(user, utils.PasskeyRegistrationOptions(user)...)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to start passkey registration", err.Error())
+	}
+
+	if err := utils.StoreWebAuthnSession(context.Background(), fmt.Sprintf("register:%d", userID), session); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Failed to start passkey registration", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  fiber.StatusOK,
+		"options": creation,
+	})
+}
+
+// FinishRegistration verifies the authenticator's response and stores the
+// new passkey. The body is the PublicKeyCredential from the browser; the
+// passkey's name can be set with ?name=.
+func (pc *PasskeyController) FinishRegistration(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		name = utils.DescribeDevice(c.Get(fiber.HeaderUserAgent))
+	}
+	if len(name) > 64 {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{"Name": "Name is too long"})
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(c.Body())
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid passkey response", err.Error())
+	}
+
+	session, err := utils.TakeWebAuthnSession(context.Background(), fmt.Sprintf("register:%d", userID))
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Failed to load passkey registration", err.Error())
+	}
+	if session == nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Passkey registration expired, please start again", nil)
+	}
+
+	user, err := pc.loadPasskeyUser(userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+
+	credential, err := utils.WebAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Passkey verification failed", err.Error())
+	}
+
+	if _, err := pc.db.FindPasskeyByCredentialID(credential.ID); err == nil {
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "This passkey is already registered", nil)
+	}
+
+	encoded, err := utils.EncodePasskeyCredential(credential)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to store passkey", err.Error())
+	}
+
+	passkey, err := pc.db.CreatePasskey(models.Passkey{
+		UserID:       userID,
+		Name:         html.EscapeString(name),
+		CredentialID: credential.ID,
+		Credential:   encoded,
+	})
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to store passkey", err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Passkey added",
+		"status":  fiber.StatusCreated,
+		"passkey": passkey,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Passkey Registration logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Passkey Login logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// BeginLogin returns the options for navigator.credentials.get(). No username
+// is needed, the authenticator offers the passkeys it holds for this site.
+func (pc *PasskeyController) BeginLogin(c *fiber.Ctx) error {
+	assertion, session, err := utils.WebAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to start passkey login", err.Error())
+	}
+
+	// The challenge comes back inside the signed client data, so it doubles as the key
+	if err := utils.StoreWebAuthnSession(context.Background(), "login:"+session.Challenge, session); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Failed to start passkey login", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  fiber.StatusOK,
+		"options": assertion,
+	})
+}
+
+// FinishLogin verifies the signed assertion and starts a session. A passkey
+// with user verification is already two factors, so no TOTP challenge follows.
+func (pc *PasskeyController) FinishLogin(c *fiber.Ctx) error {
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(c.Body())
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid passkey response", err.Error())
+	}
+
+	session, err := utils.TakeWebAuthnSession(context.Background(), "login:"+parsed.Response.CollectedClientData.Challenge)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Failed to load passkey login", err.Error())
+	}
+	if session == nil {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Passkey login expired, please try again", nil)
+	}
+
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := utils.ParsePasskeyUserHandle(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		return pc.loadPasskeyUser(userID)
+	}
+
+	found, credential, err := utils.WebAuthn.ValidatePasskeyLogin(handler, *session, parsed)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Passkey login failed", nil)
+	}
+	user := found.(utils.PasskeyUser).User
+
+	if passkey, err := pc.db.FindPasskeyByCredentialID(credential.ID); err == nil {
+		if encoded, err := utils.EncodePasskeyCredential(credential); err == nil {
+			if err := pc.db.UpdatePasskeyCredential(passkey.ID, encoded); err != nil {
+				log.Printf("Error updating passkey %d after login: %v", passkey.ID, err)
+			}
+		}
+	}
+
+	if banned, response := rejectBanned(c, user); banned {
+		return response
+	}
+
+	JWT, refreshToken, err := startSession(pc.db, pc.emails, user, c)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to generate JWT token", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"detail":        "User have been verify successfully",
+		"status":        fiber.StatusOK,
+		"JWT":           JWT,
+		"refresh_token": refreshToken,
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
+		"user": fiber.Map{
+			"User": user,
+		},
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Passkey Login logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Manage Passkeys logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+func (pc *PasskeyController) ListPasskeys(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	passkeys, err := pc.db.FindPasskeysByUser(userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to load passkeys", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":   fiber.StatusOK,
+		"passkeys": passkeys,
+	})
+}
+
+type RenamePasskeyRequest struct {
+	Name string `json:"name" validate:"required,max=64"`
+}
+
+func (pc *PasskeyController) RenamePasskey(c *fiber.Ctx) error {
+	var req RenamePasskeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+
+	if err := pc.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	passkey, err := pc.findOwnPasskey(c)
+	if passkey == nil {
+		return err
+	}
+
+	name := html.EscapeString(strings.TrimSpace(req.Name))
+	if err := pc.db.RenamePasskey(passkey.ID, name); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to rename passkey", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Passkey renamed",
+		"status":  fiber.StatusOK,
+	})
+}
+
+func (pc *PasskeyController) DeletePasskey(c *fiber.Ctx) error {
+	passkey, err := pc.findOwnPasskey(c)
+	if passkey == nil {
+		return err
+	}
+
+	if err := pc.db.DeletePasskey(passkey.ID); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete passkey", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Passkey deleted",
+		"status":  fiber.StatusOK,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Manage Passkeys logic -------------------------
+// --------------------------------------------------------------------------------------------------
@@ -0,0 +1,435 @@
+package controllers
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/media"
+	"API/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"math"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type PostController struct {
+	db       database.Service    // The database service to interact with the database.
+	media    media.MediaStore    // Where post photos and videos are stored.
+	validate *validator.Validate // Validator instance for validating user inputs.
+}
+
+func NewPostController(db database.Service, store media.MediaStore) *PostController {
+	return &PostController{
+		db:       db,
+		media:    store,
+		validate: utils.NewValidator(),
+	}
+}
+
+// findOwnPost loads the post in the :ID route param and makes sure it belongs
+// to the authenticated user. On failure it has already written the response.
+func (pc *PostController) findOwnPost(c *fiber.Ctx, trashed bool) (*models.Post, error) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	postID, err := parseIDParam(c, "ID")
+	if err != nil {
+		return nil, utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid post ID", err.Error())
+	}
+
+	var post *models.Post
+	if trashed {
+		post, err = pc.db.FindTrashedPostById(postID)
+	} else {
+		post, err = pc.db.FindPostById(postID)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.SendErrorResponse(c, fiber.StatusNotFound, "Post not found", nil)
+		}
+		return nil, utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+
+	if post.UserID != userID {
+		return nil, utils.SendErrorResponse(c, fiber.StatusForbidden, "You are not authorized to manage this post", nil)
+	}
+
+	return post, nil
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Create Post logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+type CreatePostRequest struct {
+	Caption  string `form:"caption" validate:"max=2200"`
+	Location string `form:"location" validate:"max=255"`
+	Filter   string `form:"filter" validate:"max=50"`
+	UploadID string `form:"upload_id" validate:"omitempty,uuid"` // A finished resumable upload instead of "media"
+}
+
+// storePostImage runs one upload through the image pipeline and stores the
+// variants. If the post is not saved after all, the garbage collector
+// removes them.
+func (pc *PostController) storePostImage(ctx context.Context, userID uint, src io.Reader, position int) (*models.PostMedia, error) {
+	processed, err := media.ProcessImage(src, media.PostImageVariants)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := storeImage(ctx, pc.db, pc.media, userID, "posts", processed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.PostMedia{
+		Position:     position,
+		MediaType:    models.MediaTypeImage,
+		URL:          stored["full"].URL,
+		MediumURL:    stored["medium"].URL,
+		ThumbnailURL: stored["thumbnail"].URL,
+		Width:        processed.Width,
+		Height:       processed.Height,
+		BlurHash:     processed.BlurHash,
+	}, nil
+}
+
+// CreatePost publishes a photo, or a carousel when several files are sent in
+// the "media" field. Photos are resized and stripped of EXIF data on the way.
+// A single video is accepted too, see createVideoPost. Large files are sent
+// through a resumable upload first and referenced by upload_id.
+func (pc *PostController) CreatePost(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	var req CreatePostRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+
+	if err := pc.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	post := models.Post{
+		UserID:   userID,
+		Caption:  html.EscapeString(req.Caption),
+		Location: html.EscapeString(req.Location),
+		Filter:   html.EscapeString(req.Filter),
+		PostType: "photo",
+	}
+
+	if req.UploadID != "" {
+		return pc.createPostFromUpload(c, post, req.UploadID)
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+	files := form.File["media"]
+	if len(files) == 0 || len(files) > models.MaxPostMedia {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{
+			"media": fmt.Sprintf("Between 1 and %d photos are required", models.MaxPostMedia),
+		})
+	}
+	if len(files) > 1 {
+		post.PostType = "carousel"
+	}
+
+	for _, file := range files {
+		if !utils.IsVideoFilename(file.Filename) {
+			continue
+		}
+		if len(files) > 1 {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{
+				"media": "A video has to be posted on its own",
+			})
+		}
+		if err := utils.ValidateVideoFile(file); err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid video", err.Error())
+		}
+		sourceKey, err := storeVideoUpload(context.Background(), pc.db, pc.media, post.UserID, file)
+		if err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to upload video", err.Error())
+		}
+		return pc.createVideoPost(c, post, sourceKey)
+	}
+
+	ctx := context.Background()
+	for position, file := range files {
+		src, err := file.Open()
+		if err != nil {
+			return uploadErrorResponse(c, err)
+		}
+		item, err := pc.storePostImage(ctx, post.UserID, src, position)
+		src.Close()
+		if err != nil {
+			return uploadErrorResponse(c, err)
+		}
+		post.Media = append(post.Media, *item)
+		post.MediaURLs = append(post.MediaURLs, item.URL)
+	}
+
+	return pc.createPhotoPost(c, post)
+}
+
+// createPhotoPost saves a post whose photos are already stored.
+func (pc *PostController) createPhotoPost(c *fiber.Ctx, post models.Post) error {
+	// The whole post is shown in the first photo's shape, within the feed's limits
+	first := post.Media[0]
+	post.AspectRatio = math.Min(math.Max(float64(first.Width)/float64(first.Height), models.MinAspectRatio), models.MaxAspectRatio)
+
+	created, err := pc.db.CreatePost(post)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create post", err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Post created successfully",
+		"status":  fiber.StatusCreated,
+		"post":    created,
+	})
+}
+
+// createPostFromUpload publishes the photo or video of a finished resumable
+// upload. A photo goes through the image pipeline from the store and its
+// original is removed afterwards, a video original is kept for its MediaJob.
+func (pc *PostController) createPostFromUpload(c *fiber.Ctx, post models.Post, uploadID string) error {
+	upload, err := consumeUpload(c, pc.db, post.UserID, uploadID)
+	if upload == nil {
+		return err
+	}
+
+	if utils.IsVideoFilename(upload.Filename) {
+		return pc.createVideoPost(c, post, upload.MediaKey)
+	}
+
+	ctx := context.Background()
+	deleteOriginal := func() {
+		if err := pc.media.Delete(ctx, upload.MediaKey); err != nil {
+			log.Printf("Error deleting the original of upload %s: %v", upload.UploadID, err)
+		}
+	}
+	defer deleteOriginal()
+
+	src, err := pc.media.Open(ctx, upload.MediaKey)
+	if err != nil {
+		return uploadErrorResponse(c, err)
+	}
+	item, err := pc.storePostImage(ctx, post.UserID, src, 0)
+	src.Close()
+	if err != nil {
+		return uploadErrorResponse(c, err)
+	}
+	post.Media = []models.PostMedia{*item}
+	post.MediaURLs = []string{item.URL}
+
+	return pc.createPhotoPost(c, post)
+}
+
+// createVideoPost answers right away with the post's MediaJob, the original
+// is already stored under sourceKey. The post stays "processing" until the
+// job has probed, transcoded and grabbed a poster frame of the video, the
+// client polls the job or waits for the media_ready notification.
+func (pc *PostController) createVideoPost(c *fiber.Ctx, post models.Post, sourceKey string) error {
+	post.PostType = "video"
+	post.Status = models.MediaProcessing
+	post.Media = []models.PostMedia{{Position: 0, MediaType: models.MediaTypeVideo}}
+
+	created, job, err := pc.db.CreatePostWithMediaJob(post, models.MediaJob{UserID: post.UserID, SourceKey: sourceKey})
+	if err != nil {
+		if err := pc.media.Delete(context.Background(), sourceKey); err != nil {
+			log.Printf("Error deleting %s after a failed post: %v", sourceKey, err)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create post", err.Error())
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Your video is being processed",
+		"status":  fiber.StatusAccepted,
+		"post":    created,
+		"job":     mediaJobResponse(job),
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Create Post logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Archive logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+func (pc *PostController) ArchivePost(c *fiber.Ctx) error {
+	post, err := pc.findOwnPost(c, false)
+	if post == nil {
+		return err
+	}
+
+	if err := pc.db.SetPostArchived(post.ID, true); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to archive post", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Post archived successfully",
+		"status":   fiber.StatusOK,
+		"archived": true,
+	})
+}
+
+func (pc *PostController) UnarchivePost(c *fiber.Ctx) error {
+	post, err := pc.findOwnPost(c, false)
+	if post == nil {
+		return err
+	}
+
+	if err := pc.db.SetPostArchived(post.ID, false); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to unarchive post", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Post is back on your profile",
+		"status":   fiber.StatusOK,
+		"archived": false,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Archive logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Pin logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+func (pc *PostController) PinPost(c *fiber.Ctx) error {
+	post, err := pc.findOwnPost(c, false)
+	if post == nil {
+		return err
+	}
+
+	if post.IsArchived {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Archived posts cannot be pinned", nil)
+	}
+
+	if err := pc.db.PinPost(post.UserID, post.ID); err != nil {
+		if errors.Is(err, database.ErrPinLimitReached) {
+			return utils.SendErrorResponse(c, fiber.StatusConflict, "You can only pin up to 3 posts", fiber.Map{
+				"max_pinned": models.MaxPinnedPosts,
+			})
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to pin post", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Post pinned to your profile",
+		"status":  fiber.StatusOK,
+		"pinned":  true,
+	})
+}
+
+func (pc *PostController) UnpinPost(c *fiber.Ctx) error {
+	post, err := pc.findOwnPost(c, false)
+	if post == nil {
+		return err
+	}
+
+	if err := pc.db.UnpinPost(post.ID); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to unpin post", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Post unpinned",
+		"status":  fiber.StatusOK,
+		"pinned":  false,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Pin logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Recently Deleted logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// DeletePost moves a post to "recently deleted", where it can be restored for
+// models.TrashRetention before the purge job removes it for good.
+func (pc *PostController) DeletePost(c *fiber.Ctx) error {
+	post, err := pc.findOwnPost(c, false)
+	if post == nil {
+		return err
+	}
+
+	if err := pc.db.TrashPost(*post); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete post", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":    "Post moved to recently deleted",
+		"status":     fiber.StatusOK,
+		"expires_at": time.Now().Add(models.TrashRetention),
+	})
+}
+
+func (pc *PostController) ListTrashedPosts(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	posts, err := pc.db.FindTrashedPosts(userID, time.Now().Add(-models.TrashRetention))
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to load recently deleted posts", err.Error())
+	}
+
+	trashed := make([]fiber.Map, 0, len(posts))
+	for _, post := range posts {
+		trashed = append(trashed, fiber.Map{
+			"post":       post,
+			"deleted_at": post.DeletedAt.Time,
+			"expires_at": post.DeletedAt.Time.Add(models.TrashRetention),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": fiber.StatusOK,
+		"posts":  trashed,
+	})
+}
+
+func (pc *PostController) RestorePost(c *fiber.Ctx) error {
+	post, err := pc.findOwnPost(c, true)
+	if post == nil {
+		return err
+	}
+
+	if time.Since(post.DeletedAt.Time) > models.TrashRetention {
+		return utils.SendErrorResponse(c, fiber.StatusGone, "This post can no longer be restored", nil)
+	}
+
+	if err := pc.db.RestorePost(*post); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to restore post", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Post restored successfully",
+		"status":  fiber.StatusOK,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Recently Deleted logic -------------------------
+// --------------------------------------------------------------------------------------------------
@@ -0,0 +1,401 @@
+package controllers
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/mail"
+	"API/internal/middleware"
+	"API/internal/utils"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type SessionController struct {
+	db       database.Service    // The database service to interact with the database.
+	validate *validator.Validate // Validator instance for validating user inputs.
+}
+
+func NewSessionController(db database.Service) *SessionController {
+	return &SessionController{
+		db:       db,
+		validate: utils.NewValidator(),
+	}
+}
+
+// newRefreshToken generates a refresh token for the family. The raw value goes
+// to the client, only its hash is stored.
+func newRefreshToken(userID uint, familyID string) (string, models.RefreshToken, error) {
+	raw, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", models.RefreshToken{}, err
+	}
+
+	return raw, models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(raw),
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL),
+	}, nil
+}
+
+// deviceIDHeader carries an ID the client generates once and keeps, so a
+// device is recognized across browser updates and networks.
+const deviceIDHeader = "X-Device-ID"
+
+// deviceHash hashes the device ID of the request. Clients without one are
+// handed a new ID in the response.
+func deviceHash(c *fiber.Ctx) string {
+	deviceID, err := uuid.Parse(c.Get(deviceIDHeader))
+	if err != nil {
+		deviceID = uuid.New()
+		c.Set(deviceIDHeader, deviceID.String())
+	}
+	return utils.HashToken(deviceID.String())
+}
+
+// startSession records a new session for the device making the request,
+// starts its refresh token family and returns the access and refresh tokens.
+// Logging in from a device the user never used before triggers an email.
+func startSession(db database.Service, emails *mail.Emails, user *models.User, c *fiber.Ctx) (string, string, error) {
+	familyID := uuid.NewString()
+
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+
+	session := models.Session{
+		UserID:     user.ID,
+		FamilyID:   familyID,
+		Device:     utils.DescribeDevice(userAgent),
+		DeviceHash: deviceHash(c),
+		UserAgent:  userAgent,
+		IP:         c.IP(),
+		Location:   utils.LocateIP(c.IP()),
+	}
+
+	known, err := db.IsKnownDevice(session)
+	if err != nil {
+		return "", "", err
+	}
+
+	var alert *models.OutboxMessage
+	if !known {
+		msg, err := emails.NewDeviceLogin(mail.To(user), session.Device, session.Location, session.IP, time.Now()).Outbox(user.ID)
+		if err != nil {
+			return "", "", err
+		}
+		alert = &msg
+	}
+
+	if _, err := db.CreateSession(session, alert); err != nil {
+		return "", "", err
+	}
+
+	refreshToken, token, err := newRefreshToken(user.ID, familyID)
+	if err != nil {
+		return "", "", err
+	}
+
+	if _, err := db.CreateRefreshToken(token); err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := utils.GenerateToken(user, familyID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// respondWithLogin finishes a first-factor login (password or social). With
+// 2FA on it only hands out a challenge for /auth/2fa/verify, otherwise it
+// starts the session right away.
+func respondWithLogin(db database.Service, emails *mail.Emails, user *models.User, c *fiber.Ctx) error {
+	if banned, response := rejectBanned(c, user); banned {
+		return response
+	}
+
+	if user.TwoFactorEnabled {
+		challenge, err := utils.CreateLoginChallenge(context.Background(), user.ID)
+		if err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Failed to start two-factor login", err.Error())
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"detail":              "Two-factor authentication required",
+			"status":              fiber.StatusOK,
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int(utils.LoginChallengeTTL.Seconds()),
+		})
+	}
+
+	JWT, refreshToken, err := startSession(db, emails, user, c)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to generate JWT token", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"detail":        "User have been verify successfully",
+		"status":        fiber.StatusOK,
+		"JWT":           JWT,
+		"refresh_token": refreshToken,
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
+		"user": fiber.Map{
+			"User": user,
+		},
+	})
+}
+
+// revokeSessions ends the given refresh token families in Postgres and blocks
+// their outstanding access tokens in Redis.
+func revokeSessions(db database.Service, familyIDs ...string) error {
+	for _, familyID := range familyIDs {
+		if err := db.RevokeRefreshTokenFamily(familyID); err != nil {
+			return err
+		}
+	}
+	return utils.RevokeSessions(context.Background(), familyIDs...)
+}
+
+// rejectBanned answers 403 when the user is banned or suspended. Every login
+// path checks it before calling startSession.
+func rejectBanned(c *fiber.Ctx, user *models.User) (bool, error) {
+	if !user.IsBanned(time.Now()) {
+		return false, nil
+	}
+	return true, utils.SendErrorResponse(c, fiber.StatusForbidden, "Account suspended", middleware.BanDetails(user))
+}
+
+// revokeAllSessions logs the user out everywhere.
+func revokeAllSessions(db database.Service, userID uint) error {
+	familyIDs, err := db.RevokeUserRefreshTokens(userID)
+	if err != nil {
+		return err
+	}
+	return utils.RevokeSessions(context.Background(), familyIDs...)
+}
+
+// revokeOtherSessions logs the user out everywhere but the session
+// keepFamilyID.
+func revokeOtherSessions(db database.Service, userID uint, keepFamilyID string) error {
+	familyIDs, err := db.RevokeOtherRefreshTokens(userID, keepFamilyID)
+	if err != nil {
+		return err
+	}
+	return utils.RevokeSessions(context.Background(), familyIDs...)
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Refresh Token logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required,max=255"`
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token pair.
+// Presenting a token that was already exchanged revokes its whole family.
+func (sc *SessionController) Refresh(c *fiber.Ctx) error {
+	var req RefreshRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+
+	if err := sc.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	token, err := sc.db.FindRefreshTokenByHash(utils.HashToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid refresh token", nil)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+
+	if token.RevokedAt != nil {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Session has been revoked", nil)
+	}
+
+	if token.UsedAt != nil {
+		if err := revokeSessions(sc.db, token.FamilyID); err != nil {
+			log.Printf("Error revoking reused refresh token family %s: %v", token.FamilyID, err)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Refresh token reuse detected, please log in again", nil)
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Refresh token expired", nil)
+	}
+
+	user, err := sc.db.FindUserById(token.UserID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid refresh token", nil)
+	}
+
+	refreshToken, next, err := newRefreshToken(user.ID, token.FamilyID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to generate refresh token", err.Error())
+	}
+
+	if _, err := sc.db.RotateRefreshToken(token.ID, next); err != nil {
+		if errors.Is(err, database.ErrRefreshTokenReused) {
+			if err := revokeSessions(sc.db, token.FamilyID); err != nil {
+				log.Printf("Error revoking reused refresh token family %s: %v", token.FamilyID, err)
+			}
+			return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Refresh token reuse detected, please log in again", nil)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to refresh session", err.Error())
+	}
+
+	if err := sc.db.TouchSession(token.FamilyID, c.IP()); err != nil {
+		log.Printf("Error updating session %s: %v", token.FamilyID, err)
+	}
+
+	JWT, err := utils.GenerateToken(user, token.FamilyID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to generate JWT token", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"detail":        "Token refreshed successfully",
+		"status":        fiber.StatusOK,
+		"JWT":           JWT,
+		"refresh_token": refreshToken,
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Refresh Token logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Logout logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// Logout ends the current session: its refresh tokens stop working and the
+// access token in use is denied right away.
+func (sc *SessionController) Logout(c *fiber.Ctx) error {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	if principal.SessionID != "" {
+		if err := revokeSessions(sc.db, principal.SessionID); err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to log out", err.Error())
+		}
+	}
+
+	if err := utils.RevokeAccessToken(context.Background(), principal.TokenID, principal.ExpiresAt); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to log out", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Logged out successfully",
+		"status":  fiber.StatusOK,
+	})
+}
+
+// LogoutAll ends every session of the user, on every device.
+func (sc *SessionController) LogoutAll(c *fiber.Ctx) error {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	if err := revokeAllSessions(sc.db, principal.UserID); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to log out everywhere", err.Error())
+	}
+
+	if err := utils.RevokeAccessToken(context.Background(), principal.TokenID, principal.ExpiresAt); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to log out everywhere", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Logged out of all sessions",
+		"status":  fiber.StatusOK,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Logout logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Sessions logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// ListSessions shows every device the user is currently logged in on.
+func (sc *SessionController) ListSessions(c *fiber.Ctx) error {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	sessions, err := sc.db.FindActiveSessions(principal.UserID, time.Now().Add(-utils.RefreshTokenTTL))
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to load sessions", err.Error())
+	}
+
+	result := make([]fiber.Map, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, fiber.Map{
+			"id":           session.ID,
+			"device":       session.Device,
+			"user_agent":   session.UserAgent,
+			"ip":           session.IP,
+			"location":     session.Location,
+			"created_at":   session.CreatedAt,
+			"last_used_at": session.LastUsedAt,
+			"current":      session.FamilyID == principal.SessionID,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":   fiber.StatusOK,
+		"sessions": result,
+	})
+}
+
+// RevokeSession logs a single device out.
+func (sc *SessionController) RevokeSession(c *fiber.Ctx) error {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	sessionID, err := parseIDParam(c, "ID")
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid session ID", err.Error())
+	}
+
+	session, err := sc.db.FindSessionById(sessionID)
+	if err != nil || session.UserID != principal.UserID {
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Session not found", nil)
+	}
+
+	if err := revokeSessions(sc.db, session.FamilyID); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to revoke session", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Session revoked successfully",
+		"status":  fiber.StatusOK,
+		"current": session.FamilyID == principal.SessionID,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Sessions logic -------------------------
+// --------------------------------------------------------------------------------------------------
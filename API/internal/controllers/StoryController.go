@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/media"
+	"API/internal/utils"
+	"context"
+	"io"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type StoryController struct {
+	db    database.Service // The database service to interact with the database.
+	media media.MediaStore // Where story photos and videos are stored.
+}
+
+func NewStoryController(db database.Service, store media.MediaStore) *StoryController {
+	return &StoryController{
+		db:    db,
+		media: store,
+	}
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Create Story logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// CreateStory publishes the photo or video sent in the "media" field, or the
+// finished resumable upload in upload_id. A photo is live right away, a
+// video is processed in the background like a video post and answered with
+// its MediaJob.
+func (sc *StoryController) CreateStory(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	ctx := context.Background()
+
+	if uploadID := c.FormValue("upload_id"); uploadID != "" {
+		upload, err := consumeUpload(c, sc.db, userID, uploadID)
+		if upload == nil {
+			return err
+		}
+		if utils.IsVideoFilename(upload.Filename) {
+			return sc.createVideoStory(c, userID, upload.MediaKey)
+		}
+
+		defer func() {
+			if err := sc.media.Delete(ctx, upload.MediaKey); err != nil {
+				log.Printf("Error deleting the original of upload %s: %v", upload.UploadID, err)
+			}
+		}()
+		src, err := sc.media.Open(ctx, upload.MediaKey)
+		if err != nil {
+			return uploadErrorResponse(c, err)
+		}
+		defer src.Close()
+		return sc.createPhotoStory(c, userID, src)
+	}
+
+	file, err := c.FormFile("media")
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{
+			"media": "A photo or video is required",
+		})
+	}
+
+	if utils.IsVideoFilename(file.Filename) {
+		if err := utils.ValidateVideoFile(file); err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid video", err.Error())
+		}
+		sourceKey, err := storeVideoUpload(ctx, sc.db, sc.media, userID, file)
+		if err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to upload video", err.Error())
+		}
+		return sc.createVideoStory(c, userID, sourceKey)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return uploadErrorResponse(c, err)
+	}
+	defer src.Close()
+	return sc.createPhotoStory(c, userID, src)
+}
+
+func (sc *StoryController) createPhotoStory(c *fiber.Ctx, userID uint, src io.Reader) error {
+	ctx := context.Background()
+
+	processed, err := media.ProcessImage(src, media.StoryImageVariants)
+	if err != nil {
+		return uploadErrorResponse(c, err)
+	}
+	stored, err := storeImage(ctx, sc.db, sc.media, userID, "stories", processed)
+	if err != nil {
+		return uploadErrorResponse(c, err)
+	}
+
+	created, err := sc.db.CreateStory(models.Story{UserID: userID, StoryType: "photo", MediaURL: stored["full"].URL})
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create story", err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Story created successfully",
+		"status":  fiber.StatusCreated,
+		"story":   created,
+	})
+}
+
+// createVideoStory answers right away with the story's MediaJob, the
+// original is already stored under sourceKey.
+func (sc *StoryController) createVideoStory(c *fiber.Ctx, userID uint, sourceKey string) error {
+	story := models.Story{UserID: userID, StoryType: "video", Status: models.MediaProcessing}
+	created, job, err := sc.db.CreateStoryWithMediaJob(story, models.MediaJob{UserID: userID, SourceKey: sourceKey})
+	if err != nil {
+		if err := sc.media.Delete(context.Background(), sourceKey); err != nil {
+			log.Printf("Error deleting %s after a failed story: %v", sourceKey, err)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create story", err.Error())
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Your video is being processed",
+		"status":  fiber.StatusAccepted,
+		"story":   created,
+		"job":     mediaJobResponse(job),
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Create Story logic -------------------------
+// --------------------------------------------------------------------------------------------------
@@ -0,0 +1,389 @@
+package controllers
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/mail"
+	"API/internal/middleware"
+	"API/internal/utils"
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type TwoFactorController struct {
+	db       database.Service    // The database service to interact with the database.
+	emails   *mail.Emails        // New device login alerts.
+	validate *validator.Validate // Validator instance for validating user inputs.
+}
+
+func NewTwoFactorController(db database.Service, emails *mail.Emails) *TwoFactorController {
+	return &TwoFactorController{
+		db:       db,
+		emails:   emails,
+		validate: utils.NewValidator(),
+	}
+}
+
+// A challenge allows a handful of guesses before the user has to log in again
+const loginChallengeAttempts = 5
+
+// newRecoveryCodes returns a fresh set of recovery codes for the user and
+// the hashes to store.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, models.RecoveryCodeCount)
+	hashes := make([]string, 0, models.RecoveryCodeCount)
+	for i := 0; i < models.RecoveryCodeCount; i++ {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, utils.HashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// loadUserWithPassword reloads the current user from Postgres, since the
+// cached principal carries neither the password hash nor the TOTP secret,
+// and checks the password.
+func (tc *TwoFactorController) loadUserWithPassword(c *fiber.Ctx, password string) (*models.User, error) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return nil, utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	user, err := tc.db.FindUserById(principal.UserID)
+	if err != nil {
+		return nil, utils.SendErrorResponse(c, fiber.StatusNotFound, "User not found", err.Error())
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return nil, utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Incorrect password", nil)
+	}
+	return user, nil
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Enrollment logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// Status reports whether 2FA is on and how many recovery codes are left.
+func (tc *TwoFactorController) Status(c *fiber.Ctx) error {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	remaining, err := tc.db.CountRecoveryCodes(principal.UserID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":                   fiber.StatusOK,
+		"enabled":                  principal.User.TwoFactorEnabled,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// Enroll starts setting up an authenticator app. The secret only becomes
+// active once Confirm receives a valid code for it.
+func (tc *TwoFactorController) Enroll(c *fiber.Ctx) error {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	if principal.User.TwoFactorEnabled {
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "Two-factor authentication is already enabled", nil)
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to generate secret", err.Error())
+	}
+
+	if err := utils.StorePendingTOTPSecret(context.Background(), principal.UserID, secret); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Failed to start enrollment", err.Error())
+	}
+
+	uri := utils.TOTPURI(principal.User.Email, secret)
+	qrCode, err := utils.TOTPQRCode(uri)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to generate QR code", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":      fiber.StatusOK,
+		"secret":      secret,
+		"otpauth_uri": uri,
+		"qr_code":     qrCode,
+		"expires_in":  int(utils.TOTPEnrollmentTTL.Seconds()),
+	})
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required,max=20"`
+}
+
+// Confirm turns 2FA on once the user proves their app generates the right
+// codes, and hands out the recovery codes. They are only shown this once.
+func (tc *TwoFactorController) Confirm(c *fiber.Ctx) error {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+
+	if err := tc.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	ctx := context.Background()
+	secret, err := utils.PendingTOTPSecret(ctx, principal.UserID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Failed to load enrollment", err.Error())
+	}
+	if secret == "" {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "No enrollment in progress or it expired, please start again", nil)
+	}
+
+	step, valid := utils.ValidateTOTP(secret, req.Code, time.Now())
+	if !valid {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid code", nil)
+	}
+	if _, err := utils.ClaimTOTPStep(ctx, principal.UserID, step); err != nil {
+		log.Printf("Error recording TOTP step for user %d: %v", principal.UserID, err)
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to generate recovery codes", err.Error())
+	}
+
+	if err := tc.db.EnableTwoFactor(principal.UserID, secret, hashes); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to enable two-factor authentication", err.Error())
+	}
+
+	if err := utils.DeletePendingTOTPSecret(ctx, principal.UserID); err != nil {
+		log.Printf("Error clearing TOTP enrollment for user %d: %v", principal.UserID, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":        "Two-factor authentication enabled, store your recovery codes somewhere safe",
+		"status":         fiber.StatusOK,
+		"recovery_codes": codes,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Enrollment logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Manage 2FA logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+type TwoFactorPasswordRequest struct {
+	Password string `json:"password" validate:"required,max=255"`
+}
+
+// Disable turns 2FA off. It needs the password so a stolen session alone
+// cannot remove the second factor.
+func (tc *TwoFactorController) Disable(c *fiber.Ctx) error {
+	var req TwoFactorPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+
+	if err := tc.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	user, err := tc.loadUserWithPassword(c, req.Password)
+	if user == nil {
+		return err
+	}
+
+	if !user.TwoFactorEnabled {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Two-factor authentication is not enabled", nil)
+	}
+
+	if err := tc.db.DisableTwoFactor(user.ID); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to disable two-factor authentication", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Two-factor authentication disabled",
+		"status":  fiber.StatusOK,
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code, used or not.
+func (tc *TwoFactorController) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	var req TwoFactorPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+
+	if err := tc.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	user, err := tc.loadUserWithPassword(c, req.Password)
+	if user == nil {
+		return err
+	}
+
+	if !user.TwoFactorEnabled {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Two-factor authentication is not enabled", nil)
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to generate recovery codes", err.Error())
+	}
+
+	if err := tc.db.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to save recovery codes", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":        "New recovery codes generated, the old ones no longer work",
+		"status":         fiber.StatusOK,
+		"recovery_codes": codes,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Manage 2FA logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the 2FA Login logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required,max=255"`
+	Code           string `json:"code" validate:"required,max=20"`
+}
+
+// Verify finishes a login started by Login for an account with 2FA. The code
+// is either from the authenticator app or one of the recovery codes.
+func (tc *TwoFactorController) Verify(c *fiber.Ctx) error {
+	var req TwoFactorVerifyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid form data", err.Error())
+	}
+
+	if err := tc.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+
+	ctx := context.Background()
+	userID, err := utils.LoginChallengeUser(ctx, req.ChallengeToken)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Please try again later", err.Error())
+	}
+	if userID == 0 {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Login expired, please sign in again", nil)
+	}
+
+	allowed, _, err := utils.Throttle(ctx, "2fa-challenge:"+utils.HashToken(req.ChallengeToken), loginChallengeAttempts, utils.LoginChallengeTTL)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Please try again later", err.Error())
+	}
+	if !allowed {
+		utils.DeleteLoginChallenge(ctx, req.ChallengeToken)
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Too many attempts, please sign in again", nil)
+	}
+
+	user, err := tc.db.FindUserById(userID)
+	if err != nil || !user.TwoFactorEnabled {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Login expired, please sign in again", nil)
+	}
+
+	// Wrong codes count against the account like wrong passwords, a fresh
+	// challenge does not buy new guesses
+	account := loginAccountKey(user, "")
+	wait, err := utils.LoginRetryAfter(ctx, account, c.IP())
+	if err != nil {
+		log.Printf("Failed to check login lockout for %s: %v", account, err)
+	}
+	if wait > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+		return utils.SendErrorResponse(c, fiber.StatusTooManyRequests, "Too many failed login attempts, try again later", nil)
+	}
+
+	usedRecoveryCode := false
+	if step, valid := utils.ValidateTOTP(user.TOTPSecret, req.Code, time.Now()); valid {
+		fresh, err := utils.ClaimTOTPStep(ctx, user.ID, step)
+		if err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusServiceUnavailable, "Please try again later", err.Error())
+		}
+		if !fresh {
+			return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "This code was already used, wait for the next one", nil)
+		}
+	} else {
+		err := tc.db.UseRecoveryCode(user.ID, utils.HashToken(utils.NormalizeRecoveryCode(req.Code)))
+		if errors.Is(err, database.ErrRecoveryCodeInvalid) {
+			recordLoginFailure(tc.db, tc.emails, c, user, account)
+			return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid code", nil)
+		}
+		if err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+		}
+		usedRecoveryCode = true
+	}
+
+	if err := utils.ResetLoginFailures(ctx, account); err != nil {
+		log.Printf("Failed to reset login failures for %s: %v", account, err)
+	}
+
+	if err := utils.DeleteLoginChallenge(ctx, req.ChallengeToken); err != nil {
+		log.Printf("Error deleting login challenge: %v", err)
+	}
+
+	if banned, response := rejectBanned(c, user); banned {
+		return response
+	}
+
+	JWT, refreshToken, err := startSession(tc.db, tc.emails, user, c)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to generate JWT token", err.Error())
+	}
+
+	response := fiber.Map{
+		"detail":        "User have been verify successfully",
+		"status":        fiber.StatusOK,
+		"JWT":           JWT,
+		"refresh_token": refreshToken,
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
+		"user": fiber.Map{
+			"User": user,
+		},
+	}
+	if usedRecoveryCode {
+		remaining, err := tc.db.CountRecoveryCodes(user.ID)
+		if err == nil {
+			response["recovery_codes_remaining"] = remaining
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the 2FA Login logic -------------------------
+// --------------------------------------------------------------------------------------------------
@@ -0,0 +1,497 @@
+package controllers
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/media"
+	"API/internal/utils"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Resumable uploads follow the tus protocol (https://tus.io/protocols/resumable-upload)
+// with the creation, expiration, checksum and termination extensions, so
+// any tus client library can upload to /api/v1/uploads.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,checksum,termination"
+	// Status codes the checksum extension adds
+	statusChecksumMismatch = 460
+)
+
+type UploadController struct {
+	db       database.Service    // The database service to interact with the database.
+	media    media.MediaStore    // Where finished uploads are stored.
+	spool    *media.Spool        // Where chunks are kept until the upload is finished.
+	validate *validator.Validate // Validator instance for validating user inputs.
+}
+
+func NewUploadController(db database.Service, store media.MediaStore, spool *media.Spool) *UploadController {
+	return &UploadController{
+		db:       db,
+		media:    store,
+		spool:    spool,
+		validate: utils.NewValidator(),
+	}
+}
+
+// checkTusVersion answers clients speaking another version of the protocol.
+// On failure it has already written the response.
+func checkTusVersion(c *fiber.Ctx) (bool, error) {
+	c.Set("Tus-Resumable", tusVersion)
+	if c.Get("Tus-Resumable") != tusVersion {
+		c.Set("Tus-Version", tusVersion)
+		return false, utils.SendErrorResponse(c, fiber.StatusPreconditionFailed, "Unsupported tus version", nil)
+	}
+	return true, nil
+}
+
+// findOwnUpload loads the upload in the :uploadID route param and makes sure
+// it belongs to the authenticated user. Someone else's upload is reported as
+// not found. On failure it has already written the response.
+func (uc *UploadController) findOwnUpload(c *fiber.Ctx) (*models.UploadSession, error) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	session, err := uc.db.FindUploadSession(c.Params("uploadID"))
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", err.Error())
+	}
+	if session == nil || session.UserID != userID || time.Now().After(session.ExpiresAt) {
+		return nil, utils.SendErrorResponse(c, fiber.StatusNotFound, "Upload not found", nil)
+	}
+	return session, nil
+}
+
+func setUploadHeaders(c *fiber.Ctx, session *models.UploadSession) {
+	c.Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Set("Upload-Length", strconv.FormatInt(session.Size, 10))
+	c.Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Set(fiber.HeaderCacheControl, "no-store")
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Upload logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// Options tells tus clients what this server supports.
+func (uc *UploadController) Options(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+	c.Set("Tus-Version", tusVersion)
+	c.Set("Tus-Extension", tusExtensions)
+	c.Set("Tus-Max-Size", strconv.FormatInt(models.MaxUploadSize, 10))
+	// Not part of tus, clients have to pick a chunk size no larger than this
+	c.Set("Tus-Max-Chunk-Size", strconv.Itoa(models.MaxUploadChunkSize))
+	c.Set("Tus-Checksum-Algorithm", strings.Join(media.ChecksumAlgorithms, ","))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// CreateUpload starts an upload of Upload-Length bytes. The file name is
+// required in Upload-Metadata, it decides whether the upload is a photo or
+// a video.
+func (uc *UploadController) CreateUpload(c *fiber.Ctx) error {
+	if ok, err := checkTusVersion(c); !ok {
+		return err
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	size, err := strconv.ParseInt(c.Get("Upload-Length"), 10, 64)
+	if err != nil || size <= 0 {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "A valid Upload-Length is required", nil)
+	}
+	if size > models.MaxUploadSize {
+		return utils.SendErrorResponse(c, fiber.StatusRequestEntityTooLarge, "Upload is too large", fiber.Map{
+			"max_size": models.MaxUploadSize,
+		})
+	}
+
+	metadata, err := media.ParseUploadMetadata(c.Get("Upload-Metadata"))
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid Upload-Metadata", err.Error())
+	}
+	filename := metadata["filename"]
+	if !utils.IsVideoFilename(filename) && !utils.IsImageFilename(filename) {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{
+			"filename": "A photo or video file name is required in Upload-Metadata",
+		})
+	}
+
+	session, err := uc.db.CreateUploadSession(models.UploadSession{
+		UploadID:    uuid.NewString(),
+		UserID:      userID,
+		Filename:    filename,
+		ContentType: media.ContentTypeOf(filename),
+		Size:        size,
+		ExpiresAt:   time.Now().Add(models.UploadSessionTTL),
+	})
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create upload", err.Error())
+	}
+
+	c.Location(c.BaseURL() + "/api/v1/uploads/" + session.UploadID)
+	c.Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":        "Upload created",
+		"status":         fiber.StatusCreated,
+		"upload_id":      session.UploadID,
+		"max_chunk_size": models.MaxUploadChunkSize,
+	})
+}
+
+// UploadStatus is how a client finds out where to resume after a disconnect.
+func (uc *UploadController) UploadStatus(c *fiber.Ctx) error {
+	if ok, err := checkTusVersion(c); !ok {
+		return err
+	}
+
+	session, err := uc.findOwnUpload(c)
+	if session == nil {
+		return err
+	}
+
+	setUploadHeaders(c, session)
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// AppendChunk writes the chunk in the body at Upload-Offset, which must be
+// where the upload currently ends. A chunk that fails its Upload-Checksum is
+// discarded. The last chunk moves the file to the media store.
+func (uc *UploadController) AppendChunk(c *fiber.Ctx) error {
+	if ok, err := checkTusVersion(c); !ok {
+		return err
+	}
+
+	if c.Get(fiber.HeaderContentType) != "application/offset+octet-stream" {
+		return utils.SendErrorResponse(c, fiber.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream", nil)
+	}
+
+	session, err := uc.findOwnUpload(c)
+	if session == nil {
+		return err
+	}
+	if session.Direct {
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "This upload goes directly to storage, finalize it instead", nil)
+	}
+
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != session.Offset {
+		setUploadHeaders(c, session)
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "Upload-Offset does not match the upload", fiber.Map{
+			"offset": session.Offset,
+		})
+	}
+
+	var checksum *media.Checksum
+	if header := c.Get("Upload-Checksum"); header != "" {
+		if checksum, err = media.ParseChecksum(header); err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid Upload-Checksum", err.Error())
+		}
+	}
+
+	if !session.IsComplete() && session.Offset < session.Size {
+		newOffset, err := uc.spool.Append(session.UploadID, session.Offset, session.Size, chunkReader(c), checksum)
+		switch {
+		case errors.Is(err, media.ErrChecksumMismatch):
+			return utils.SendErrorResponse(c, statusChecksumMismatch, "Checksum mismatch", nil)
+		case errors.Is(err, media.ErrUploadBusy):
+			return utils.SendErrorResponse(c, fiber.StatusLocked, "Another chunk of this upload is being written", nil)
+		case errors.Is(err, media.ErrUploadTooLarge):
+			return utils.SendErrorResponse(c, fiber.StatusRequestEntityTooLarge, "Chunk goes past Upload-Length", nil)
+		case err != nil:
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to write chunk", err.Error())
+		}
+
+		session.Offset = newOffset
+		session.ExpiresAt = time.Now().Add(models.UploadSessionTTL)
+		if err := uc.db.UpdateUploadOffset(session.ID, session.Offset, session.ExpiresAt); err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to save upload progress", err.Error())
+		}
+	}
+
+	// Also retried by an empty PATCH if storing failed the first time
+	if !session.IsComplete() && session.Offset == session.Size {
+		if err := uc.complete(session); err != nil {
+			if invalidUpload(err) {
+				uc.discard(session)
+				return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid file", err.Error())
+			}
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to store upload", err.Error())
+		}
+	}
+
+	setUploadHeaders(c, session)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// chunkReader reads the body of a PATCH. A large chunk is still streaming in
+// and goes to the spool as it arrives, small and chunked bodies were already
+// read by fasthttp or middleware.BodyLimit.
+func chunkReader(c *fiber.Ctx) io.Reader {
+	if c.Request().IsBodyStream() {
+		return c.Request().BodyStream()
+	}
+	return bytes.NewReader(c.Body())
+}
+
+// complete moves the finished file from the spool to the media store, once
+// its content matches its extension (see media.CheckUpload).
+func (uc *UploadController) complete(session *models.UploadSession) error {
+	file, err := uc.spool.Open(session.UploadID)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := media.CheckUpload(file, session.Filename); err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	key := media.NewKey("originals", session.Filename)
+	object, err := uc.media.Put(ctx, key, file, session.Size, session.ContentType)
+	if err != nil {
+		return err
+	}
+	original := media.StoredVariant{Key: key, URL: object.URL, Size: object.Size}
+	if err := recordAssets(ctx, uc.db, uc.media, models.MediaAsset{UserID: &session.UserID}, original); err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(models.UploadSessionTTL)
+	if err := uc.db.CompleteUploadSession(session.ID, key, expiresAt); err != nil {
+		uc.media.Delete(ctx, key)
+		return err
+	}
+	now := time.Now()
+	session.MediaKey, session.CompletedAt, session.ExpiresAt = key, &now, expiresAt
+
+	if err := uc.spool.Remove(session.UploadID); err != nil {
+		log.Printf("Error removing spooled upload %s: %v", session.UploadID, err)
+	}
+	return nil
+}
+
+// invalidUpload reports whether err rejects the content of an upload.
+func invalidUpload(err error) bool {
+	return errors.Is(err, media.ErrUnsupportedImage) || errors.Is(err, media.ErrImageTooLarge) || errors.Is(err, media.ErrUnsupportedVideo)
+}
+
+// discard deletes a rejected upload, its session and what was spooled.
+func (uc *UploadController) discard(session *models.UploadSession) {
+	if _, err := uc.db.DeleteUploadSession(session.ID); err != nil {
+		log.Printf("Error deleting rejected upload %s: %v", session.UploadID, err)
+	}
+	if err := uc.spool.Remove(session.UploadID); err != nil {
+		log.Printf("Error removing spooled upload %s: %v", session.UploadID, err)
+	}
+}
+
+// CancelUpload throws away an upload and everything received so far.
+func (uc *UploadController) CancelUpload(c *fiber.Ctx) error {
+	if ok, err := checkTusVersion(c); !ok {
+		return err
+	}
+
+	session, err := uc.findOwnUpload(c)
+	if session == nil {
+		return err
+	}
+
+	deleted, err := uc.db.DeleteUploadSession(session.ID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to cancel upload", err.Error())
+	}
+	if !deleted {
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Upload not found", nil)
+	}
+	if err := uc.spool.Remove(session.UploadID); err != nil {
+		log.Printf("Error removing spooled upload %s: %v", session.UploadID, err)
+	}
+	if session.MediaKey != "" {
+		if err := uc.media.Delete(context.Background(), session.MediaKey); err != nil {
+			log.Printf("Error deleting %s of a cancelled upload: %v", session.MediaKey, err)
+		}
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Upload logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the start of the Direct Upload logic -------------------------
+// --------------------------------------------------------------------------------------------------
+
+type DirectUploadRequest struct {
+	Filename string `json:"filename" validate:"required,max=255"`
+	Size     int64  `json:"size" validate:"required,min=1"`
+}
+
+// CreateDirectUpload signs an upload that goes from the client straight to
+// the media backend, keeping large bodies off the API. The client then calls
+// FinalizeUpload and uses the upload_id like that of a resumable upload.
+func (uc *UploadController) CreateDirectUpload(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+	}
+
+	var req DirectUploadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err.Error())
+	}
+	if err := uc.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+	if !utils.IsVideoFilename(req.Filename) && !utils.IsImageFilename(req.Filename) {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", map[string]string{
+			"filename": "Only photos and videos can be uploaded",
+		})
+	}
+	if req.Size > models.MaxUploadSize {
+		return utils.SendErrorResponse(c, fiber.StatusRequestEntityTooLarge, "Upload is too large", fiber.Map{
+			"max_size": models.MaxUploadSize,
+		})
+	}
+
+	key := media.NewKey("originals", req.Filename)
+	contentType := media.ContentTypeOf(key)
+	target, err := media.PresignUpload(context.Background(), uc.media, key, contentType, models.DirectUploadURLTTL)
+	if errors.Is(err, media.ErrDirectUploadUnsupported) {
+		return utils.SendErrorResponse(c, fiber.StatusNotImplemented, "Direct uploads are not available, use a resumable upload", nil)
+	}
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to sign upload", err.Error())
+	}
+
+	// Recorded up front, so a file uploaded but never finalized is collected too
+	original := media.StoredVariant{Key: key, URL: uc.media.URL(key), Size: req.Size}
+	if err := recordAssets(context.Background(), uc.db, uc.media, models.MediaAsset{UserID: &userID}, original); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create upload", err.Error())
+	}
+
+	session, err := uc.db.CreateUploadSession(models.UploadSession{
+		UploadID:    uuid.NewString(),
+		UserID:      userID,
+		Filename:    req.Filename,
+		ContentType: contentType,
+		Size:        req.Size,
+		MediaKey:    key,
+		Direct:      true,
+		ExpiresAt:   time.Now().Add(models.UploadSessionTTL),
+	})
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create upload", err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":   "Upload the file to the target, then finalize it",
+		"status":    fiber.StatusCreated,
+		"upload_id": session.UploadID,
+		"target":    target,
+	})
+}
+
+type FinalizeUploadRequest struct {
+	AssetID string `json:"asset_id" validate:"required,max=512"`
+}
+
+// FinalizeUpload checks what the client uploaded directly: it has to be the
+// asset that was signed, no larger than announced, and a valid photo or
+// video. Anything else is deleted again.
+func (uc *UploadController) FinalizeUpload(c *fiber.Ctx) error {
+	session, err := uc.findOwnUpload(c)
+	if session == nil {
+		return err
+	}
+	if !session.Direct {
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "Only direct uploads are finalized", nil)
+	}
+
+	var req FinalizeUploadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err.Error())
+	}
+	if err := uc.validate.Struct(req); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Validation failed", utils.FormatValidationErrors(err))
+	}
+	if !media.AssetMatchesKey(req.AssetID, session.MediaKey) {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Asset does not belong to this upload", nil)
+	}
+
+	if session.IsComplete() {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message":   "Upload is ready",
+			"status":    fiber.StatusOK,
+			"upload_id": session.UploadID,
+		})
+	}
+
+	ctx := context.Background()
+	object, err := uc.media.Stat(ctx, session.MediaKey)
+	if errors.Is(err, media.ErrNotFound) {
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "The file has not been uploaded yet", nil)
+	}
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to check upload", err.Error())
+	}
+
+	reject := func(status int, message string, details interface{}) error {
+		if err := uc.media.Delete(ctx, session.MediaKey); err != nil {
+			log.Printf("Error deleting rejected upload %s: %v", session.MediaKey, err)
+		}
+		if _, err := uc.db.DeleteUploadSession(session.ID); err != nil {
+			log.Printf("Error deleting rejected upload %s: %v", session.UploadID, err)
+		}
+		return utils.SendErrorResponse(c, status, message, details)
+	}
+
+	if object.Size > session.Size || object.Size > models.MaxUploadSize {
+		return reject(fiber.StatusRequestEntityTooLarge, "The file is larger than announced", fiber.Map{
+			"size": session.Size,
+		})
+	}
+	if err := media.CheckStoredUpload(ctx, uc.media, session.MediaKey); err != nil {
+		if invalidUpload(err) {
+			return reject(fiber.StatusBadRequest, "Invalid file", err.Error())
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to check upload", err.Error())
+	}
+
+	if err := uc.db.CompleteUploadSession(session.ID, session.MediaKey, time.Now().Add(models.UploadSessionTTL)); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to finalize upload", err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":   "Upload is ready",
+		"status":    fiber.StatusOK,
+		"upload_id": session.UploadID,
+	})
+}
+
+// --------------------------------------------------------------------------------------------------
+//------------------------------ these is the End of the Direct Upload logic -------------------------
+// --------------------------------------------------------------------------------------------------
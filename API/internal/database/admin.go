@@ -0,0 +1,144 @@
+package database
+
+import (
+	models "API/internal/Models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Every admin change is written together with its audit entry, in one
+// transaction, so an action can never happen without being logged. change
+// may complete the entry, e.g. with the ID of a row it created.
+func (s *service) withAudit(entry *models.AuditLog, change func(tx *gorm.DB) error) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := change(tx); err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+	if err != nil {
+		return err
+	}
+	if entry.TargetUserID != nil && entry.TargetType == "" {
+		forgetUser(*entry.TargetUserID)
+	}
+	return nil
+}
+
+// withAuditIfFound is withAudit for changes that may find nothing to change:
+// change returns gorm.ErrRecordNotFound for that, and no entry is written.
+func (s *service) withAuditIfFound(entry *models.AuditLog, change func(tx *gorm.DB) error) (bool, error) {
+	err := s.withAudit(entry, change)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// --------------------------------------------------------------
+// --------------------------- Find ------------------------------
+// --------------------------------------------------------------
+
+// FindAuditLogs returns the newest entries first, optionally only the ones
+// about a single user (targetUserID 0 means everyone).
+func (s *service) FindAuditLogs(targetUserID uint, limit, offset int) ([]models.AuditLog, int64, error) {
+	query := s.db.Model(&models.AuditLog{})
+	if targetUserID != 0 {
+		query = query.Where("target_user_id = ?", targetUserID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []models.AuditLog
+	result := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&entries)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return entries, total, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Create ------------------------------
+// --------------------------------------------------------------
+
+// CreateAuditLog records an action that has no row of its own to change,
+// e.g. a forced logout.
+func (s *service) CreateAuditLog(entry models.AuditLog) error {
+	return s.db.Create(&entry).Error
+}
+
+// --------------------------------------------------------------
+// --------------------------- Update ------------------------------
+// --------------------------------------------------------------
+
+// BanUser bans the user, or suspends them when expiresAt is set.
+func (s *service) BanUser(userID uint, reason string, expiresAt *time.Time, entry models.AuditLog) error {
+	return s.withAudit(&entry, func(tx *gorm.DB) error {
+		return tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"banned_at":      time.Now(),
+			"ban_expires_at": expiresAt,
+			"ban_reason":     reason,
+		}).Error
+	})
+}
+
+func (s *service) UnbanUser(userID uint, entry models.AuditLog) error {
+	return s.withAudit(&entry, func(tx *gorm.DB) error {
+		return tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"banned_at":      nil,
+			"ban_expires_at": nil,
+			"ban_reason":     "",
+		}).Error
+	})
+}
+
+func (s *service) SetUserVerified(userID uint, verified bool, entry models.AuditLog) error {
+	return s.withAudit(&entry, func(tx *gorm.DB) error {
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("is_verified", verified).Error
+	})
+}
+
+func (s *service) SetUserRole(userID uint, role string, entry models.AuditLog) error {
+	return s.withAudit(&entry, func(tx *gorm.DB) error {
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("role", role).Error
+	})
+}
+
+// --------------------------------------------------------------
+// --------------------------- Migrate ------------------------------
+// --------------------------------------------------------------
+
+// auditLogTriggers make audit_logs append-only for everyone connecting with
+// the application's credentials, including anything run by hand. They run as
+// separate statements since prepared statements take one command each.
+var auditLogTriggers = []string{
+	`CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'audit_logs is append-only';
+	END;
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS audit_logs_no_update_delete ON audit_logs`,
+	`CREATE TRIGGER audit_logs_no_update_delete
+		BEFORE UPDATE OR DELETE ON audit_logs
+		FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only()`,
+	`DROP TRIGGER IF EXISTS audit_logs_no_truncate ON audit_logs`,
+	`CREATE TRIGGER audit_logs_no_truncate
+		BEFORE TRUNCATE ON audit_logs
+		FOR EACH STATEMENT EXECUTE FUNCTION audit_logs_append_only()`,
+}
+
+func migrateAuditLogs(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range auditLogTriggers {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	models "API/internal/Models"
+
+	"gorm.io/gorm"
+)
+
+// --------------------------------------------------------------
+// --------------------------- Find ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) FindBlockedImages(limit, offset int) ([]models.BlockedImage, int64, error) {
+	query := s.db.Model(&models.BlockedImage{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var images []models.BlockedImage
+	result := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&images)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return images, total, nil
+}
+
+// MatchBlockedImage returns the blocklist entry the perceptual hash is
+// within models.BlockedImageDistance of, or nil. When several match, one
+// that rejects wins over one that only asks for review. The list is small
+// enough to compare in Go rather than in SQL.
+func (s *service) MatchBlockedImage(hash int64) (*models.BlockedImage, error) {
+	var images []models.BlockedImage
+	if err := s.db.Find(&images).Error; err != nil {
+		return nil, err
+	}
+
+	var match *models.BlockedImage
+	for i := range images {
+		if images[i].Distance(hash) > models.BlockedImageDistance {
+			continue
+		}
+		if match == nil || (images[i].Action == models.BlockActionReject && match.Action != models.BlockActionReject) {
+			match = &images[i]
+		}
+	}
+	return match, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Create ------------------------------
+// --------------------------------------------------------------
+
+// CreateBlockedImage adds the entry, entry is completed with its ID.
+func (s *service) CreateBlockedImage(image models.BlockedImage, entry models.AuditLog) (*models.BlockedImage, error) {
+	err := s.withAudit(&entry, func(tx *gorm.DB) error {
+		if err := tx.Create(&image).Error; err != nil {
+			return err
+		}
+		entry.TargetID = &image.ID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Delete ------------------------------
+// --------------------------------------------------------------
+
+// DeleteBlockedImage removes the entry, reporting whether it existed.
+func (s *service) DeleteBlockedImage(id uint, entry models.AuditLog) (bool, error) {
+	return s.withAuditIfFound(&entry, func(tx *gorm.DB) error {
+		result := tx.Delete(&models.BlockedImage{}, id)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return result.Error
+	})
+}
@@ -0,0 +1,242 @@
+package database
+
+import (
+	models "API/internal/Models"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrCollectionNameTaken is returned by CreateCollection and UpdateCollection
+// when the user already has a collection of that name, ignoring case.
+var ErrCollectionNameTaken = errors.New("collection name is already in use")
+
+// collectionNameIndex keeps collection names unique per user, ignoring case,
+// even when two requests create the same name at once.
+const collectionNameIndex = "idx_collections_user_lower_name"
+
+func migrateCollections(db *gorm.DB) error {
+	return db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS ` + collectionNameIndex +
+		` ON collections (user_id, lower(name)) WHERE deleted_at IS NULL`).Error
+}
+
+// collectionError maps a violation of collectionNameIndex to ErrCollectionNameTaken.
+func collectionError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == collectionNameIndex {
+		return ErrCollectionNameTaken
+	}
+	return err
+}
+
+// PostSaveCount is the aggregated number of saves for one of the owner's posts.
+type PostSaveCount struct {
+	PostID uint  `json:"post_id"`
+	Saves  int64 `json:"saves"`
+}
+
+// --------------------------------------------------------------
+// --------------------------- Find ------------------------------
+// --------------------------------------------------------------
+
+// FindSavedPosts lists the posts a user saved, newest save first. A nil
+// collectionID returns the virtual "All posts" collection.
+func (s *service) FindSavedPosts(userID uint, collectionID *uint, limit, offset int) ([]models.Post, int64, error) {
+	scope := func(db *gorm.DB) *gorm.DB {
+		db = db.Model(&models.Post{}).
+			Joins("JOIN user_saved_posts ON user_saved_posts.post_id = posts.id").
+			Where("user_saved_posts.user_id = ?", userID)
+		if collectionID != nil {
+			db = db.Where("user_saved_posts.collection_id = ?", *collectionID)
+		}
+		return db
+	}
+
+	var total int64
+	if err := s.db.Scopes(scope).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var posts []models.Post
+	result := s.db.Scopes(scope).
+		Order("user_saved_posts.created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&posts)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	return posts, total, nil
+}
+
+func (s *service) CountSavedPosts(userID uint) (int64, error) {
+	var total int64
+	result := s.db.Model(&models.SavedPost{}).
+		Joins("JOIN posts ON posts.id = user_saved_posts.post_id AND posts.deleted_at IS NULL").
+		Where("user_saved_posts.user_id = ?", userID).
+		Count(&total)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return total, nil
+}
+
+func (s *service) FindCollectionById(id uint) (*models.Collection, error) {
+	var collection models.Collection
+	result := s.db.Where("id = ?", id).First(&collection)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &collection, nil
+}
+
+func (s *service) FindCollectionsByUser(userID uint) ([]models.Collection, error) {
+	var collections []models.Collection
+	result := s.db.Model(&models.Collection{}).
+		Select("collections.*, (SELECT COUNT(*) FROM user_saved_posts JOIN posts ON posts.id = user_saved_posts.post_id AND posts.deleted_at IS NULL WHERE user_saved_posts.collection_id = collections.id) AS post_count").
+		Where("user_id = ?", userID).
+		Order("created_at ASC").
+		Find(&collections)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return collections, nil
+}
+
+// FindPostSaveInsights returns the save count of each of the user's posts
+// along with the total. Saves are never turned into individual notifications.
+func (s *service) FindPostSaveInsights(userID uint) ([]PostSaveCount, int64, error) {
+	var counts []PostSaveCount
+	result := s.db.Model(&models.Post{}).
+		Select("id AS post_id, saves_count AS saves").
+		Where("user_id = ? AND saves_count > 0", userID).
+		Order("saves_count DESC").
+		Scan(&counts)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	var total int64
+	for _, count := range counts {
+		total += count.Saves
+	}
+	return counts, total, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Create ------------------------------
+// --------------------------------------------------------------
+
+// SavePost adds the post to the user's saved posts. It reports whether a new
+// save was recorded; saving an already saved post only moves it when a
+// collection is given.
+func (s *service) SavePost(userID, postID uint, collectionID *uint) (bool, error) {
+	saved := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.SavedPost{
+			UserID:       userID,
+			PostID:       postID,
+			CollectionID: collectionID,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			if collectionID == nil {
+				return nil
+			}
+			return tx.Model(&models.SavedPost{}).
+				Where("user_id = ? AND post_id = ?", userID, postID).
+				Update("collection_id", collectionID).Error
+		}
+
+		saved = true
+		return tx.Model(&models.Post{}).
+			Where("id = ?", postID).
+			UpdateColumn("saves_count", gorm.Expr("saves_count + 1")).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return saved, nil
+}
+
+func (s *service) CreateCollection(collection models.Collection) (*models.Collection, error) {
+	newCollection := &models.Collection{
+		UserID: collection.UserID,
+		Name:   collection.Name,
+	}
+
+	result := s.db.Create(newCollection)
+	if result.Error != nil {
+		return nil, collectionError(result.Error)
+	}
+	return newCollection, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Update ------------------------------
+// --------------------------------------------------------------
+
+// MoveSavedPosts moves saved posts into a collection. A nil collectionID
+// takes them out of any collection, leaving them only in "All posts".
+func (s *service) MoveSavedPosts(userID uint, postIDs []uint, collectionID *uint) (int64, error) {
+	result := s.db.Model(&models.SavedPost{}).
+		Where("user_id = ? AND post_id IN ?", userID, postIDs).
+		Update("collection_id", collectionID)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+func (s *service) UpdateCollection(collection models.Collection) (*models.Collection, error) {
+	result := s.db.Model(&collection).Update("name", collection.Name)
+	if result.Error != nil {
+		return nil, collectionError(result.Error)
+	}
+	return &collection, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Delete ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) UnsavePost(userID, postID uint) (bool, error) {
+	removed := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ? AND post_id = ?", userID, postID).Delete(&models.SavedPost{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		removed = true
+		return tx.Model(&models.Post{}).
+			Where("id = ?", postID).
+			UpdateColumn("saves_count", gorm.Expr("GREATEST(saves_count - 1, 0)")).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return removed, nil
+}
+
+// DeleteCollection removes a collection. Its posts stay saved and fall back
+// to "All posts".
+func (s *service) DeleteCollection(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.SavedPost{}).
+			Where("collection_id = ?", id).
+			Update("collection_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Collection{}, id).Error
+	})
+}
@@ -0,0 +1,73 @@
+package database_test
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestCollectionNamesAreUniquePerUser(t *testing.T) {
+	srv := newTestService(t)
+	user := newTestUser(t, srv, "collector")
+	other := newTestUser(t, srv, "other")
+
+	trips, err := srv.CreateCollection(models.Collection{UserID: user.ID, Name: "Trips"})
+	if err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+	if _, err := srv.CreateCollection(models.Collection{UserID: user.ID, Name: "TRIPS"}); !errors.Is(err, database.ErrCollectionNameTaken) {
+		t.Errorf("expected ErrCollectionNameTaken for the same name in another case, got %v", err)
+	}
+	if _, err := srv.CreateCollection(models.Collection{UserID: other.ID, Name: "Trips"}); err != nil {
+		t.Errorf("expected another user to use the name, got %v", err)
+	}
+
+	food, err := srv.CreateCollection(models.Collection{UserID: user.ID, Name: "Food"})
+	if err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+	food.Name = "trips"
+	if _, err := srv.UpdateCollection(*food); !errors.Is(err, database.ErrCollectionNameTaken) {
+		t.Errorf("expected ErrCollectionNameTaken renaming onto a taken name, got %v", err)
+	}
+
+	// A deleted collection gives its name back
+	if err := srv.DeleteCollection(trips.ID); err != nil {
+		t.Fatalf("DeleteCollection: %v", err)
+	}
+	if _, err := srv.CreateCollection(models.Collection{UserID: user.ID, Name: "Trips"}); err != nil {
+		t.Errorf("expected the name of a deleted collection to be free, got %v", err)
+	}
+}
+
+func TestCreateCollectionConcurrently(t *testing.T) {
+	srv := newTestService(t)
+	user := newTestUser(t, srv, "racer")
+
+	const attempts = 10
+	errs := make([]error, attempts)
+	var wg sync.WaitGroup
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = srv.CreateCollection(models.Collection{UserID: user.ID, Name: "Favourites"})
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, database.ErrCollectionNameTaken):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("expected exactly one collection to be created, got %d", created)
+	}
+}
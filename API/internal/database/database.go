@@ -2,6 +2,7 @@ package database
 
 import (
 	models "API/internal/Models"
+	"API/internal/utils"
 	"context"
 	"fmt"
 	"log"
@@ -28,16 +29,135 @@ type Service interface {
 	//---------------------- Find---------------------------
 	FindUserByEmail(email string) (*models.User, error)
 	FindUserByToken(token string) (*models.User, error)
+	FindUserByUsername(username string) (*models.User, error)
+	FindUserByPhone(phone string) (*models.User, error)
 	FindUserById(id uint) (*models.User, error)
 	//-----------------------Create ------------------------
-	CreateUser(user models.User) (*models.User, error)
+	CreateUser(user models.User, verification *EmailVerification) (*models.User, error)
 	CreateNotification(user models.User, notification models.Notification) (*models.User, error)
 	// --------------------Verify --------------------------
-	VerifyUserAndUpdate(token string) (*models.User, error)
+	CreateEmailVerificationToken(token models.EmailVerificationToken, email models.OutboxMessage) (*models.EmailVerificationToken, error)
+	VerifyEmail(tokenHash string) (*models.User, error)
+	SetPendingEmail(userID uint, email string) error
+	MarkPhoneVerified(userID uint, phone string) error
 	// --------------------Delete---------------------------
 	DeleteUser(id string) (*models.User, error)
 	// --------------------Update---------------------------
-	UpdateUser(user models.User) (*models.User, error)
+	UpdateUser(user models.User, verification *EmailVerification) (*models.User, error)
+	// --------------------Refresh tokens-------------------
+	CreateRefreshToken(token models.RefreshToken) (*models.RefreshToken, error)
+	FindRefreshTokenByHash(hash string) (*models.RefreshToken, error)
+	RotateRefreshToken(oldID uint, next models.RefreshToken) (*models.RefreshToken, error)
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeUserRefreshTokens(userID uint) ([]string, error)
+	RevokeOtherRefreshTokens(userID uint, keepFamilyID string) ([]string, error)
+	// --------------------Password reset-------------------
+	CreatePasswordResetToken(token models.PasswordResetToken, email models.OutboxMessage) (*models.PasswordResetToken, error)
+	ResetPassword(tokenHash, passwordHash string) (*models.User, error)
+	// --------------------Two-factor----------------------
+	EnableTwoFactor(userID uint, secret string, codeHashes []string) error
+	DisableTwoFactor(userID uint) error
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	UseRecoveryCode(userID uint, codeHash string) error
+	CountRecoveryCodes(userID uint) (int64, error)
+	// --------------------Passkeys------------------------
+	CreatePasskey(passkey models.Passkey) (*models.Passkey, error)
+	FindPasskeyById(id uint) (*models.Passkey, error)
+	FindPasskeyByCredentialID(credentialID []byte) (*models.Passkey, error)
+	FindPasskeysByUser(userID uint) ([]models.Passkey, error)
+	UpdatePasskeyCredential(id uint, credential []byte) error
+	RenamePasskey(id uint, name string) error
+	DeletePasskey(id uint) error
+	// --------------------Social login--------------------
+	FindUserIdentity(provider, subject string) (*models.UserIdentity, error)
+	CreateUserIdentity(identity models.UserIdentity) (*models.UserIdentity, error)
+	CreateUserWithIdentity(user models.User, identity models.UserIdentity) (*models.User, error)
+	// --------------------Sessions-------------------------
+	CreateSession(session models.Session, alert *models.OutboxMessage) (*models.Session, error)
+	FindSessionById(id uint) (*models.Session, error)
+	FindActiveSessions(userID uint, since time.Time) ([]models.Session, error)
+	IsKnownDevice(session models.Session) (bool, error)
+	TouchSession(familyID, ip string) error
+	// --------------------Posts----------------------------
+	CreatePost(post models.Post) (*models.Post, error)
+	FindPostById(id uint) (*models.Post, error)
+	FindTrashedPostById(id uint) (*models.Post, error)
+	FindTrashedPosts(userID uint, since time.Time) ([]models.Post, error)
+	FindExpiredTrashedPosts(before time.Time, afterID uint, limit int) ([]models.Post, error)
+	SetPostArchived(id uint, archived bool) error
+	PinPost(userID, postID uint) error
+	UnpinPost(id uint) error
+	TrashPost(post models.Post) error
+	RestorePost(post models.Post) error
+	PurgePost(post models.Post) error
+	// --------------------Stories--------------------------
+	CreateStory(story models.Story) (*models.Story, error)
+	// --------------------Media jobs-----------------------
+	CreatePostWithMediaJob(post models.Post, job models.MediaJob) (*models.Post, *models.MediaJob, error)
+	CreateStoryWithMediaJob(story models.Story, job models.MediaJob) (*models.Story, *models.MediaJob, error)
+	FindMediaJobById(id uint) (*models.MediaJob, error)
+	ClaimMediaJob(staleBefore time.Time) (*models.MediaJob, error)
+	CompletePostVideo(job models.MediaJob, item models.PostMedia, aspectRatio float64) error
+	CompleteStoryVideo(job models.MediaJob, mediaURL, posterURL string, duration float64) error
+	RetryMediaJob(job models.MediaJob, message string, retryAt time.Time) error
+	FailMediaJob(job models.MediaJob, message string) error
+	// --------------------Resumable uploads----------------
+	CreateUploadSession(session models.UploadSession) (*models.UploadSession, error)
+	FindUploadSession(uploadID string) (*models.UploadSession, error)
+	FindExpiredUploadSessions(before time.Time, limit int) ([]models.UploadSession, error)
+	UpdateUploadOffset(id uint, offset int64, expiresAt time.Time) error
+	CompleteUploadSession(id uint, mediaKey string, expiresAt time.Time) error
+	ConsumeUploadSession(id uint) (bool, error)
+	DeleteUploadSession(id uint) (bool, error)
+	DeleteExpiredUploadSession(id uint, before time.Time) (bool, error)
+	// --------------------Media assets---------------------
+	RecordMediaAssets(assets []models.MediaAsset) error
+	FindOrphanedMediaAssets(before time.Time, limit, offset int) ([]models.MediaAsset, error)
+	CountOrphanedMediaAssets(before time.Time) (int64, int64, error)
+	DeleteOrphanedMediaAsset(id uint, before time.Time) (bool, error)
+	FindUntrackedMediaKeys(keys []string) ([]string, error)
+	ReuseContent(sha256 string) (string, string, bool, error)
+	FindMediaAssetsForReview(limit, offset int) ([]models.MediaAsset, int64, error)
+	ClearMediaAssetReview(id uint, entry models.AuditLog) (bool, error)
+	// --------------------Email outbox---------------------
+	EnqueueOutboxMessage(msg models.OutboxMessage) error
+	ClaimOutboxMessage(staleBefore time.Time) (*models.OutboxMessage, error)
+	MarkOutboxMessageSent(id uint) error
+	RetryOutboxMessage(id uint, message string, retryAt time.Time) error
+	DeadLetterOutboxMessage(id uint, message string) error
+	RequeueOutboxMessage(id uint, entry models.AuditLog) (bool, error)
+	FindOutboxMessages(status string, limit, offset int) ([]models.OutboxMessage, int64, error)
+	DeleteSentOutboxMessages(before time.Time) (int64, error)
+	// --------------------Weekly digest--------------------
+	FindDigestRecipients(now time.Time, limit int) ([]models.User, error)
+	IsKnownTimezone(name string) (bool, error)
+	FindDigestActivity(userID uint, since time.Time) (*models.DigestActivity, error)
+	RecordDigest(userID uint, email *models.OutboxMessage, now time.Time) (bool, error)
+	UnsubscribeFromDigest(userID uint) (bool, error)
+	// --------------------Image blocklist------------------
+	FindBlockedImages(limit, offset int) ([]models.BlockedImage, int64, error)
+	MatchBlockedImage(hash int64) (*models.BlockedImage, error)
+	CreateBlockedImage(image models.BlockedImage, entry models.AuditLog) (*models.BlockedImage, error)
+	DeleteBlockedImage(id uint, entry models.AuditLog) (bool, error)
+	// --------------------Saved posts & Collections---------
+	SavePost(userID, postID uint, collectionID *uint) (bool, error)
+	UnsavePost(userID, postID uint) (bool, error)
+	FindSavedPosts(userID uint, collectionID *uint, limit, offset int) ([]models.Post, int64, error)
+	CountSavedPosts(userID uint) (int64, error)
+	MoveSavedPosts(userID uint, postIDs []uint, collectionID *uint) (int64, error)
+	CreateCollection(collection models.Collection) (*models.Collection, error)
+	FindCollectionById(id uint) (*models.Collection, error)
+	FindCollectionsByUser(userID uint) ([]models.Collection, error)
+	UpdateCollection(collection models.Collection) (*models.Collection, error)
+	DeleteCollection(id uint) error
+	FindPostSaveInsights(userID uint) ([]PostSaveCount, int64, error)
+	// --------------------Admin----------------------------
+	BanUser(userID uint, reason string, expiresAt *time.Time, entry models.AuditLog) error
+	UnbanUser(userID uint, entry models.AuditLog) error
+	SetUserVerified(userID uint, verified bool, entry models.AuditLog) error
+	SetUserRole(userID uint, role string, entry models.AuditLog) error
+	CreateAuditLog(entry models.AuditLog) error
+	FindAuditLogs(targetUserID uint, limit, offset int) ([]models.AuditLog, int64, error)
 }
 
 // --------------------------------------------------------------
@@ -52,6 +172,25 @@ func (s *service) FindUserByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
+func (s *service) FindUserByUsername(username string) (*models.User, error) {
+	var user models.User
+	result := s.db.Where("username = ?", username).First(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
+// FindUserByPhone looks a user up by their E.164 phone number.
+func (s *service) FindUserByPhone(phone string) (*models.User, error) {
+	var user models.User
+	result := s.db.Where("phone = ?", phone).First(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
 func (s *service) FindUserByToken(token string) (*models.User, error) {
 	var user models.User
 	result := s.db.Where("token = ?", token).First(&user)
@@ -76,7 +215,9 @@ func (s *service) FindUserById(id uint) (*models.User, error) {
 // --------------------------- Create ------------------------------
 // --------------------------------------------------------------
 
-func (s *service) CreateUser(user models.User) (*models.User, error) {
+// CreateUser creates the account and, unless verification is nil, queues the
+// email verifying its address.
+func (s *service) CreateUser(user models.User, verification *EmailVerification) (*models.User, error) {
 	newUser := &models.User{
 		Email:          user.Email,
 		Password:       user.Password,
@@ -96,9 +237,19 @@ func (s *service) CreateUser(user models.User) (*models.User, error) {
 		Language:       user.Language,
 	}
 
-	result := s.db.Create(newUser)
-	if result.Error != nil {
-		return nil, result.Error
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(newUser).Error; err != nil {
+			return err
+		}
+		if verification != nil {
+			if err := createEmailVerification(tx, newUser.ID, verification); err != nil {
+				return err
+			}
+		}
+		return addMediaRefs(tx, newUser.ID, models.MediaRefAvatar, newUser.ID, newUser.Avatar)
+	})
+	if err != nil {
+		return nil, err
 	}
 	return newUser, nil
 }
@@ -122,34 +273,6 @@ func (s *service) CreateNotification(user models.User, notification models.Notif
 	return &user, nil
 }
 
-// --------------------------------------------------------------
-// --------------------------- VerifyUserAndUpdate ------------------------------
-// --------------------------------------------------------------
-
-func (s *service) VerifyUserAndUpdate(token string) (*models.User, error) {
-	var user models.User
-
-	// Find user by token
-	result := s.db.Where("token = ?", token).First(&user)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			return nil, nil
-		}
-		return nil, result.Error
-	}
-
-	// Update user verification status
-	updates := map[string]interface{}{
-		"EmailVerified": true,
-	}
-
-	if err := s.db.Model(&user).Updates(updates).Error; err != nil {
-		return nil, err
-	}
-
-	return &user, nil
-}
-
 // --------------------------------------------------------------
 // --------------------------- Delete ------------------------------
 // --------------------------------------------------------------
@@ -184,6 +307,13 @@ func (s *service) DeleteUser(id string) (*models.User, error) {
 		return nil, err
 	}
 
+	// Their avatar, posts and stories are gone, the garbage collector takes care of the files
+	if err := releaseMediaRefs(s.db, "user_id = ?", user.ID); err != nil {
+		return nil, err
+	}
+
+	forgetUser(user.ID)
+
 	return &user, nil
 }
 
@@ -191,14 +321,35 @@ func (s *service) DeleteUser(id string) (*models.User, error) {
 // --------------------------- Update ------------------------------
 // --------------------------------------------------------------
 
-func (s *service) UpdateUser(user models.User) (*models.User, error) {
-	result := s.db.Save(&user)
-	if result.Error != nil {
-		return nil, result.Error
+// UpdateUser saves the user and, unless verification is nil, queues the
+// email verifying a new address.
+func (s *service) UpdateUser(user models.User, verification *EmailVerification) (*models.User, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if verification != nil {
+			if err := createEmailVerification(tx, user.ID, verification); err != nil {
+				return err
+			}
+		}
+		// A replaced avatar is left to the garbage collector
+		return setMediaRefs(tx, user.ID, models.MediaRefAvatar, user.ID, user.Avatar)
+	})
+	if err != nil {
+		return nil, err
 	}
+	forgetUser(user.ID)
 	return &user, nil
 }
 
+// forgetUser drops the cached copy AuthRequired keeps of a user after it changed.
+func forgetUser(id uint) {
+	if err := utils.InvalidateUserCache(context.Background(), id); err != nil {
+		log.Printf("Error invalidating cached user %d: %v", id, err)
+	}
+}
+
 type service struct {
 	db *gorm.DB
 }
@@ -249,7 +400,12 @@ func New() Service {
 }
 
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	// user_saved_posts carries the collection a saved post lives in
+	if err := db.SetupJoinTable(&models.User{}, "SavedPosts", &models.SavedPost{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(
 		&models.User{},
 		&models.Like{},
 		&models.Post{},
@@ -259,7 +415,31 @@ func AutoMigrate(db *gorm.DB) error {
 		&models.Follow{},
 		&models.Notification{},
 		&models.Hashtag{},
-	)
+		&models.Collection{},
+		&models.RefreshToken{},
+		&models.Session{},
+		&models.PasswordResetToken{},
+		&models.EmailVerificationToken{},
+		&models.RecoveryCode{},
+		&models.Passkey{},
+		&models.UserIdentity{},
+		&models.AuditLog{},
+		&models.PostMedia{},
+		&models.MediaJob{},
+		&models.UploadSession{},
+		&models.MediaAsset{},
+		&models.MediaAssetRef{},
+		&models.BlockedImage{},
+		&models.OutboxMessage{},
+	); err != nil {
+		return err
+	}
+
+	if err := migrateCollections(db); err != nil {
+		return err
+	}
+
+	return migrateAuditLogs(db)
 }
 
 // Health checks the health of the database connection by pinging the database.
@@ -36,21 +36,27 @@ func mustStartPostgresContainer() (func(context.Context) error, error) {
 	database = dbName
 	password = dbPwd
 	username = dbUser
+	sslmode = "disable"
+	schema = "public"
+
+	terminate := func(ctx context.Context) error {
+		return dbContainer.Terminate(ctx)
+	}
 
 	dbHost, err := dbContainer.Host(context.Background())
 	if err != nil {
-		return dbContainer.Terminate, err
+		return terminate, err
 	}
 
 	dbPort, err := dbContainer.MappedPort(context.Background(), "5432/tcp")
 	if err != nil {
-		return dbContainer.Terminate, err
+		return terminate, err
 	}
 
 	host = dbHost
 	port = dbPort.Port()
 
-	return dbContainer.Terminate, err
+	return terminate, err
 }
 
 func TestMain(m *testing.M) {
@@ -97,4 +103,6 @@ func TestClose(t *testing.T) {
 	if srv.Close() != nil {
 		t.Fatalf("expected Close() to return nil")
 	}
+	// New reuses the closed connection otherwise
+	dbInstance = nil
 }
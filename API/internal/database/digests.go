@@ -0,0 +1,136 @@
+package database
+
+import (
+	models "API/internal/Models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --------------------------------------------------------------
+// --------------------------- Find ------------------------------
+// --------------------------------------------------------------
+
+// digestSentSince is how recent a digest keeps the user from getting
+// another, well within models.DigestPeriod so next week's is not skipped.
+func digestSentSince(now time.Time) time.Time {
+	return now.Add(-models.DigestPeriod / 2)
+}
+
+// FindDigestRecipients returns the users whose weekly digest is due: they
+// opted in and verified their email, it is models.DigestWeekday at
+// models.DigestHour in their time zone, they got no digest this week and
+// have not used the app for models.DigestPeriod. A time zone Postgres does
+// not know would fail the query for everyone, those users are skipped.
+func (s *service) FindDigestRecipients(now time.Time, limit int) ([]models.User, error) {
+	weekday := int(models.DigestWeekday)
+	if weekday == 0 {
+		weekday = 7 // ISODOW counts Sunday last
+	}
+
+	var users []models.User
+	result := s.db.
+		Joins("JOIN pg_timezone_names tz ON tz.name = users.timezone").
+		Where("digest_opt_in = ? AND email_verified = ?", true, true).
+		Where("banned_at IS NULL OR ban_expires_at < ?", now).
+		Where("EXTRACT(ISODOW FROM ?::timestamptz AT TIME ZONE tz.name) = ?", now, weekday).
+		Where("EXTRACT(HOUR FROM ?::timestamptz AT TIME ZONE tz.name) = ?", now, models.DigestHour).
+		Where("last_digest_at IS NULL OR last_digest_at < ?", digestSentSince(now)).
+		Where("NOT EXISTS (SELECT 1 FROM sessions WHERE sessions.user_id = users.id AND sessions.last_used_at >= ? AND sessions.deleted_at IS NULL)",
+			now.Add(-models.DigestPeriod)).
+		Order("users.id ASC").
+		Limit(limit).
+		Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return users, nil
+}
+
+// IsKnownTimezone reports whether Postgres, which schedules the digest, knows
+// the time zone.
+func (s *service) IsKnownTimezone(name string) (bool, error) {
+	var count int64
+	if err := s.db.Raw("SELECT COUNT(*) FROM pg_timezone_names WHERE name = ?", name).Scan(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// FindDigestActivity gathers what happened for the user since: new
+// followers, the most liked posts of the accounts they follow and how many
+// notifications they have not read.
+func (s *service) FindDigestActivity(userID uint, since time.Time) (*models.DigestActivity, error) {
+	var activity models.DigestActivity
+
+	if err := s.db.Model(&models.Follow{}).
+		Where("followed_id = ? AND is_accepted = ? AND created_at >= ?", userID, true, since).
+		Count(&activity.NewFollowers).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.db.
+		Preload("User").
+		Preload("Media", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).
+		Where("user_id IN (SELECT followed_id FROM follows WHERE follower_id = ? AND is_accepted = ? AND deleted_at IS NULL)", userID, true).
+		Where("created_at >= ? AND status = ? AND is_archived = ?", since, models.MediaReady, false).
+		Order("likes_count DESC, comments_count DESC, id DESC").
+		Limit(models.DigestTopPosts).
+		Find(&activity.TopPosts).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(&models.Notification{}).
+		Where(`"to" = ? AND read = ?`, userID, false).
+		Count(&activity.UnreadNotifications).Error; err != nil {
+		return nil, err
+	}
+
+	return &activity, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Update ------------------------------
+// --------------------------------------------------------------
+
+// RecordDigest marks this week's digest of the user as done and queues its
+// email, nil when there was nothing to tell. It reports false when another
+// worker got to the user first, then nothing is queued.
+func (s *service) RecordDigest(userID uint, email *models.OutboxMessage, now time.Time) (bool, error) {
+	recorded := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND (last_digest_at IS NULL OR last_digest_at < ?)", userID, digestSentSince(now)).
+			Update("last_digest_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		recorded = true
+
+		if email == nil {
+			return nil
+		}
+		return enqueueOutboxMessage(tx, email)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	forgetUser(userID)
+	return recorded, nil
+}
+
+// UnsubscribeFromDigest turns the weekly digest off, reporting whether the
+// user exists.
+func (s *service) UnsubscribeFromDigest(userID uint) (bool, error) {
+	result := s.db.Model(&models.User{}).Where("id = ?", userID).Update("digest_opt_in", false)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	forgetUser(userID)
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,56 @@
+package database_test
+
+import (
+	models "API/internal/Models"
+	"testing"
+	"time"
+)
+
+func TestFindDigestRecipientsSkipsUnknownTimezones(t *testing.T) {
+	srv := newTestService(t)
+	db := srv.GetDB()
+
+	known, err := srv.IsKnownTimezone("Europe/Paris")
+	if err != nil || !known {
+		t.Fatalf("expected Europe/Paris to be known, got %t, %v", known, err)
+	}
+	if known, _ := srv.IsKnownTimezone("Mars/Olympus_Mons"); known {
+		t.Errorf("expected Mars/Olympus_Mons to be unknown")
+	}
+
+	// A Monday at DigestHour in UTC, long enough ago that no test session is that recent
+	now := time.Date(2001, time.January, 1, models.DigestHour, 30, 0, 0, time.UTC)
+	if now.Weekday() != models.DigestWeekday {
+		t.Fatalf("test date is a %s, not a %s", now.Weekday(), models.DigestWeekday)
+	}
+
+	due := newTestUser(t, srv, "digest")
+	lost := newTestUser(t, srv, "lost")
+	for _, update := range []struct {
+		user     models.User
+		timezone string
+	}{{due, "UTC"}, {lost, "Mars/Olympus_Mons"}} {
+		if err := db.Model(&models.User{}).Where("id = ?", update.user.ID).Updates(map[string]interface{}{
+			"digest_opt_in":  true,
+			"email_verified": true,
+			"timezone":       update.timezone,
+		}).Error; err != nil {
+			t.Fatalf("updating user: %v", err)
+		}
+	}
+
+	users, err := srv.FindDigestRecipients(now, 1000)
+	if err != nil {
+		t.Fatalf("FindDigestRecipients: %v", err)
+	}
+	found := map[uint]bool{}
+	for _, user := range users {
+		found[user.ID] = true
+	}
+	if !found[due.ID] {
+		t.Errorf("the user whose digest is due was not returned")
+	}
+	if found[lost.ID] {
+		t.Errorf("the user with an unknown time zone was returned")
+	}
+}
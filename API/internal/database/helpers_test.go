@@ -0,0 +1,45 @@
+package database_test
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestService connects to the container TestMain started and migrates it.
+// Tests share the database, so their rows need unique keys, see uniqueSuffix.
+func newTestService(t *testing.T) database.Service {
+	t.Helper()
+
+	srv := database.New()
+	if err := database.AutoMigrate(srv.GetDB()); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	return srv
+}
+
+// uniqueSuffix tells apart the rows of different tests and test runs.
+func uniqueSuffix() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// newTestUser creates an account named after prefix.
+func newTestUser(t *testing.T, srv database.Service, prefix string) models.User {
+	t.Helper()
+
+	suffix := uniqueSuffix()
+	user := models.User{
+		Username: prefix + suffix,
+		Name:     prefix,
+		Email:    prefix + suffix + "@example.com",
+		Password: "password",
+		Token:    "token",
+		Language: "en",
+	}
+	if err := srv.GetDB().Create(&user).Error; err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	return user
+}
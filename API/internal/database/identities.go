@@ -0,0 +1,60 @@
+package database
+
+import (
+	models "API/internal/Models"
+
+	"gorm.io/gorm"
+)
+
+// --------------------------------------------------------------
+// --------------------------- Find ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) FindUserIdentity(provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	result := s.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &identity, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Create ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) CreateUserIdentity(identity models.UserIdentity) (*models.UserIdentity, error) {
+	newIdentity := &models.UserIdentity{
+		UserID:   identity.UserID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+
+	result := s.db.Create(newIdentity)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return newIdentity, nil
+}
+
+// CreateUserWithIdentity creates an account for someone signing up through a
+// provider, together with the link to that provider.
+func (s *service) CreateUserWithIdentity(user models.User, identity models.UserIdentity) (*models.User, error) {
+	newUser := &user
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(newUser).Error; err != nil {
+			return err
+		}
+
+		identity.UserID = newUser.ID
+		if err := tx.Create(&identity).Error; err != nil {
+			return err
+		}
+		return addMediaRefs(tx, newUser.ID, models.MediaRefAvatar, newUser.ID, newUser.Avatar)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newUser, nil
+}
@@ -0,0 +1,264 @@
+package database
+
+import (
+	models "API/internal/Models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --------------------------------------------------------------
+// --------------------------- Find ------------------------------
+// --------------------------------------------------------------
+
+// orphanedAssets narrows a query on media_assets to what the garbage
+// collector may delete: nothing refers to the asset, it has not changed
+// since before, and no upload or unfinished media job still needs the file.
+func orphanedAssets(query *gorm.DB, before time.Time) *gorm.DB {
+	return query.
+		Where("media_assets.updated_at < ?", before).
+		Where("NOT EXISTS (SELECT 1 FROM media_asset_refs WHERE media_asset_refs.asset_id = media_assets.id)").
+		Where("NOT EXISTS (SELECT 1 FROM upload_sessions WHERE upload_sessions.media_key = media_assets.key)").
+		Where("NOT EXISTS (SELECT 1 FROM media_jobs WHERE media_jobs.source_key = media_assets.key AND media_jobs.status IN ? AND media_jobs.deleted_at IS NULL)",
+			[]string{models.MediaJobQueued, models.MediaJobRunning})
+}
+
+// FindOrphanedMediaAssets returns the oldest assets the garbage collector
+// would delete, see orphanedAssets.
+func (s *service) FindOrphanedMediaAssets(before time.Time, limit, offset int) ([]models.MediaAsset, error) {
+	var assets []models.MediaAsset
+	result := orphanedAssets(s.db.Model(&models.MediaAsset{}), before).
+		Order("updated_at ASC, id ASC").
+		Limit(limit).
+		Offset(offset).
+		Find(&assets)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return assets, nil
+}
+
+// FindMediaAssetsForReview returns the assets resembling a blocklist entry
+// set to review, oldest first, with what uses them.
+func (s *service) FindMediaAssetsForReview(limit, offset int) ([]models.MediaAsset, int64, error) {
+	query := s.db.Model(&models.MediaAsset{}).Where("review_match IS NOT NULL")
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var assets []models.MediaAsset
+	result := query.Preload("Refs").Order("created_at ASC, id ASC").Limit(limit).Offset(offset).Find(&assets)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return assets, total, nil
+}
+
+// FindUntrackedMediaKeys returns the keys that have no asset, files stored
+// before assets were recorded.
+func (s *service) FindUntrackedMediaKeys(keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	var tracked []string
+	if err := s.db.Model(&models.MediaAsset{}).Where("key IN ?", keys).Pluck("key", &tracked).Error; err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(tracked))
+	for _, key := range tracked {
+		known[key] = true
+	}
+	var untracked []string
+	for _, key := range keys {
+		if !known[key] {
+			untracked = append(untracked, key)
+		}
+	}
+	return untracked, nil
+}
+
+// CountOrphanedMediaAssets returns how many assets the garbage collector
+// would delete and how many bytes that frees.
+func (s *service) CountOrphanedMediaAssets(before time.Time) (int64, int64, error) {
+	var totals struct {
+		Count int64
+		Size  int64
+	}
+	result := orphanedAssets(s.db.Model(&models.MediaAsset{}), before).
+		Select("COUNT(*) AS count, COALESCE(SUM(size), 0) AS size").
+		Scan(&totals)
+	if result.Error != nil {
+		return 0, 0, result.Error
+	}
+	return totals.Count, totals.Size, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Create ------------------------------
+// --------------------------------------------------------------
+
+// RecordMediaAssets registers freshly stored objects. They start without
+// references. A key that is already known is a file shared by identical
+// content (see ReuseContent): it keeps its owner, but a blocklist match of
+// the new upload still queues it for review.
+func (s *service) RecordMediaAssets(assets []models.MediaAsset) error {
+	if len(assets) == 0 {
+		return nil
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"review_match": gorm.Expr("COALESCE(EXCLUDED.review_match, media_assets.review_match)"),
+			"d_hash":       gorm.Expr("COALESCE(media_assets.d_hash, EXCLUDED.d_hash)"),
+		}),
+	}).Create(&assets).Error
+}
+
+// ReuseContent implements media.ContentIndex: it finds a processed file
+// with the same content and moves its updated_at, which keeps the garbage
+// collector away from it for another grace period. Originals are never
+// shared, they are deleted as soon as they are processed.
+func (s *service) ReuseContent(sha256 string) (string, string, bool, error) {
+	var asset models.MediaAsset
+	result := s.db.Model(&asset).
+		Clauses(clause.Returning{}).
+		Where("id = (SELECT id FROM media_assets WHERE sha256 = ? AND key NOT LIKE 'originals/%' ORDER BY id LIMIT 1)", sha256).
+		Update("updated_at", time.Now())
+	if result.Error != nil {
+		return "", "", false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", "", false, nil
+	}
+	return asset.Key, asset.URL, true, nil
+}
+
+// addMediaRefs marks the assets served from urls as used by refType refID
+// of userID. URLs of files not stored by us have no asset and are skipped.
+// Assets stored without an owner, e.g. the avatar of a new account, become
+// userID's.
+func addMediaRefs(tx *gorm.DB, userID uint, refType string, refID uint, urls ...string) error {
+	ids, err := mediaAssetIDs(tx, urls)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	refs := make([]models.MediaAssetRef, 0, len(ids))
+	for _, id := range ids {
+		refs = append(refs, models.MediaAssetRef{RefType: refType, RefID: refID, AssetID: id, UserID: userID})
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&refs).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&models.MediaAsset{}).
+		Where("id IN ? AND user_id IS NULL", ids).
+		Update("user_id", userID).Error
+}
+
+// setMediaRefs is addMediaRefs for things that replace their media, like an
+// avatar: the assets refType refID used before and not anymore are released.
+func setMediaRefs(tx *gorm.DB, userID uint, refType string, refID uint, urls ...string) error {
+	ids, err := mediaAssetIDs(tx, urls)
+	if err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		err = releaseMediaRefs(tx, "ref_type = ? AND ref_id = ?", refType, refID)
+	} else {
+		err = releaseMediaRefs(tx, "ref_type = ? AND ref_id = ? AND asset_id NOT IN ?", refType, refID, ids)
+	}
+	if err != nil {
+		return err
+	}
+
+	return addMediaRefs(tx, userID, refType, refID, urls...)
+}
+
+func mediaAssetIDs(tx *gorm.DB, urls []string) ([]uint, error) {
+	present := make([]string, 0, len(urls))
+	for _, url := range urls {
+		if url != "" {
+			present = append(present, url)
+		}
+	}
+	if len(present) == 0 {
+		return nil, nil
+	}
+
+	var ids []uint
+	if err := tx.Model(&models.MediaAsset{}).Where("url IN ?", present).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// postMediaURLs lists every stored file the post shows.
+func postMediaURLs(post models.Post) []string {
+	urls := append([]string{}, post.MediaURLs...)
+	for _, item := range post.Media {
+		urls = append(urls, item.URL, item.MediumURL, item.ThumbnailURL, item.PosterURL)
+	}
+	return urls
+}
+
+// --------------------------------------------------------------
+// --------------------------- Delete ------------------------------
+// --------------------------------------------------------------
+
+// releaseMediaRefs deletes the references matching the condition and moves
+// the updated_at of their assets, so the grace period of an asset starts
+// when it loses its last reference.
+func releaseMediaRefs(tx *gorm.DB, condition string, args ...interface{}) error {
+	var released []models.MediaAssetRef
+	if err := tx.Clauses(clause.Returning{Columns: []clause.Column{{Name: "asset_id"}}}).
+		Where(condition, args...).
+		Delete(&released).Error; err != nil {
+		return err
+	}
+	if len(released) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(released))
+	for _, ref := range released {
+		ids = append(ids, ref.AssetID)
+	}
+	return tx.Model(&models.MediaAsset{}).Where("id IN ?", ids).Update("updated_at", time.Now()).Error
+}
+
+// ClearMediaAssetReview takes the asset off the review queue, reporting
+// whether it was on it. entry is completed with the owner of the asset.
+func (s *service) ClearMediaAssetReview(id uint, entry models.AuditLog) (bool, error) {
+	return s.withAuditIfFound(&entry, func(tx *gorm.DB) error {
+		var asset models.MediaAsset
+		result := tx.Model(&asset).
+			Clauses(clause.Returning{}).
+			Where("id = ? AND review_match IS NOT NULL", id).
+			Update("review_match", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		entry.TargetUserID = asset.UserID
+		return nil
+	})
+}
+
+// DeleteOrphanedMediaAsset removes the asset if it is still an orphan,
+// reporting whether it did. Only then may its file be deleted.
+func (s *service) DeleteOrphanedMediaAsset(id uint, before time.Time) (bool, error) {
+	result := orphanedAssets(s.db.Where("media_assets.id = ?", id), before).Delete(&models.MediaAsset{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
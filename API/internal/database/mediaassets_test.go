@@ -0,0 +1,120 @@
+package database_test
+
+import (
+	models "API/internal/Models"
+	"API/internal/jobs"
+	"API/internal/media"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectMediaGarbageSparesAssetsInUse(t *testing.T) {
+	srv := newTestService(t)
+	db := srv.GetDB()
+	ctx := context.Background()
+	suffix := uniqueSuffix()
+	user := newTestUser(t, srv, "gc")
+
+	store, err := media.NewLocalStore(t.TempDir(), "http://localhost/media")
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+
+	const grace = 24 * time.Hour
+	old := time.Now().Add(-2 * grace)
+	newAsset := func(name string, updatedAt time.Time) models.MediaAsset {
+		t.Helper()
+		key := "posts/gc-" + suffix + "/" + name
+		object, err := store.Put(ctx, key, strings.NewReader(name), int64(len(name)), "image/jpeg")
+		if err != nil {
+			t.Fatalf("storing %s: %v", name, err)
+		}
+		asset := models.MediaAsset{Key: key, URL: object.URL, Size: object.Size, CreatedAt: updatedAt, UpdatedAt: updatedAt}
+		if err := db.Create(&asset).Error; err != nil {
+			t.Fatalf("recording %s: %v", name, err)
+		}
+		return asset
+	}
+	newJob := func(sourceKey, status string) {
+		t.Helper()
+		job := models.MediaJob{
+			UserID:     user.ID,
+			TargetType: models.MediaJobTargetPost,
+			TargetID:   1,
+			SourceKey:  sourceKey,
+			Status:     status,
+			RunAfter:   old,
+		}
+		if err := db.Create(&job).Error; err != nil {
+			t.Fatalf("creating job: %v", err)
+		}
+	}
+
+	referenced := newAsset("referenced.jpg", old)
+	ref := models.MediaAssetRef{RefType: "post", RefID: 1, AssetID: referenced.ID, UserID: user.ID}
+	if err := db.Create(&ref).Error; err != nil {
+		t.Fatalf("creating ref: %v", err)
+	}
+
+	recent := newAsset("recent.jpg", time.Now().Add(-grace/2))
+
+	uploading := newAsset("uploading.mp4", old)
+	session := models.UploadSession{
+		UploadID:  "gc-" + suffix,
+		UserID:    user.ID,
+		Filename:  "uploading.mp4",
+		Size:      uploading.Size,
+		MediaKey:  uploading.Key,
+		ExpiresAt: time.Now().Add(models.UploadSessionTTL),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		t.Fatalf("creating upload session: %v", err)
+	}
+
+	queued := newAsset("queued.mp4", old)
+	newJob(queued.Key, models.MediaJobQueued)
+	running := newAsset("running.mp4", old)
+	newJob(running.Key, models.MediaJobRunning)
+
+	orphan := newAsset("orphan.jpg", old)
+	processed := newAsset("processed.mp4", old)
+	newJob(processed.Key, models.MediaJobDone)
+
+	if err := jobs.CollectMediaGarbage(srv, store, grace)(ctx); err != nil {
+		t.Fatalf("CollectMediaGarbage: %v", err)
+	}
+
+	for _, tc := range []struct {
+		asset models.MediaAsset
+		kept  bool
+	}{
+		{referenced, true},
+		{recent, true},
+		{uploading, true},
+		{queued, true},
+		{running, true},
+		{orphan, false},
+		{processed, false},
+	} {
+		var count int64
+		if err := db.Model(&models.MediaAsset{}).Where("id = ?", tc.asset.ID).Count(&count).Error; err != nil {
+			t.Fatalf("counting %s: %v", tc.asset.Key, err)
+		}
+		if kept := count == 1; kept != tc.kept {
+			t.Errorf("%s: expected the asset to be kept %t, got %t", tc.asset.Key, tc.kept, kept)
+		}
+
+		file, err := store.Open(ctx, tc.asset.Key)
+		if err == nil {
+			file.Close()
+		} else if !errors.Is(err, media.ErrNotFound) {
+			t.Fatalf("opening %s: %v", tc.asset.Key, err)
+		}
+		if kept := err == nil; kept != tc.kept {
+			t.Errorf("%s: expected the file to be kept %t, got %t", tc.asset.Key, tc.kept, kept)
+		}
+	}
+}
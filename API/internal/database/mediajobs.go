@@ -0,0 +1,255 @@
+package database
+
+import (
+	models "API/internal/Models"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --------------------------------------------------------------
+// --------------------------- Find ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) FindMediaJobById(id uint) (*models.MediaJob, error) {
+	var job models.MediaJob
+	result := s.db.Where("id = ?", id).First(&job)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &job, nil
+}
+
+// ClaimMediaJob picks the oldest job that is due, or one whose worker has
+// been running it since before staleBefore, and marks it running. SKIP
+// LOCKED lets several workers claim jobs at the same time without picking
+// the same one. Returns gorm.ErrRecordNotFound when there is nothing to do.
+func (s *service) ClaimMediaJob(staleBefore time.Time) (*models.MediaJob, error) {
+	var job models.MediaJob
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("(status = ? AND run_after <= ?) OR (status = ? AND started_at < ?)",
+				models.MediaJobQueued, time.Now(), models.MediaJobRunning, staleBefore).
+			Order("id ASC").
+			First(&job).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		job.Status = models.MediaJobRunning
+		job.Attempts++
+		job.StartedAt = &now
+		return tx.Model(&job).Updates(map[string]interface{}{
+			"status":     job.Status,
+			"attempts":   job.Attempts,
+			"started_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Create ------------------------------
+// --------------------------------------------------------------
+
+// CreatePostWithMediaJob saves a video post, still processing, together with
+// the job that will process it.
+func (s *service) CreatePostWithMediaJob(post models.Post, job models.MediaJob) (*models.Post, *models.MediaJob, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&post).Error; err != nil {
+			return err
+		}
+		if err := addMediaRefs(tx, post.UserID, models.MediaRefPost, post.ID, postMediaURLs(post)...); err != nil {
+			return err
+		}
+
+		job.TargetType = models.MediaJobTargetPost
+		job.TargetID = post.ID
+		if err := createMediaJob(tx, &job); err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).
+			Where("id = ?", post.UserID).
+			UpdateColumn("post_count", gorm.Expr("post_count + 1")).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	forgetUser(post.UserID)
+	return &post, &job, nil
+}
+
+// CreateStoryWithMediaJob saves a video story, still processing, together
+// with the job that will process it.
+func (s *service) CreateStoryWithMediaJob(story models.Story, job models.MediaJob) (*models.Story, *models.MediaJob, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&story).Error; err != nil {
+			return err
+		}
+
+		job.TargetType = models.MediaJobTargetStory
+		job.TargetID = story.ID
+		return createMediaJob(tx, &job)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &story, &job, nil
+}
+
+func createMediaJob(tx *gorm.DB, job *models.MediaJob) error {
+	job.Status = models.MediaJobQueued
+	job.RunAfter = time.Now()
+	return tx.Create(job).Error
+}
+
+// --------------------------------------------------------------
+// --------------------------- Update ------------------------------
+// --------------------------------------------------------------
+
+// CompletePostVideo fills in the processed video of the post, marks the post
+// ready and the job done, and lets the owner know. Posts in "recently
+// deleted" are updated too so they come back complete. Returns
+// gorm.ErrRecordNotFound when the post has been purged in the meantime.
+func (s *service) CompletePostVideo(job models.MediaJob, item models.PostMedia, aspectRatio float64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&models.Post{}).
+			Where("id = ?", job.TargetID).
+			Updates(map[string]interface{}{
+				"status":       models.MediaReady,
+				"media_urls":   gorm.Expr("ARRAY[?]::text[]", item.URL),
+				"aspect_ratio": aspectRatio,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Model(&models.PostMedia{}).
+			Where("post_id = ? AND media_type = ?", job.TargetID, models.MediaTypeVideo).
+			Updates(map[string]interface{}{
+				"url":           item.URL,
+				"medium_url":    item.MediumURL,
+				"thumbnail_url": item.ThumbnailURL,
+				"poster_url":    item.PosterURL,
+				"width":         item.Width,
+				"height":        item.Height,
+				"blur_hash":     item.BlurHash,
+				"duration":      item.Duration,
+			}).Error; err != nil {
+			return err
+		}
+		if err := addMediaRefs(tx, job.UserID, models.MediaRefPost, job.TargetID, item.URL, item.MediumURL, item.ThumbnailURL, item.PosterURL); err != nil {
+			return err
+		}
+
+		return finishMediaJob(tx, job, models.MediaJobDone, "", models.NotifTypeMediaReady)
+	})
+}
+
+// CompleteStoryVideo fills in the processed video of the story, marks it
+// ready and the job done, and lets the owner know. Returns
+// gorm.ErrRecordNotFound when the story has been deleted in the meantime.
+func (s *service) CompleteStoryVideo(job models.MediaJob, mediaURL, posterURL string, duration float64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Story{}).
+			Where("id = ?", job.TargetID).
+			Updates(map[string]interface{}{
+				"status":         models.MediaReady,
+				"media_url":      mediaURL,
+				"poster_url":     posterURL,
+				"video_duration": duration,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := addMediaRefs(tx, job.UserID, models.MediaRefStory, job.TargetID, mediaURL, posterURL); err != nil {
+			return err
+		}
+
+		return finishMediaJob(tx, job, models.MediaJobDone, "", models.NotifTypeMediaReady)
+	})
+}
+
+// RetryMediaJob puts a failed attempt back in the queue until retryAt.
+func (s *service) RetryMediaJob(job models.MediaJob, message string, retryAt time.Time) error {
+	return s.db.Model(&models.MediaJob{}).
+		Where("id = ?", job.ID).
+		Updates(map[string]interface{}{
+			"status":    models.MediaJobQueued,
+			"error":     message,
+			"run_after": retryAt,
+		}).Error
+}
+
+// FailMediaJob gives up on the job and marks its post or story failed. The
+// owner is only notified when the post or story still exists.
+func (s *service) FailMediaJob(job models.MediaJob, message string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var target *gorm.DB
+		switch job.TargetType {
+		case models.MediaJobTargetPost:
+			target = tx.Unscoped().Model(&models.Post{})
+		default:
+			target = tx.Model(&models.Story{})
+		}
+
+		result := target.Where("id = ?", job.TargetID).Update("status", models.MediaFailed)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		notification := models.NotifTypeMediaFailed
+		if result.RowsAffected == 0 {
+			notification = ""
+		}
+		return finishMediaJob(tx, job, models.MediaJobFailed, message, notification)
+	})
+}
+
+// finishMediaJob closes the job and, unless notification is empty, tells
+// the owner their post or story is done processing.
+func finishMediaJob(tx *gorm.DB, job models.MediaJob, status, message string, notification models.NotificationType) error {
+	if err := tx.Model(&models.MediaJob{}).
+		Where("id = ?", job.ID).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"error":       message,
+			"finished_at": time.Now(),
+		}).Error; err != nil {
+		return err
+	}
+
+	if notification == "" {
+		return nil
+	}
+
+	context, err := json.Marshal(map[string]interface{}{
+		"job_id":      job.ID,
+		"target_type": job.TargetType,
+		"target_id":   job.TargetID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&models.Notification{
+		From:    job.UserID,
+		To:      job.UserID,
+		UserID:  job.UserID,
+		Type:    notification,
+		Context: string(context),
+	}).Error
+}
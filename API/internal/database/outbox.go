@@ -0,0 +1,158 @@
+package database
+
+import (
+	models "API/internal/Models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --------------------------------------------------------------
+// --------------------------- Find ------------------------------
+// --------------------------------------------------------------
+
+// FindOutboxMessages pages through the outbox, newest first. An empty
+// status lists every message.
+func (s *service) FindOutboxMessages(status string, limit, offset int) ([]models.OutboxMessage, int64, error) {
+	query := s.db.Model(&models.OutboxMessage{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var messages []models.OutboxMessage
+	result := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&messages)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return messages, total, nil
+}
+
+// ClaimOutboxMessage picks the oldest message that is due, or one whose
+// worker has been sending it since before staleBefore, and marks it
+// sending. Like ClaimMediaJob it lets several workers run side by side.
+// Returns gorm.ErrRecordNotFound when there is nothing to send.
+func (s *service) ClaimOutboxMessage(staleBefore time.Time) (*models.OutboxMessage, error) {
+	var msg models.OutboxMessage
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("(status = ? AND next_attempt_at <= ?) OR (status = ? AND started_at < ?)",
+				models.OutboxPending, time.Now(), models.OutboxSending, staleBefore).
+			Order("next_attempt_at ASC, id ASC").
+			First(&msg).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		msg.Status = models.OutboxSending
+		msg.Attempts++
+		msg.StartedAt = &now
+		return tx.Model(&msg).Updates(map[string]interface{}{
+			"status":     msg.Status,
+			"attempts":   msg.Attempts,
+			"started_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Create ------------------------------
+// --------------------------------------------------------------
+
+// EnqueueOutboxMessage saves an email that is not tied to a change in the
+// database, e.g. the account locked warning.
+func (s *service) EnqueueOutboxMessage(msg models.OutboxMessage) error {
+	return enqueueOutboxMessage(s.db, &msg)
+}
+
+// enqueueOutboxMessage saves msg as due right away, inside the transaction
+// of the change it is about.
+func enqueueOutboxMessage(tx *gorm.DB, msg *models.OutboxMessage) error {
+	msg.Status = models.OutboxPending
+	msg.Attempts = 0
+	msg.NextAttemptAt = time.Now()
+	return tx.Create(msg).Error
+}
+
+// --------------------------------------------------------------
+// --------------------------- Update ------------------------------
+// --------------------------------------------------------------
+
+// MarkOutboxMessageSent records the delivery and drops the payload, it may
+// hold a raw token.
+func (s *service) MarkOutboxMessageSent(id uint) error {
+	return s.db.Model(&models.OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":     models.OutboxSent,
+			"sent_at":    time.Now(),
+			"last_error": "",
+			"payload":    nil,
+		}).Error
+}
+
+// RetryOutboxMessage puts a failed delivery back in the queue until retryAt.
+func (s *service) RetryOutboxMessage(id uint, message string, retryAt time.Time) error {
+	return s.db.Model(&models.OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":          models.OutboxPending,
+			"last_error":      message,
+			"next_attempt_at": retryAt,
+		}).Error
+}
+
+// DeadLetterOutboxMessage gives up on the message until an admin retries it.
+func (s *service) DeadLetterOutboxMessage(id uint, message string) error {
+	return s.db.Model(&models.OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":     models.OutboxDead,
+			"last_error": message,
+		}).Error
+}
+
+// RequeueOutboxMessage gives a dead message a fresh set of attempts,
+// reporting whether it was dead. entry is completed with the account the
+// email is about.
+func (s *service) RequeueOutboxMessage(id uint, entry models.AuditLog) (bool, error) {
+	return s.withAuditIfFound(&entry, func(tx *gorm.DB) error {
+		var msg models.OutboxMessage
+		result := tx.Model(&msg).
+			Clauses(clause.Returning{}).
+			Where("id = ? AND status = ?", id, models.OutboxDead).
+			Updates(map[string]interface{}{
+				"status":          models.OutboxPending,
+				"attempts":        0,
+				"next_attempt_at": time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		entry.TargetUserID = msg.UserID
+		return nil
+	})
+}
+
+// --------------------------------------------------------------
+// --------------------------- Delete ------------------------------
+// --------------------------------------------------------------
+
+// DeleteSentOutboxMessages removes messages delivered before the cutoff,
+// returning how many.
+func (s *service) DeleteSentOutboxMessages(before time.Time) (int64, error) {
+	result := s.db.Where("status = ? AND sent_at < ?", models.OutboxSent, before).Delete(&models.OutboxMessage{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	models "API/internal/Models"
+	"time"
+)
+
+// --------------------------------------------------------------
+// --------------------------- Find ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) FindPasskeyById(id uint) (*models.Passkey, error) {
+	var passkey models.Passkey
+	result := s.db.Where("id = ?", id).First(&passkey)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &passkey, nil
+}
+
+func (s *service) FindPasskeyByCredentialID(credentialID []byte) (*models.Passkey, error) {
+	var passkey models.Passkey
+	result := s.db.Where("credential_id = ?", credentialID).First(&passkey)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &passkey, nil
+}
+
+func (s *service) FindPasskeysByUser(userID uint) ([]models.Passkey, error) {
+	var passkeys []models.Passkey
+	result := s.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&passkeys)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return passkeys, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Create ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) CreatePasskey(passkey models.Passkey) (*models.Passkey, error) {
+	newPasskey := &models.Passkey{
+		UserID:       passkey.UserID,
+		Name:         passkey.Name,
+		CredentialID: passkey.CredentialID,
+		Credential:   passkey.Credential,
+	}
+
+	result := s.db.Create(newPasskey)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return newPasskey, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Update ------------------------------
+// --------------------------------------------------------------
+
+// UpdatePasskeyCredential stores the credential after a login, which carries
+// the new sign counter and backup flags.
+func (s *service) UpdatePasskeyCredential(id uint, credential []byte) error {
+	return s.db.Model(&models.Passkey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"credential":   credential,
+		"last_used_at": time.Now(),
+	}).Error
+}
+
+func (s *service) RenamePasskey(id uint, name string) error {
+	return s.db.Model(&models.Passkey{}).Where("id = ?", id).Update("name", name).Error
+}
+
+// --------------------------------------------------------------
+// --------------------------- Delete ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) DeletePasskey(id uint) error {
+	return s.db.Unscoped().Delete(&models.Passkey{}, id).Error
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	models "API/internal/Models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrResetTokenInvalid is returned by ResetPassword when the token does not
+// exist, has expired or was already used.
+var ErrResetTokenInvalid = errors.New("password reset token is invalid or has expired")
+
+// --------------------------------------------------------------
+// --------------------------- Create ------------------------------
+// --------------------------------------------------------------
+
+// CreatePasswordResetToken stores a new reset token for the user together
+// with the email carrying it. Links sent earlier stop working so only the
+// latest email can be used.
+func (s *service) CreatePasswordResetToken(token models.PasswordResetToken, email models.OutboxMessage) (*models.PasswordResetToken, error) {
+	newToken := &models.PasswordResetToken{
+		UserID:    token.UserID,
+		TokenHash: token.TokenHash,
+		ExpiresAt: token.ExpiresAt,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(newToken).Error; err != nil {
+			return err
+		}
+		return enqueueOutboxMessage(tx, &email)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newToken, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Update ------------------------------
+// --------------------------------------------------------------
+
+// ResetPassword consumes the reset token with the given hash and sets the
+// user's password to passwordHash, which must already be bcrypt hashed.
+func (s *service) ResetPassword(tokenHash, passwordHash string) (*models.User, error) {
+	var user models.User
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var token models.PasswordResetToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", tokenHash).
+			First(&token).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrResetTokenInvalid
+			}
+			return err
+		}
+
+		if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+			return ErrResetTokenInvalid
+		}
+
+		if err := tx.Model(&token).Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("id = ?", token.UserID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrResetTokenInvalid
+			}
+			return err
+		}
+
+		return tx.Model(&user).Update("password", passwordHash).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	forgetUser(user.ID)
+	return &user, nil
+}
@@ -0,0 +1,214 @@
+package database
+
+import (
+	models "API/internal/Models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrPinLimitReached is returned by PinPost when the user already has
+// models.MaxPinnedPosts pinned posts.
+var ErrPinLimitReached = errors.New("pinned posts limit reached")
+
+// --------------------------------------------------------------
+// --------------------------- Find ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) FindPostById(id uint) (*models.Post, error) {
+	var post models.Post
+	result := s.db.Where("id = ?", id).First(&post)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &post, nil
+}
+
+// FindTrashedPostById only finds posts that are in "recently deleted".
+func (s *service) FindTrashedPostById(id uint) (*models.Post, error) {
+	var post models.Post
+	result := s.db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&post)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &post, nil
+}
+
+// FindTrashedPosts lists the user's posts deleted after since, most recent first.
+func (s *service) FindTrashedPosts(userID uint, since time.Time) ([]models.Post, error) {
+	var posts []models.Post
+	result := s.db.Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL AND deleted_at > ?", userID, since).
+		Order("deleted_at DESC").
+		Find(&posts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return posts, nil
+}
+
+// FindExpiredTrashedPosts returns posts that were deleted before the given
+// time, by ID from the first one after afterID.
+func (s *service) FindExpiredTrashedPosts(before time.Time, afterID uint, limit int) ([]models.Post, error) {
+	var posts []models.Post
+	result := s.db.Unscoped().
+		Preload("Media").
+		Where("deleted_at IS NOT NULL AND deleted_at <= ? AND id > ?", before, afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&posts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return posts, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Create ------------------------------
+// --------------------------------------------------------------
+
+// CreatePost saves the post together with its media and counts it on the profile.
+func (s *service) CreatePost(post models.Post) (*models.Post, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&post).Error; err != nil {
+			return err
+		}
+		if err := addMediaRefs(tx, post.UserID, models.MediaRefPost, post.ID, postMediaURLs(post)...); err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).
+			Where("id = ?", post.UserID).
+			UpdateColumn("post_count", gorm.Expr("post_count + 1")).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	forgetUser(post.UserID)
+	return &post, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Update ------------------------------
+// --------------------------------------------------------------
+
+// SetPostArchived hides or shows a post on the profile. Archiving also unpins it.
+func (s *service) SetPostArchived(id uint, archived bool) error {
+	updates := map[string]interface{}{
+		"is_archived": archived,
+	}
+	if archived {
+		updates["is_pinned"] = false
+	}
+
+	return s.db.Model(&models.Post{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// PinPost pins a post to the user's profile, enforcing models.MaxPinnedPosts.
+// The user row is locked so concurrent pins cannot go over the limit.
+func (s *service) PinPost(userID, postID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+
+		var pinned int64
+		if err := tx.Model(&models.Post{}).
+			Where("user_id = ? AND is_pinned = ? AND id <> ?", userID, true, postID).
+			Count(&pinned).Error; err != nil {
+			return err
+		}
+		if pinned >= models.MaxPinnedPosts {
+			return ErrPinLimitReached
+		}
+
+		return tx.Model(&models.Post{}).Where("id = ?", postID).Update("is_pinned", true).Error
+	})
+}
+
+func (s *service) UnpinPost(id uint) error {
+	return s.db.Model(&models.Post{}).Where("id = ?", id).Update("is_pinned", false).Error
+}
+
+// RestorePost brings a post back from "recently deleted".
+func (s *service) RestorePost(post models.Post) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Post{}).
+			Where("id = ?", post.ID).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).
+			Where("id = ?", post.UserID).
+			UpdateColumn("post_count", gorm.Expr("post_count + 1")).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	forgetUser(post.UserID)
+	return nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Delete ------------------------------
+// --------------------------------------------------------------
+
+// TrashPost soft deletes a post so it lands in "recently deleted".
+func (s *service) TrashPost(post models.Post) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Post{}).Where("id = ?", post.ID).Update("is_pinned", false).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&models.Post{}, post.ID).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).
+			Where("id = ?", post.UserID).
+			UpdateColumn("post_count", gorm.Expr("GREATEST(post_count - 1, 0)")).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	forgetUser(post.UserID)
+	return nil
+}
+
+// PurgePost permanently removes a trashed post with its likes, comments,
+// saves, tags and hashtag links. Its media assets are released, the files
+// themselves must be removed by the caller.
+func (s *service) PurgePost(post models.Post) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := releaseMediaRefs(tx, "ref_type = ? AND ref_id = ?", models.MediaRefPost, post.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Hashtag{}).
+			Where("id IN (SELECT hashtag_id FROM post_hashtags WHERE post_id = ?)", post.ID).
+			UpdateColumn("post_count", gorm.Expr("GREATEST(post_count - 1, 0)")).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("post_id = ?", post.ID).Delete(&models.Like{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("post_id = ?", post.ID).Delete(&models.Comment{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("post_id = ?", post.ID).Delete(&models.SavedPost{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Select("Hashtags", "TaggedUsers").Delete(&post).Error
+	})
+}
@@ -0,0 +1,174 @@
+package database_test
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/jobs"
+	"API/internal/media"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// brokenStore fails to delete the files with "broken" in their key.
+type brokenStore struct {
+	media.MediaStore
+}
+
+func (s brokenStore) Delete(ctx context.Context, key string) error {
+	if strings.Contains(key, "broken") {
+		return errors.New("storage unavailable")
+	}
+	return s.MediaStore.Delete(ctx, key)
+}
+
+func TestPurgeTrashedPostsPagesPastFailures(t *testing.T) {
+	srv := newTestService(t)
+	db := srv.GetDB()
+	ctx := context.Background()
+	suffix := uniqueSuffix()
+	user := newTestUser(t, srv, "purge")
+
+	local, err := media.NewLocalStore(t.TempDir(), "http://localhost/media")
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	store := brokenStore{local}
+
+	expired := gorm.DeletedAt{Time: time.Now().Add(-2 * models.TrashRetention), Valid: true}
+	newTrashedPost := func(name string) models.Post {
+		t.Helper()
+		post := models.Post{
+			UserID:    user.ID,
+			PostType:  "photo",
+			MediaURLs: []string{store.URL("posts/purge-" + suffix + "/" + name + ".jpg")},
+		}
+		post.DeletedAt = expired
+		if err := db.Create(&post).Error; err != nil {
+			t.Fatalf("creating post: %v", err)
+		}
+		return post
+	}
+
+	// More failing posts than fit in a batch, all before the one that can go
+	var broken []models.Post
+	for range 101 {
+		broken = append(broken, newTrashedPost("broken"))
+	}
+	purgeable := newTrashedPost("purgeable")
+
+	if err := jobs.PurgeTrashedPosts(srv, store)(ctx); err != nil {
+		t.Fatalf("PurgeTrashedPosts: %v", err)
+	}
+
+	var remaining int64
+	if err := db.Unscoped().Model(&models.Post{}).Where("id = ?", purgeable.ID).Count(&remaining).Error; err != nil {
+		t.Fatalf("counting posts: %v", err)
+	}
+	if remaining != 0 {
+		t.Errorf("the post after a batch of failures was not purged")
+	}
+	if err := db.Unscoped().Model(&models.Post{}).Where("id IN ?", []uint{broken[0].ID, broken[100].ID}).Count(&remaining).Error; err != nil {
+		t.Fatalf("counting posts: %v", err)
+	}
+	if remaining != 2 {
+		t.Errorf("expected the posts whose files could not be deleted to be kept, %d are left", remaining)
+	}
+}
+
+func newTestPost(t *testing.T, srv database.Service, userID uint) *models.Post {
+	t.Helper()
+
+	post, err := srv.CreatePost(models.Post{UserID: userID, PostType: "photo"})
+	if err != nil {
+		t.Fatalf("CreatePost: %v", err)
+	}
+	return post
+}
+
+func TestPinPostLimit(t *testing.T) {
+	srv := newTestService(t)
+	user := newTestUser(t, srv, "pinner")
+
+	var posts []*models.Post
+	for range models.MaxPinnedPosts + 1 {
+		posts = append(posts, newTestPost(t, srv, user.ID))
+	}
+
+	for _, post := range posts[:models.MaxPinnedPosts] {
+		if err := srv.PinPost(user.ID, post.ID); err != nil {
+			t.Fatalf("PinPost: %v", err)
+		}
+	}
+	if err := srv.PinPost(user.ID, posts[models.MaxPinnedPosts].ID); !errors.Is(err, database.ErrPinLimitReached) {
+		t.Errorf("expected ErrPinLimitReached past the limit, got %v", err)
+	}
+	// Pinning an already pinned post does not count it twice
+	if err := srv.PinPost(user.ID, posts[0].ID); err != nil {
+		t.Errorf("expected pinning a pinned post again to succeed, got %v", err)
+	}
+
+	// A trashed post gives its pin back
+	if err := srv.TrashPost(*posts[0]); err != nil {
+		t.Fatalf("TrashPost: %v", err)
+	}
+	if err := srv.PinPost(user.ID, posts[models.MaxPinnedPosts].ID); err != nil {
+		t.Errorf("expected a pin to be free after trashing a pinned post, got %v", err)
+	}
+}
+
+func TestTrashRestoreAndPurgePost(t *testing.T) {
+	srv := newTestService(t)
+	user := newTestUser(t, srv, "trash")
+	post := newTestPost(t, srv, user.ID)
+
+	postCount := func() int {
+		t.Helper()
+		found, err := srv.FindUserById(user.ID)
+		if err != nil {
+			t.Fatalf("FindUserById: %v", err)
+		}
+		return found.PostCount
+	}
+
+	if err := srv.TrashPost(*post); err != nil {
+		t.Fatalf("TrashPost: %v", err)
+	}
+	if _, err := srv.FindPostById(post.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected a trashed post to be hidden, got %v", err)
+	}
+	trashed, err := srv.FindTrashedPosts(user.ID, time.Now().Add(-models.TrashRetention))
+	if err != nil {
+		t.Fatalf("FindTrashedPosts: %v", err)
+	}
+	if len(trashed) != 1 || trashed[0].ID != post.ID {
+		t.Errorf("expected the post in recently deleted, got %d posts", len(trashed))
+	}
+	if count := postCount(); count != 0 {
+		t.Errorf("expected a post count of 0 once trashed, got %d", count)
+	}
+
+	if err := srv.RestorePost(*post); err != nil {
+		t.Fatalf("RestorePost: %v", err)
+	}
+	if _, err := srv.FindPostById(post.ID); err != nil {
+		t.Errorf("expected the restored post to be back, got %v", err)
+	}
+	if count := postCount(); count != 1 {
+		t.Errorf("expected a post count of 1 once restored, got %d", count)
+	}
+
+	if err := srv.TrashPost(*post); err != nil {
+		t.Fatalf("TrashPost: %v", err)
+	}
+	if err := srv.PurgePost(*post); err != nil {
+		t.Fatalf("PurgePost: %v", err)
+	}
+	if _, err := srv.FindTrashedPostById(post.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected the purged post to be gone for good, got %v", err)
+	}
+}
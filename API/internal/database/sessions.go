@@ -0,0 +1,115 @@
+package database
+
+import (
+	models "API/internal/Models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --------------------------------------------------------------
+// --------------------------- Find ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) FindSessionById(id uint) (*models.Session, error) {
+	var session models.Session
+	result := s.db.Where("id = ?", id).First(&session)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &session, nil
+}
+
+// FindActiveSessions lists the sessions of a user that are not revoked and
+// were used after since, most recently used first.
+func (s *service) FindActiveSessions(userID uint, since time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	result := s.db.Where("user_id = ? AND revoked_at IS NULL AND last_used_at > ?", userID, since).
+		Order("last_used_at DESC").
+		Find(&sessions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return sessions, nil
+}
+
+// IsKnownDevice reports whether the user logged in from the device of the
+// session before: with the same device ID, or with the same user agent from
+// the same IP or location. Before the first login there is nothing to compare
+// against, so every device counts as known.
+func (s *service) IsKnownDevice(session models.Session) (bool, error) {
+	var sessions int64
+	if err := s.db.Model(&models.Session{}).Where("user_id = ?", session.UserID).Count(&sessions).Error; err != nil {
+		return false, err
+	}
+	if sessions == 0 {
+		return true, nil
+	}
+
+	conditions := "user_agent = ? AND ip = ?"
+	args := []interface{}{session.UserAgent, session.IP}
+	if session.Location != "" {
+		conditions = "user_agent = ? AND (ip = ? OR location = ?)"
+		args = append(args, session.Location)
+	}
+	if session.DeviceHash != "" {
+		conditions = "device_hash = ? OR (" + conditions + ")"
+		args = append([]interface{}{session.DeviceHash}, args...)
+	}
+
+	var matching int64
+	result := s.db.Model(&models.Session{}).
+		Where("user_id = ?", session.UserID).
+		Where(conditions, args...).
+		Count(&matching)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return matching > 0, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Create ------------------------------
+// --------------------------------------------------------------
+
+// CreateSession records a session, with the new device alert when there is
+// one so the email goes out exactly when the session exists.
+func (s *service) CreateSession(session models.Session, alert *models.OutboxMessage) (*models.Session, error) {
+	newSession := &models.Session{
+		UserID:     session.UserID,
+		FamilyID:   session.FamilyID,
+		Device:     session.Device,
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		Location:   session.Location,
+		LastUsedAt: time.Now(),
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(newSession).Error; err != nil {
+			return err
+		}
+		if alert == nil {
+			return nil
+		}
+		return enqueueOutboxMessage(tx, alert)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newSession, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Update ------------------------------
+// --------------------------------------------------------------
+
+// TouchSession records that the session was just used from the given IP.
+func (s *service) TouchSession(familyID, ip string) error {
+	return s.db.Model(&models.Session{}).
+		Where("family_id = ?", familyID).
+		Updates(map[string]interface{}{
+			"last_used_at": time.Now(),
+			"ip":           ip,
+		}).Error
+}
@@ -0,0 +1,57 @@
+package database_test
+
+import (
+	models "API/internal/Models"
+	"testing"
+)
+
+func TestIsKnownDevice(t *testing.T) {
+	srv := newTestService(t)
+	user := newTestUser(t, srv, "device")
+	suffix := uniqueSuffix()
+
+	const firefox = "Mozilla/5.0 (Windows NT 10.0; rv:128.0) Gecko/20100101 Firefox/128.0"
+	laptop := models.Session{
+		UserID:     user.ID,
+		FamilyID:   "laptop-" + suffix,
+		Device:     "Firefox on Windows",
+		DeviceHash: "laptop-" + suffix,
+		UserAgent:  firefox,
+		IP:         "198.51.100.1",
+		Location:   "Lyon, France",
+	}
+
+	if known, err := srv.IsKnownDevice(laptop); err != nil || !known {
+		t.Fatalf("expected the first login not to be an unknown device, got %t, %v", known, err)
+	}
+	if _, err := srv.CreateSession(laptop, nil); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		edit  func(*models.Session)
+		known bool
+	}{
+		{"same device ID elsewhere", func(s *models.Session) { s.UserAgent, s.IP, s.Location = "curl/8.0", "203.0.113.9", "" }, true},
+		{"same browser from another IP in the same city", func(s *models.Session) { s.DeviceHash, s.IP = "new-"+suffix, "198.51.100.2" }, true},
+		{"same browser from the same IP", func(s *models.Session) { s.DeviceHash, s.Location = "new-"+suffix, "" }, true},
+		// Same label, but another computer in another country
+		{"another Firefox on Windows", func(s *models.Session) {
+			s.DeviceHash, s.UserAgent, s.IP, s.Location = "new-"+suffix, firefox+" extra", "203.0.113.9", "Lima, Peru"
+		}, false},
+		{"same browser from another city", func(s *models.Session) { s.DeviceHash, s.IP, s.Location = "new-"+suffix, "203.0.113.9", "Lima, Peru" }, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			session := laptop
+			tc.edit(&session)
+			known, err := srv.IsKnownDevice(session)
+			if err != nil {
+				t.Fatalf("IsKnownDevice: %v", err)
+			}
+			if known != tc.known {
+				t.Errorf("expected known to be %t", tc.known)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package database
+
+import (
+	models "API/internal/Models"
+
+	"gorm.io/gorm"
+)
+
+// --------------------------------------------------------------
+// --------------------------- Create ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) CreateStory(story models.Story) (*models.Story, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&story).Error; err != nil {
+			return err
+		}
+		return addMediaRefs(tx, story.UserID, models.MediaRefStory, story.ID, story.MediaURL, story.PosterURL)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &story, nil
+}
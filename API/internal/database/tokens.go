@@ -0,0 +1,136 @@
+package database
+
+import (
+	models "API/internal/Models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrRefreshTokenReused is returned by RotateRefreshToken when the token was
+// already exchanged, which means it leaked and the family must be revoked.
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+// --------------------------------------------------------------
+// --------------------------- Find ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) FindRefreshTokenByHash(hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	result := s.db.Where("token_hash = ?", hash).First(&token)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &token, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Create ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) CreateRefreshToken(token models.RefreshToken) (*models.RefreshToken, error) {
+	newToken := &models.RefreshToken{
+		UserID:    token.UserID,
+		FamilyID:  token.FamilyID,
+		TokenHash: token.TokenHash,
+		ExpiresAt: token.ExpiresAt,
+	}
+
+	result := s.db.Create(newToken)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return newToken, nil
+}
+
+// RotateRefreshToken marks the old token used and stores its successor. The
+// used_at check makes concurrent rotations of the same token fail with
+// ErrRefreshTokenReused instead of both succeeding.
+func (s *service) RotateRefreshToken(oldID uint, next models.RefreshToken) (*models.RefreshToken, error) {
+	var newToken *models.RefreshToken
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", oldID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		newToken = &models.RefreshToken{
+			UserID:    next.UserID,
+			FamilyID:  next.FamilyID,
+			TokenHash: next.TokenHash,
+			ExpiresAt: next.ExpiresAt,
+		}
+		return tx.Create(newToken).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newToken, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Revoke ------------------------------
+// --------------------------------------------------------------
+
+// RevokeRefreshTokenFamily ends a session: its refresh tokens stop working
+// and it disappears from the sessions list.
+func (s *service) RevokeRefreshTokenFamily(familyID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Session{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// RevokeUserRefreshTokens revokes every live refresh token of the user and
+// returns the families that were still active, so their access tokens can be
+// put on the deny-list too.
+func (s *service) RevokeUserRefreshTokens(userID uint) ([]string, error) {
+	return s.revokeUserRefreshTokens(userID, "")
+}
+
+// RevokeOtherRefreshTokens is RevokeUserRefreshTokens for every session but
+// keepFamilyID, the one the user is acting from.
+func (s *service) RevokeOtherRefreshTokens(userID uint, keepFamilyID string) ([]string, error) {
+	return s.revokeUserRefreshTokens(userID, keepFamilyID)
+}
+
+func (s *service) revokeUserRefreshTokens(userID uint, keepFamilyID string) ([]string, error) {
+	var families []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL AND expires_at > ?", userID, keepFamilyID, time.Now()).
+			Distinct().
+			Pluck("family_id", &families).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL", userID, keepFamilyID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Session{}).
+			Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL", userID, keepFamilyID).
+			Update("revoked_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return families, nil
+}
@@ -0,0 +1,126 @@
+package database_test
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newRefreshToken(t *testing.T, srv database.Service, userID uint, familyID, hash string) *models.RefreshToken {
+	t.Helper()
+
+	token, err := srv.CreateRefreshToken(models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+	return token
+}
+
+func nextRefreshToken(userID uint, familyID, hash string) models.RefreshToken {
+	return models.RefreshToken{UserID: userID, FamilyID: familyID, TokenHash: hash, ExpiresAt: time.Now().Add(time.Hour)}
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	srv := newTestService(t)
+	user := newTestUser(t, srv, "rotate")
+	family := "family-" + uniqueSuffix()
+
+	first := newRefreshToken(t, srv, user.ID, family, family+"-1")
+	second, err := srv.RotateRefreshToken(first.ID, nextRefreshToken(user.ID, family, family+"-2"))
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	if second.FamilyID != family {
+		t.Errorf("expected the successor in family %s, got %s", family, second.FamilyID)
+	}
+
+	used, err := srv.FindRefreshTokenByHash(family + "-1")
+	if err != nil {
+		t.Fatalf("FindRefreshTokenByHash: %v", err)
+	}
+	if used.UsedAt == nil {
+		t.Errorf("expected the rotated token to be marked used")
+	}
+
+	// A used token is a leaked token
+	if _, err := srv.RotateRefreshToken(first.ID, nextRefreshToken(user.ID, family, family+"-3")); !errors.Is(err, database.ErrRefreshTokenReused) {
+		t.Errorf("expected ErrRefreshTokenReused rotating a used token, got %v", err)
+	}
+	if _, err := srv.FindRefreshTokenByHash(family + "-3"); err == nil {
+		t.Errorf("the failed rotation stored a successor")
+	}
+
+	// Revoking the family ends the chain, the live successor included
+	if err := srv.RevokeRefreshTokenFamily(family); err != nil {
+		t.Fatalf("RevokeRefreshTokenFamily: %v", err)
+	}
+	if _, err := srv.RotateRefreshToken(second.ID, nextRefreshToken(user.ID, family, family+"-4")); !errors.Is(err, database.ErrRefreshTokenReused) {
+		t.Errorf("expected ErrRefreshTokenReused rotating a revoked token, got %v", err)
+	}
+}
+
+func TestRotateRefreshTokenConcurrently(t *testing.T) {
+	srv := newTestService(t)
+	user := newTestUser(t, srv, "race")
+	family := "family-" + uniqueSuffix()
+	token := newRefreshToken(t, srv, user.ID, family, family+"-0")
+
+	const attempts = 10
+	errs := make([]error, attempts)
+	var wg sync.WaitGroup
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = srv.RotateRefreshToken(token.ID, nextRefreshToken(user.ID, family, family+"-"+strconv.Itoa(i)))
+		}()
+	}
+	wg.Wait()
+
+	rotated := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			rotated++
+		case !errors.Is(err, database.ErrRefreshTokenReused):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if rotated != 1 {
+		t.Errorf("expected exactly one rotation to succeed, got %d", rotated)
+	}
+}
+
+func TestRevokeOtherRefreshTokens(t *testing.T) {
+	srv := newTestService(t)
+	user := newTestUser(t, srv, "others")
+	current := "current-" + uniqueSuffix()
+	other := "other-" + uniqueSuffix()
+	newRefreshToken(t, srv, user.ID, current, current)
+	newRefreshToken(t, srv, user.ID, other, other)
+
+	families, err := srv.RevokeOtherRefreshTokens(user.ID, current)
+	if err != nil {
+		t.Fatalf("RevokeOtherRefreshTokens: %v", err)
+	}
+	if len(families) != 1 || families[0] != other {
+		t.Errorf("expected only %s to be revoked, got %v", other, families)
+	}
+
+	kept, err := srv.FindRefreshTokenByHash(current)
+	if err != nil {
+		t.Fatalf("FindRefreshTokenByHash: %v", err)
+	}
+	if kept.RevokedAt != nil {
+		t.Errorf("the current session was revoked")
+	}
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	models "API/internal/Models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrRecoveryCodeInvalid is returned by UseRecoveryCode when the code does not
+// belong to the user or was already used.
+var ErrRecoveryCodeInvalid = errors.New("recovery code is invalid or already used")
+
+// --------------------------------------------------------------
+// --------------------------- Find ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	result := s.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return count, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Update ------------------------------
+// --------------------------------------------------------------
+
+// EnableTwoFactor stores the confirmed TOTP secret and the hashes of a fresh
+// set of recovery codes.
+func (s *service) EnableTwoFactor(userID uint, secret string, codeHashes []string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"two_factor_enabled": true,
+			"totp_secret":        secret,
+		}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+	if err != nil {
+		return err
+	}
+
+	forgetUser(userID)
+	return nil
+}
+
+// DisableTwoFactor removes the TOTP secret and every recovery code.
+func (s *service) DisableTwoFactor(userID uint) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"two_factor_enabled": false,
+			"totp_secret":        "",
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	forgetUser(userID)
+	return nil
+}
+
+// ReplaceRecoveryCodes invalidates the current recovery codes and stores new ones.
+func (s *service) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codeHashes []string) error {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+
+	codes := make([]models.RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	return tx.Create(&codes).Error
+}
+
+// UseRecoveryCode marks the code as used. A code can only be used once, even
+// by two concurrent logins.
+func (s *service) UseRecoveryCode(userID uint, codeHash string) error {
+	result := s.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	models "API/internal/Models"
+	"time"
+)
+
+// --------------------------------------------------------------
+// --------------------------- Find ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) FindUploadSession(uploadID string) (*models.UploadSession, error) {
+	var session models.UploadSession
+	result := s.db.Where("upload_id = ?", uploadID).First(&session)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &session, nil
+}
+
+// FindExpiredUploadSessions returns uploads that expired before the given time.
+func (s *service) FindExpiredUploadSessions(before time.Time, limit int) ([]models.UploadSession, error) {
+	var sessions []models.UploadSession
+	result := s.db.Where("expires_at <= ?", before).Order("expires_at ASC").Limit(limit).Find(&sessions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return sessions, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Create ------------------------------
+// --------------------------------------------------------------
+
+func (s *service) CreateUploadSession(session models.UploadSession) (*models.UploadSession, error) {
+	result := s.db.Create(&session)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &session, nil
+}
+
+// --------------------------------------------------------------
+// --------------------------- Update ------------------------------
+// --------------------------------------------------------------
+
+// UpdateUploadOffset records a received chunk and pushes the expiry back.
+func (s *service) UpdateUploadOffset(id uint, offset int64, expiresAt time.Time) error {
+	return s.db.Model(&models.UploadSession{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"offset":     offset,
+			"expires_at": expiresAt,
+		}).Error
+}
+
+// CompleteUploadSession records where the finished file was stored.
+func (s *service) CompleteUploadSession(id uint, mediaKey string, expiresAt time.Time) error {
+	return s.db.Model(&models.UploadSession{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"media_key":    mediaKey,
+			"completed_at": time.Now(),
+			"expires_at":   expiresAt,
+		}).Error
+}
+
+// --------------------------------------------------------------
+// --------------------------- Delete ------------------------------
+// --------------------------------------------------------------
+
+// ConsumeUploadSession deletes a completed upload that is being turned into
+// a post or story, the stored file now belongs to that. It reports false
+// when another request, or the expiry job, got to it first.
+func (s *service) ConsumeUploadSession(id uint) (bool, error) {
+	result := s.db.Where("id = ? AND completed_at IS NOT NULL AND expires_at > ?", id, time.Now()).Delete(&models.UploadSession{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteUploadSession reports false when the upload was used or deleted in
+// the meantime, then its files are not the caller's to remove.
+func (s *service) DeleteUploadSession(id uint) (bool, error) {
+	result := s.db.Where("id = ?", id).Delete(&models.UploadSession{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteExpiredUploadSession deletes the upload if it is still expired at
+// before. It reports false when it was used or deleted in the meantime, then
+// its files are not the caller's to remove.
+func (s *service) DeleteExpiredUploadSession(id uint, before time.Time) (bool, error) {
+	result := s.db.Where("id = ? AND expires_at <= ?", id, before).Delete(&models.UploadSession{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
@@ -0,0 +1,55 @@
+package database_test
+
+import (
+	models "API/internal/Models"
+	"API/internal/utils"
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestUserChangesDropCachedUser(t *testing.T) {
+	srv := newTestService(t)
+	ctx := context.Background()
+	user := newTestUser(t, srv, "cached")
+
+	utils.RedisClient = redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { utils.RedisClient = nil })
+
+	for _, tc := range []struct {
+		name   string
+		change func() error
+	}{
+		{"update", func() error {
+			user.Bio = "changed"
+			_, err := srv.UpdateUser(user, nil)
+			return err
+		}},
+		{"ban", func() error {
+			return srv.BanUser(user.ID, "spam", nil, models.AuditLog{
+				ActorID:      user.ID,
+				ActorRole:    models.RoleAdmin,
+				Action:       models.AuditUserBanned,
+				TargetUserID: &user.ID,
+			})
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := utils.CacheUser(ctx, &user); err != nil {
+				t.Fatalf("CacheUser: %v", err)
+			}
+			if err := tc.change(); err != nil {
+				t.Fatalf("changing the user: %v", err)
+			}
+			cached, err := utils.GetCachedUser(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("GetCachedUser: %v", err)
+			}
+			if cached != nil {
+				t.Errorf("the stale user is still cached")
+			}
+		})
+	}
+}
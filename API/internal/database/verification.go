@@ -0,0 +1,160 @@
+package database
+
+import (
+	models "API/internal/Models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrVerificationTokenInvalid is returned by VerifyEmail when the token does
+// not exist, has expired or was already used.
+var ErrVerificationTokenInvalid = errors.New("email verification token is invalid or has expired")
+
+// ErrEmailTaken is returned by VerifyEmail when the pending address was
+// claimed by another account while it waited for verification.
+var ErrEmailTaken = errors.New("email address is already in use")
+
+// --------------------------------------------------------------
+// --------------------------- Create ------------------------------
+// --------------------------------------------------------------
+
+// EmailVerification is a verification token and the email carrying it. The
+// change asking for them saves both in its transaction, so the email goes
+// out exactly when the change is made.
+type EmailVerification struct {
+	Token models.EmailVerificationToken
+	Email models.OutboxMessage
+}
+
+// CreateEmailVerificationToken stores a new verification token for the user
+// together with the email carrying it. Links sent earlier stop working so
+// only the latest email can be used.
+func (s *service) CreateEmailVerificationToken(token models.EmailVerificationToken, email models.OutboxMessage) (*models.EmailVerificationToken, error) {
+	verification := &EmailVerification{Token: token, Email: email}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return createEmailVerification(tx, token.UserID, verification)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &verification.Token, nil
+}
+
+// createEmailVerification saves the verification for userID, see
+// CreateEmailVerificationToken. The user may have been created in tx.
+func createEmailVerification(tx *gorm.DB, userID uint, verification *EmailVerification) error {
+	verification.Token = models.EmailVerificationToken{
+		UserID:    userID,
+		Email:     verification.Token.Email,
+		TokenHash: verification.Token.TokenHash,
+		ExpiresAt: verification.Token.ExpiresAt,
+	}
+	// Both start over when a rolled back transaction is retried
+	verification.Email.ID = 0
+	verification.Email.UserID = &userID
+
+	if err := tx.Model(&models.EmailVerificationToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error; err != nil {
+		return err
+	}
+	if err := tx.Create(&verification.Token).Error; err != nil {
+		return err
+	}
+	return enqueueOutboxMessage(tx, &verification.Email)
+}
+
+// --------------------------------------------------------------
+// --------------------------- Update ------------------------------
+// --------------------------------------------------------------
+
+// SetPendingEmail records the address the user wants to switch to. Their
+// current email keeps working until the new one is verified.
+func (s *service) SetPendingEmail(userID uint, email string) error {
+	if err := s.db.Model(&models.User{}).Where("id = ?", userID).Update("pending_email", email).Error; err != nil {
+		return err
+	}
+	forgetUser(userID)
+	return nil
+}
+
+// VerifyEmail consumes the verification token with the given hash and marks
+// its address as the user's verified email.
+func (s *service) VerifyEmail(tokenHash string) (*models.User, error) {
+	var user models.User
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var token models.EmailVerificationToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", tokenHash).
+			First(&token).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrVerificationTokenInvalid
+			}
+			return err
+		}
+
+		if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+			return ErrVerificationTokenInvalid
+		}
+
+		if err := tx.Model(&token).Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("id = ?", token.UserID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrVerificationTokenInvalid
+			}
+			return err
+		}
+
+		updates := map[string]interface{}{
+			"email_verified": true,
+		}
+
+		if token.Email != user.Email {
+			var taken int64
+			if err := tx.Model(&models.User{}).
+				Where("email = ? AND id <> ?", token.Email, user.ID).
+				Count(&taken).Error; err != nil {
+				return err
+			}
+			if taken > 0 {
+				return ErrEmailTaken
+			}
+			updates["email"] = token.Email
+		}
+		if user.PendingEmail == token.Email {
+			updates["pending_email"] = ""
+		}
+
+		return tx.Model(&user).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	forgetUser(user.ID)
+	return &user, nil
+}
+
+// MarkPhoneVerified flags the user's phone as verified, as long as it is
+// still the number the code was sent to.
+func (s *service) MarkPhoneVerified(userID uint, phone string) error {
+	result := s.db.Model(&models.User{}).
+		Where("id = ? AND phone = ?", userID, phone).
+		Update("phone_verified", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	forgetUser(userID)
+	return nil
+}
@@ -0,0 +1,136 @@
+package database_test
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newVerification(email, hash string) *database.EmailVerification {
+	return &database.EmailVerification{
+		Token: models.EmailVerificationToken{
+			Email:     email,
+			TokenHash: hash,
+			ExpiresAt: time.Now().Add(models.EmailVerificationTTL),
+		},
+		Email: models.OutboxMessage{Template: "verify_email", Recipient: email, Payload: "{}"},
+	}
+}
+
+// countVerificationEmails counts the tokens and queued emails of the user.
+func countVerificationEmails(t *testing.T, srv database.Service, userID uint) (int64, int64) {
+	t.Helper()
+
+	var tokens, emails int64
+	if err := srv.GetDB().Model(&models.EmailVerificationToken{}).Where("user_id = ?", userID).Count(&tokens).Error; err != nil {
+		t.Fatalf("counting tokens: %v", err)
+	}
+	if err := srv.GetDB().Model(&models.OutboxMessage{}).Where("user_id = ?", userID).Count(&emails).Error; err != nil {
+		t.Fatalf("counting emails: %v", err)
+	}
+	return tokens, emails
+}
+
+func TestCreateUserQueuesVerification(t *testing.T) {
+	srv := newTestService(t)
+	suffix := uniqueSuffix()
+	email := "register" + suffix + "@example.com"
+
+	user, err := srv.CreateUser(models.User{
+		Username: "register" + suffix,
+		Name:     "register",
+		Email:    email,
+		Password: "password",
+		Token:    "token",
+		Language: "en",
+	}, newVerification(email, "register-"+suffix))
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if tokens, emails := countVerificationEmails(t, srv, user.ID); tokens != 1 || emails != 1 {
+		t.Errorf("expected a token and an email for the new account, got %d and %d", tokens, emails)
+	}
+
+	// The username is taken now: no account, and so no email either
+	if _, err := srv.CreateUser(models.User{
+		Username: "register" + suffix,
+		Name:     "register",
+		Email:    "other" + suffix + "@example.com",
+		Password: "password",
+		Token:    "token",
+		Language: "en",
+	}, newVerification("other"+suffix+"@example.com", "other-"+suffix)); err == nil {
+		t.Fatalf("expected a duplicate username to fail")
+	}
+	var orphans int64
+	if err := srv.GetDB().Model(&models.OutboxMessage{}).Where("recipient = ?", "other"+suffix+"@example.com").Count(&orphans).Error; err != nil {
+		t.Fatalf("counting emails: %v", err)
+	}
+	if orphans != 0 {
+		t.Errorf("a failed registration queued %d emails", orphans)
+	}
+}
+
+func TestUpdateUserQueuesVerification(t *testing.T) {
+	srv := newTestService(t)
+	user := newTestUser(t, srv, "change")
+	email := "new" + uniqueSuffix() + "@example.com"
+
+	user.PendingEmail = email
+	if _, err := srv.UpdateUser(user, newVerification(email, "change-"+uniqueSuffix())); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if tokens, emails := countVerificationEmails(t, srv, user.ID); tokens != 1 || emails != 1 {
+		t.Errorf("expected a token and an email for the new address, got %d and %d", tokens, emails)
+	}
+}
+
+func TestVerifyEmailTokenIsSingleUse(t *testing.T) {
+	srv := newTestService(t)
+	user := newTestUser(t, srv, "verify")
+	hash := "verify-" + uniqueSuffix()
+
+	verification := newVerification(user.Email, hash)
+	verification.Token.UserID = user.ID
+	if _, err := srv.CreateEmailVerificationToken(verification.Token, verification.Email); err != nil {
+		t.Fatalf("CreateEmailVerificationToken: %v", err)
+	}
+
+	verified, err := srv.VerifyEmail(hash)
+	if err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if !verified.EmailVerified {
+		t.Errorf("expected the email to be verified")
+	}
+
+	if _, err := srv.VerifyEmail(hash); !errors.Is(err, database.ErrVerificationTokenInvalid) {
+		t.Errorf("expected ErrVerificationTokenInvalid using the link twice, got %v", err)
+	}
+}
+
+func TestVerifyEmailTokenExpires(t *testing.T) {
+	srv := newTestService(t)
+	user := newTestUser(t, srv, "expired")
+	hash := "expired-" + uniqueSuffix()
+
+	verification := newVerification(user.Email, hash)
+	verification.Token.UserID = user.ID
+	verification.Token.ExpiresAt = time.Now().Add(-time.Minute)
+	if _, err := srv.CreateEmailVerificationToken(verification.Token, verification.Email); err != nil {
+		t.Fatalf("CreateEmailVerificationToken: %v", err)
+	}
+
+	if _, err := srv.VerifyEmail(hash); !errors.Is(err, database.ErrVerificationTokenInvalid) {
+		t.Errorf("expected ErrVerificationTokenInvalid for an expired link, got %v", err)
+	}
+	found, err := srv.FindUserById(user.ID)
+	if err != nil {
+		t.Fatalf("FindUserById: %v", err)
+	}
+	if found.EmailVerified {
+		t.Errorf("an expired link verified the email")
+	}
+}
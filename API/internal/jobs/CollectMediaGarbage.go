@@ -0,0 +1,57 @@
+package jobs
+
+import (
+	"API/internal/database"
+	"API/internal/media"
+	"context"
+	"log"
+	"time"
+)
+
+// collectBatchSize is how many orphaned assets are loaded per query
+const collectBatchSize = 100
+
+// CollectMediaGarbage deletes stored files nothing has referred to for the
+// grace period: replaced avatars, uploads of failed registrations and posts,
+// originals of processed videos and the media of purged posts.
+func CollectMediaGarbage(db database.Service, store media.MediaStore, grace time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		before := time.Now().Add(-grace)
+		collected := 0
+		var freed int64
+
+		for ctx.Err() == nil {
+			assets, err := db.FindOrphanedMediaAssets(before, collectBatchSize, 0)
+			if err != nil {
+				return err
+			}
+
+			for _, asset := range assets {
+				// The row goes first, if the asset was just put to use again it stays
+				deleted, err := db.DeleteOrphanedMediaAsset(asset.ID, before)
+				if err != nil {
+					return err
+				}
+				if !deleted {
+					continue
+				}
+
+				if err := store.Delete(ctx, asset.Key); err != nil {
+					log.Printf("Error deleting orphaned media %s: %v", asset.Key, err)
+					continue
+				}
+				collected++
+				freed += asset.Size
+			}
+
+			if len(assets) < collectBatchSize {
+				break
+			}
+		}
+
+		if collected > 0 {
+			log.Printf("Deleted %d orphaned media files, %d bytes", collected, freed)
+		}
+		return nil
+	}
+}
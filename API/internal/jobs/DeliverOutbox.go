@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/mail"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// deliverTimeout bounds one delivery, well below models.OutboxSendTimeout
+// so a slow server does not get the message picked up twice.
+const deliverTimeout = time.Minute
+
+// DeliverOutbox sends the emails waiting in the outbox until none is due. A
+// failed delivery is retried after models.OutboxRetryDelay, doubling every
+// time, and dead-lettered after models.MaxOutboxAttempts or right away when
+// retrying cannot help, e.g. the email cannot be rendered.
+func DeliverOutbox(db database.Service, emails *mail.Emails) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		for ctx.Err() == nil {
+			msg, err := db.ClaimOutboxMessage(time.Now().Add(-models.OutboxSendTimeout))
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := deliverOutboxMessage(ctx, db, emails, *msg); err != nil {
+				log.Printf("Error delivering %s email %d: %v", msg.Template, msg.ID, err)
+			}
+		}
+		return nil
+	}
+}
+
+func deliverOutboxMessage(ctx context.Context, db database.Service, emails *mail.Emails, msg models.OutboxMessage) error {
+	email, err := mail.FromOutbox(msg)
+	if err == nil {
+		sendCtx, cancel := context.WithTimeout(ctx, deliverTimeout)
+		err = emails.Send(sendCtx, email)
+		cancel()
+	}
+	if err != nil {
+		return failOutboxMessage(db, msg, err)
+	}
+	return db.MarkOutboxMessageSent(msg.ID)
+}
+
+// failOutboxMessage schedules the next attempt, or dead-letters the message.
+func failOutboxMessage(db database.Service, msg models.OutboxMessage, cause error) error {
+	if !errors.Is(cause, mail.ErrInvalidEmail) && msg.Attempts < models.MaxOutboxAttempts {
+		retryAt := time.Now().Add(models.OutboxRetryDelay << (msg.Attempts - 1))
+		if err := db.RetryOutboxMessage(msg.ID, cause.Error(), retryAt); err != nil {
+			return err
+		}
+		return cause
+	}
+
+	if err := db.DeadLetterOutboxMessage(msg.ID, cause.Error()); err != nil {
+		return err
+	}
+	return cause
+}
+
+// PruneOutbox removes the messages sent longer than models.OutboxRetention ago.
+func PruneOutbox(db database.Service) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		pruned, err := db.DeleteSentOutboxMessages(time.Now().Add(-models.OutboxRetention))
+		if err != nil {
+			return err
+		}
+		if pruned > 0 {
+			log.Printf("Removed %d sent emails from the outbox", pruned)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,59 @@
+package jobs
+
+import (
+	"API/internal/database"
+	"API/internal/media"
+	"context"
+	"log"
+	"time"
+)
+
+// expireBatchSize is how many expired uploads are loaded per query
+const expireBatchSize = 100
+
+// ExpireUploads removes resumable and direct uploads that were abandoned, or
+// finished but never used in a post, story or avatar, with their spooled
+// chunks and stored file.
+func ExpireUploads(db database.Service, store media.MediaStore, spool *media.Spool) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		now := time.Now()
+		expired := 0
+
+		for ctx.Err() == nil {
+			sessions, err := db.FindExpiredUploadSessions(now, expireBatchSize)
+			if err != nil {
+				return err
+			}
+
+			for _, session := range sessions {
+				// Deleting the row first means a post created from it at the same time keeps its file
+				deleted, err := db.DeleteExpiredUploadSession(session.ID, now)
+				if err != nil {
+					return err
+				}
+				if !deleted {
+					continue
+				}
+				expired++
+
+				if err := spool.Remove(session.UploadID); err != nil {
+					log.Printf("Error removing spooled upload %s: %v", session.UploadID, err)
+				}
+				if session.MediaKey != "" {
+					if err := store.Delete(ctx, session.MediaKey); err != nil {
+						log.Printf("Error deleting %s of expired upload %s: %v", session.MediaKey, session.UploadID, err)
+					}
+				}
+			}
+
+			if len(sessions) < expireBatchSize {
+				break
+			}
+		}
+
+		if expired > 0 {
+			log.Printf("Removed %d expired uploads", expired)
+		}
+		return nil
+	}
+}
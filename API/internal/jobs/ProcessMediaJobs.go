@@ -0,0 +1,154 @@
+package jobs
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/media"
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// errBlockedVideo fails a job whose poster frame is on the image blocklist.
+var errBlockedVideo = errors.New("this video cannot be uploaded")
+
+// ProcessMediaJobs works through the queue of uploaded videos until it is
+// empty. A failed attempt is retried with a growing delay, up to
+// models.MaxMediaJobAttempts, unless retrying cannot help, e.g. the file is
+// not a video at all.
+func ProcessMediaJobs(db database.Service, store media.MediaStore, processor media.VideoProcessor) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		for ctx.Err() == nil {
+			job, err := db.ClaimMediaJob(time.Now().Add(-models.MediaJobTimeout))
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := runMediaJob(ctx, db, store, processor, *job); err != nil {
+				log.Printf("Error processing media job %d: %v", job.ID, err)
+			}
+		}
+		return nil
+	}
+}
+
+func runMediaJob(ctx context.Context, db database.Service, store media.MediaStore, processor media.VideoProcessor, job models.MediaJob) error {
+	folder, maxDuration := "posts", models.MaxPostVideoDuration
+	if job.TargetType == models.MediaJobTargetStory {
+		folder, maxDuration = "stories", models.MaxStoryVideoDuration
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, models.MediaJobTimeout)
+	defer cancel()
+
+	video, err := media.ProcessVideo(jobCtx, processor, store, db, job.SourceKey, folder, maxDuration)
+	if err != nil {
+		return failMediaJob(ctx, db, store, job, err)
+	}
+	if err := recordVideoAssets(db, job.UserID, video); err != nil {
+		for _, key := range video.Keys() {
+			if err := store.Delete(ctx, key); err != nil {
+				log.Printf("Error deleting %s of media job %d: %v", key, job.ID, err)
+			}
+		}
+		return failMediaJob(ctx, db, store, job, err)
+	}
+
+	duration := video.Info.Duration.Seconds()
+	switch job.TargetType {
+	case models.MediaJobTargetPost:
+		ratio := math.Min(math.Max(video.Info.AspectRatio(), models.MinAspectRatio), models.MaxAspectRatio)
+		err = db.CompletePostVideo(job, models.PostMedia{
+			URL:          video.Video.URL,
+			MediumURL:    video.Frames["medium"].URL,
+			ThumbnailURL: video.Frames["thumbnail"].URL,
+			PosterURL:    video.Frames["full"].URL,
+			Width:        video.Info.Width,
+			Height:       video.Info.Height,
+			BlurHash:     video.Poster.BlurHash,
+			Duration:     duration,
+		}, ratio)
+	default:
+		err = db.CompleteStoryVideo(job, video.Video.URL, video.Frames["full"].URL, duration)
+	}
+	if err != nil {
+		// The files are recorded, the garbage collector removes them
+		return failMediaJob(ctx, db, store, job, err)
+	}
+
+	// The original is not needed anymore, a leftover is only wasted space
+	if err := store.Delete(ctx, job.SourceKey); err != nil {
+		log.Printf("Error deleting the original of media job %d: %v", job.ID, err)
+	}
+	return nil
+}
+
+// recordVideoAssets registers the rendition and poster frames as media
+// assets, completing the post or story then references them. A poster frame
+// resembling a blocklist entry fails the job or queues the video for the
+// moderators, like a photo would.
+func recordVideoAssets(db database.Service, userID uint, video *media.ProcessedVideo) error {
+	hash := int64(video.Poster.DHash)
+	match, err := db.MatchBlockedImage(hash)
+	if err != nil {
+		return err
+	}
+	if match != nil && match.Action == models.BlockActionReject {
+		return errBlockedVideo
+	}
+	var review *uint
+	if match != nil {
+		review = &match.ID
+	}
+
+	assets := make([]models.MediaAsset, 0, 1+len(video.Frames))
+	for _, file := range video.Files() {
+		asset := models.MediaAsset{
+			Key:         file.Key,
+			URL:         file.URL,
+			UserID:      &userID,
+			ContentType: media.ContentTypeOf(file.Key),
+			Size:        file.Size,
+			SHA256:      file.SHA256,
+			ReviewMatch: review,
+		}
+		if file.Key != video.Video.Key {
+			asset.DHash = &hash
+		}
+		assets = append(assets, asset)
+	}
+	return db.RecordMediaAssets(assets)
+}
+
+// failMediaJob schedules a retry, 1 then 4 minutes later, or gives up and
+// removes the original upload.
+func failMediaJob(ctx context.Context, db database.Service, store media.MediaStore, job models.MediaJob, cause error) error {
+	permanent := errors.Is(cause, errBlockedVideo) ||
+		errors.Is(cause, media.ErrUnsupportedVideo) ||
+		errors.Is(cause, media.ErrVideoTooLong) ||
+		errors.Is(cause, media.ErrNotFound) ||
+		errors.Is(cause, gorm.ErrRecordNotFound)
+
+	if !permanent && job.Attempts < models.MaxMediaJobAttempts {
+		retryAt := time.Now().Add(time.Duration(job.Attempts*job.Attempts) * time.Minute)
+		if err := db.RetryMediaJob(job, cause.Error(), retryAt); err != nil {
+			return err
+		}
+		return cause
+	}
+
+	if err := db.FailMediaJob(job, cause.Error()); err != nil {
+		return err
+	}
+	if err := store.Delete(ctx, job.SourceKey); err != nil {
+		log.Printf("Error deleting the original of media job %d: %v", job.ID, err)
+	}
+	return cause
+}
@@ -0,0 +1,81 @@
+package jobs
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/media"
+	"context"
+	"log"
+	"time"
+)
+
+// purgeBatchSize is how many expired posts are loaded per query
+const purgeBatchSize = 100
+
+// PurgeTrashedPosts hard-deletes posts that have been in "recently deleted"
+// for longer than models.TrashRetention. Files recorded as media assets may
+// be shared and are left to the garbage collector, older ones are deleted
+// here. A post whose files cannot be deleted is left for the next run.
+func PurgeTrashedPosts(db database.Service, store media.MediaStore) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		cutoff := time.Now().Add(-models.TrashRetention)
+		purged := 0
+		// Posts that failed stay behind the cursor, so they cannot fill every batch
+		var lastID uint
+
+		for ctx.Err() == nil {
+			posts, err := db.FindExpiredTrashedPosts(cutoff, lastID, purgeBatchSize)
+			if err != nil {
+				return err
+			}
+
+			for _, post := range posts {
+				lastID = post.ID
+				if err := deletePostAssets(ctx, db, store, post); err != nil {
+					log.Printf("Error deleting assets of post %d: %v", post.ID, err)
+					continue
+				}
+
+				if err := db.PurgePost(post); err != nil {
+					return err
+				}
+				purged++
+			}
+
+			if len(posts) < purgeBatchSize {
+				break
+			}
+		}
+
+		if purged > 0 {
+			log.Printf("Purged %d expired posts from recently deleted", purged)
+		}
+		return nil
+	}
+}
+
+func deletePostAssets(ctx context.Context, db database.Service, store media.MediaStore, post models.Post) error {
+	urls := append([]string{}, post.MediaURLs...)
+	for _, item := range post.Media {
+		urls = append(urls, item.URL, item.MediumURL, item.ThumbnailURL, item.PosterURL)
+	}
+
+	var keys []string
+	for _, url := range urls {
+		// Not stored by us, nothing to clean up
+		if key, ok := store.KeyFromURL(url); ok {
+			keys = append(keys, key)
+		}
+	}
+
+	untracked, err := db.FindUntrackedMediaKeys(keys)
+	if err != nil {
+		return err
+	}
+	for _, key := range untracked {
+		if err := store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/mail"
+	"API/internal/utils"
+	"context"
+	"log"
+	"time"
+)
+
+// digestBatchSize is how many digest recipients are loaded per query
+const digestBatchSize = 100
+
+// SendDigests queues the weekly digest of every user it is due for, each in
+// the hour models.DigestHour of their time zone. It should run several times
+// an hour so no hour is missed, a digest is only ever sent once a week.
+// Users with nothing new get no email but are still done for the week.
+func SendDigests(db database.Service, emails *mail.Emails) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		now := time.Now()
+		queued := 0
+
+		for ctx.Err() == nil {
+			// Users leave the result once their digest is recorded, no offset needed
+			users, err := db.FindDigestRecipients(now, digestBatchSize)
+			if err != nil {
+				return err
+			}
+
+			for i := range users {
+				user := &users[i]
+				activity, err := db.FindDigestActivity(user.ID, now.Add(-models.DigestPeriod))
+				if err != nil {
+					return err
+				}
+
+				var msg *models.OutboxMessage
+				if !activity.Empty() {
+					email, err := emails.WeeklyDigest(mail.To(user), user.ID, *activity, utils.SignUnsubscribe(user.ID)).Outbox(user.ID)
+					if err != nil {
+						return err
+					}
+					msg = &email
+				}
+
+				recorded, err := db.RecordDigest(user.ID, msg, now)
+				if err != nil {
+					return err
+				}
+				if recorded && msg != nil {
+					queued++
+				}
+			}
+
+			if len(users) < digestBatchSize {
+				break
+			}
+		}
+
+		if queued > 0 {
+			log.Printf("Queued %d weekly digests", queued)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Every runs fn once per interval until ctx is cancelled. The first run
+// happens after one interval so startup (and migrations) can finish first.
+func Every(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("job %s stopped", name)
+			return
+		case <-ticker.C:
+			start := time.Now()
+			if err := fn(ctx); err != nil {
+				log.Printf("job %s failed after %s: %v", name, time.Since(start), err)
+			}
+		}
+	}
+}
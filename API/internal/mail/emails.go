@@ -0,0 +1,142 @@
+package mail
+
+import (
+	models "API/internal/Models"
+	"context"
+	"fmt"
+	"html"
+	"net/url"
+	"time"
+	"unicode/utf8"
+)
+
+// Recipient is who an email goes to, Language is User.Language.
+type Recipient struct {
+	Email    string `json:"email"`
+	Name     string `json:"name,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+// To addresses an email to the user, in their language.
+func To(user *models.User) Recipient {
+	return Recipient{Email: user.Email, Name: user.Name, Language: user.Language}
+}
+
+// Email is an email before rendering, which is what the outbox keeps until
+// it is delivered. Template names the files in templates/<language>/.
+type Email struct {
+	Template string    `json:"template"`
+	To       Recipient `json:"to"`
+	Data     Data      `json:"data"`
+}
+
+// Emails builds the emails of the API and sends them with a Mailer, in the
+// language of the recipient.
+type Emails struct {
+	mailer     Mailer
+	templates  *Templates
+	baseURL    string
+	apiBaseURL string
+}
+
+// NewEmails loads the templates. Links in the emails point to the app at
+// baseURL, the ones the API handles itself to apiBaseURL.
+func NewEmails(mailer Mailer, baseURL, apiBaseURL string) (*Emails, error) {
+	templates, err := LoadTemplates()
+	if err != nil {
+		return nil, err
+	}
+	return &Emails{mailer: mailer, templates: templates, baseURL: baseURL, apiBaseURL: apiBaseURL}, nil
+}
+
+// Send renders the email and hands it to the mailer.
+func (e *Emails) Send(ctx context.Context, email Email) error {
+	data := email.Data
+	data.Name = email.To.Name
+	msg, err := e.templates.Render(email.Template, e.templates.Language(email.To.Language), data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+	}
+	msg.To = email.To.Email
+	return e.mailer.Send(ctx, msg)
+}
+
+// formatTime is how times show in emails, users have no time zone setting.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC1123)
+}
+
+// Verification is the link confirming to.Email.
+func (e *Emails) Verification(to Recipient, token string) Email {
+	return Email{Template: "verify_email", To: to, Data: Data{
+		Link: e.baseURL + "/auth/verify/" + url.PathEscape(token),
+	}}
+}
+
+// PasswordReset is the link to choose a new password.
+func (e *Emails) PasswordReset(to Recipient, token string) Email {
+	return Email{Template: "password_reset", To: to, Data: Data{
+		Link: e.baseURL + "/reset-password?token=" + url.QueryEscape(token),
+	}}
+}
+
+// NewDeviceLogin warns a user that their account was accessed from a device
+// it had never been used on before.
+func (e *Emails) NewDeviceLogin(to Recipient, device, location, ip string, at time.Time) Email {
+	return Email{Template: "new_device_login", To: to, Data: Data{
+		Device:   device,
+		Location: location,
+		IP:       ip,
+		Time:     formatTime(at),
+	}}
+}
+
+// AccountLocked tells a user that logins to their account were paused after
+// too many wrong passwords.
+func (e *Emails) AccountLocked(to Recipient, ip string, until time.Time) Email {
+	return Email{Template: "account_locked", To: to, Data: Data{
+		IP:    ip,
+		Until: formatTime(until),
+	}}
+}
+
+// digestCaptionLength is how much of a caption the digest shows
+const digestCaptionLength = 100
+
+// WeeklyDigest sums up the activity of the past week for userID, with a
+// one-click unsubscribe link signed by signature, see
+// utils.SignUnsubscribe.
+func (e *Emails) WeeklyDigest(to Recipient, userID uint, activity models.DigestActivity, signature string) Email {
+	digest := &Digest{
+		NewFollowers: activity.NewFollowers,
+		Unread:       activity.UnreadNotifications,
+	}
+	for _, post := range activity.TopPosts {
+		item := DigestPost{
+			Author:   post.User.Username,
+			Caption:  truncate(html.UnescapeString(post.Caption), digestCaptionLength), // Stored escaped, the templates escape it again
+			Link:     fmt.Sprintf("%s/posts/%d", e.baseURL, post.ID),
+			Likes:    post.LikesCount,
+			Comments: post.CommentsCount,
+		}
+		if len(post.Media) > 0 {
+			item.ImageURL = post.Media[0].ThumbnailURL
+		}
+		digest.Posts = append(digest.Posts, item)
+	}
+
+	return Email{Template: "weekly_digest", To: to, Data: Data{
+		Link:        e.baseURL,
+		Unsubscribe: fmt.Sprintf("%s/api/v1/digest/unsubscribe?user=%d&sig=%s", e.apiBaseURL, userID, url.QueryEscape(signature)),
+		Digest:      digest,
+	}}
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
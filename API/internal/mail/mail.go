@@ -0,0 +1,84 @@
+// Package mail sends the emails of the API. Controllers build them with
+// Emails and queue them in the outbox, the outbox job then renders them in
+// the language of the recipient and hands them to the Mailer picked by
+// MAIL_BACKEND, so development and tests never need a real SMTP account.
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Message is a rendered email, with an HTML body and its plain text
+// alternative.
+type Message struct {
+	To          string
+	Subject     string
+	HTML        string
+	Text        string
+	Unsubscribe string // One-click unsubscribe URL, for emails users opted in to
+}
+
+// ErrInvalidEmail is returned for emails that cannot be rendered or
+// addressed, sending them again cannot help.
+var ErrInvalidEmail = errors.New("invalid email")
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config selects and configures the backend.
+type Config struct {
+	Backend string // smtp or memory
+
+	From       string // Sender, either an address or "Name <address>"
+	BaseURL    string // The app links in emails point to, without a trailing slash
+	APIBaseURL string // This API, for links handled by it like unsubscribing
+
+	// smtp
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// ConfigFromEnv reads the MAIL_*, SMTP_*, APP_BASE_URL and API_BASE_URL
+// variables. The memory backend is the default so a fresh checkout works
+// without any account. API_BASE_URL defaults to APP_BASE_URL, for apps
+// served from the same host as the API.
+func ConfigFromEnv() Config {
+	baseURL := strings.TrimRight(getenv("APP_BASE_URL", "http://localhost:8090"), "/")
+	return Config{
+		Backend:      getenv("MAIL_BACKEND", "memory"),
+		From:         getenv("MAIL_FROM", "API <no-reply@localhost>"),
+		BaseURL:      baseURL,
+		APIBaseURL:   strings.TrimRight(getenv("API_BASE_URL", baseURL), "/"),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     getenv("SMTP_PORT", "587"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+	}
+}
+
+// New builds the configured backend.
+func New(cfg Config) (Mailer, error) {
+	switch cfg.Backend {
+	case "smtp":
+		return NewSMTPMailer(cfg)
+	case "memory":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_BACKEND %q, expected smtp or memory", cfg.Backend)
+	}
+}
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
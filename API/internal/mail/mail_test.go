@@ -0,0 +1,199 @@
+package mail
+
+import (
+	models "API/internal/Models"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestEmails(t *testing.T) (*Emails, *MemoryMailer) {
+	t.Helper()
+	mailer := NewMemoryMailer()
+	emails, err := NewEmails(mailer, "https://example.com", "https://api.example.com")
+	if err != nil {
+		t.Fatalf("NewEmails: %v", err)
+	}
+	return emails, mailer
+}
+
+func TestEmailsAreLocalized(t *testing.T) {
+	ctx := context.Background()
+	emails, mailer := newTestEmails(t)
+
+	for _, to := range []Recipient{
+		{Email: "ana@example.com", Name: "Ana", Language: "es"},
+		{Email: "louis@example.com", Name: "Louis", Language: "fr-CA"},
+		{Email: "jan@example.com", Name: "Jan", Language: "de"},
+	} {
+		if err := emails.Send(ctx, emails.PasswordReset(to, "tok+en")); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	sent := mailer.Sent()
+	if len(sent) != 3 {
+		t.Fatalf("expected 3 emails, got %d", len(sent))
+	}
+	for i, subject := range []string{"Restablece tu contraseña", "Réinitialisez votre mot de passe", "Reset your password"} {
+		if sent[i].Subject != subject {
+			t.Errorf("expected subject %q, got %q", subject, sent[i].Subject)
+		}
+		link := "https://example.com/reset-password?token=tok%2Ben"
+		if !strings.Contains(sent[i].Text, link) {
+			t.Errorf("text of %s lacks the link:\n%s", sent[i].To, sent[i].Text)
+		}
+		if !strings.Contains(sent[i].HTML, `href="`+link+`"`) {
+			t.Errorf("HTML of %s lacks the link:\n%s", sent[i].To, sent[i].HTML)
+		}
+	}
+	if !strings.Contains(sent[1].HTML, `<html lang="fr">`) || !strings.Contains(sent[1].Text, "Bonjour Louis") {
+		t.Errorf("expected a French email for fr-CA, got:\n%s", sent[1].HTML)
+	}
+}
+
+func TestEmailsEscapeHTML(t *testing.T) {
+	emails, mailer := newTestEmails(t)
+
+	to := Recipient{Email: "eve@example.com", Name: "Eve", Language: "en"}
+	if err := emails.Send(context.Background(), emails.NewDeviceLogin(to, "<script>alert(1)</script>", "", "203.0.113.7", time.Now())); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	msg := mailer.Sent()[0]
+	if strings.Contains(msg.HTML, "<script>") {
+		t.Errorf("device name was not escaped:\n%s", msg.HTML)
+	}
+	if !strings.Contains(msg.Text, "<script>alert(1)</script>") {
+		t.Errorf("plain text should keep the device name as is:\n%s", msg.Text)
+	}
+	if !strings.Contains(msg.Text, "Unknown location") {
+		t.Errorf("expected the unknown location fallback:\n%s", msg.Text)
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	from := &netmail.Address{Name: "API", Address: "no-reply@example.com"}
+	data, err := buildMessage(from, Message{
+		To:      "louis@example.com",
+		Subject: "Réinitialisez votre mot de passe",
+		Text:    "Bonjour Louis\n",
+		HTML:    "<p>Bonjour Louis</p>",
+	}, time.Now())
+	if err != nil {
+		t.Fatalf("buildMessage: %v", err)
+	}
+
+	parsed, err := netmail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != "Réinitialisez votre mot de passe" {
+		t.Errorf("subject did not survive encoding: %q, %v", subject, err)
+	}
+	if !strings.HasSuffix(parsed.Header.Get("Message-ID"), "@example.com>") {
+		t.Errorf("unexpected Message-ID %q", parsed.Header.Get("Message-ID"))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected Content-Type %q", parsed.Header.Get("Content-Type"))
+	}
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, expected := range []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", "Bonjour Louis\r\n"}, // Line breaks go out as CRLF
+		{"text/html; charset=UTF-8", "<p>Bonjour Louis</p>"},
+	} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("NextPart: %v", err)
+		}
+		// NextPart decodes the quoted-printable
+		body, _ := io.ReadAll(part)
+		if part.Header.Get("Content-Type") != expected.contentType || string(body) != expected.body {
+			t.Errorf("expected %s %q, got %s %q", expected.contentType, expected.body, part.Header.Get("Content-Type"), body)
+		}
+	}
+}
+
+func TestOutboxRoundTrip(t *testing.T) {
+	emails, mailer := newTestEmails(t)
+
+	to := Recipient{Email: "louis@example.com", Name: "Louis", Language: "fr"}
+	msg, err := emails.Verification(to, "abc").Outbox(42)
+	if err != nil {
+		t.Fatalf("Outbox: %v", err)
+	}
+	if msg.UserID == nil || *msg.UserID != 42 || msg.Recipient != to.Email || msg.Template != "verify_email" {
+		t.Errorf("unexpected outbox message %+v", msg)
+	}
+
+	email, err := FromOutbox(msg)
+	if err != nil {
+		t.Fatalf("FromOutbox: %v", err)
+	}
+	if err := emails.Send(context.Background(), email); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	sent := mailer.Sent()[0]
+	if sent.Subject != "Confirmez votre adresse e-mail" || !strings.Contains(sent.Text, "https://example.com/auth/verify/abc") {
+		t.Errorf("the email changed on its way through the outbox: %+v", sent)
+	}
+
+	if _, err := FromOutbox(models.OutboxMessage{Payload: "not json"}); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("expected ErrInvalidEmail for a broken payload, got %v", err)
+	}
+}
+
+func TestWeeklyDigest(t *testing.T) {
+	emails, mailer := newTestEmails(t)
+
+	activity := models.DigestActivity{
+		NewFollowers: 1,
+		TopPosts: []models.Post{{
+			ID:         7,
+			User:       models.User{Username: "louis"},
+			Caption:    "Fish &amp; chips", // Stored escaped
+			LikesCount: 12,
+			Media:      []models.PostMedia{{ThumbnailURL: "https://cdn.example.com/t.jpg"}},
+		}},
+		UnreadNotifications: 5,
+	}
+	to := Recipient{Email: "ana@example.com", Name: "Ana", Language: "en"}
+	if err := emails.Send(context.Background(), emails.WeeklyDigest(to, 42, activity, "s+g")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	msg := mailer.Sent()[0]
+	if msg.Unsubscribe != "https://api.example.com/api/v1/digest/unsubscribe?user=42&sig=s%2Bg" {
+		t.Errorf("unexpected unsubscribe link %q", msg.Unsubscribe)
+	}
+	for _, expected := range []string{"1 new follower\n", "5 unread notifications", "@louis: Fish & chips (12 likes)", "https://example.com/posts/7", msg.Unsubscribe} {
+		if !strings.Contains(msg.Text, expected) {
+			t.Errorf("text lacks %q:\n%s", expected, msg.Text)
+		}
+	}
+	if !strings.Contains(msg.HTML, "Fish &amp; chips") || strings.Contains(msg.HTML, "&amp;amp;") {
+		t.Errorf("caption should be escaped exactly once:\n%s", msg.HTML)
+	}
+
+	from := &netmail.Address{Address: "no-reply@example.com"}
+	data, err := buildMessage(from, msg, time.Now())
+	if err != nil {
+		t.Fatalf("buildMessage: %v", err)
+	}
+	parsed, err := netmail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if parsed.Header.Get("List-Unsubscribe") != "<"+msg.Unsubscribe+">" || parsed.Header.Get("List-Unsubscribe-Post") != "List-Unsubscribe=One-Click" {
+		t.Errorf("missing one-click unsubscribe headers: %v", parsed.Header)
+	}
+}
@@ -0,0 +1,35 @@
+package mail
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// MemoryMailer keeps messages instead of delivering them, for development
+// and tests. Only the recipient and subject are logged, the body carries
+// tokens.
+type MemoryMailer struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	m.sent = append(m.sent, msg)
+	m.mu.Unlock()
+
+	log.Printf("Email to %s kept in memory (MAIL_BACKEND=memory): %s", msg.To, msg.Subject)
+	return nil
+}
+
+// Sent returns the messages sent so far, oldest first.
+func (m *MemoryMailer) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.sent...)
+}
@@ -0,0 +1,35 @@
+package mail
+
+import (
+	models "API/internal/Models"
+	"encoding/json"
+	"fmt"
+)
+
+// Outbox turns the email into the OutboxMessage delivering it. userID is the
+// account the email is about, 0 for none.
+func (e Email) Outbox(userID uint) (models.OutboxMessage, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return models.OutboxMessage{}, err
+	}
+
+	msg := models.OutboxMessage{
+		Template:  e.Template,
+		Recipient: e.To.Email,
+		Payload:   string(payload),
+	}
+	if userID != 0 {
+		msg.UserID = &userID
+	}
+	return msg, nil
+}
+
+// FromOutbox reads back the email an OutboxMessage delivers.
+func FromOutbox(msg models.OutboxMessage) (Email, error) {
+	var email Email
+	if err := json.Unmarshal([]byte(msg.Payload), &email); err != nil {
+		return Email{}, fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+	}
+	return email, nil
+}
@@ -0,0 +1,176 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// SMTPMailer delivers messages through an SMTP server, upgrading to TLS
+// when the server offers STARTTLS.
+type SMTPMailer struct {
+	addr string
+	host string
+	from *netmail.Address
+	auth smtp.Auth // nil when the server takes mail without a login
+}
+
+func NewSMTPMailer(cfg Config) (*SMTPMailer, error) {
+	if cfg.SMTPHost == "" {
+		return nil, errors.New("SMTP_HOST is required for MAIL_BACKEND=smtp")
+	}
+	from, err := netmail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAIL_FROM %q: %w", cfg.From, err)
+	}
+
+	mailer := &SMTPMailer{
+		addr: net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+		host: cfg.SMTPHost,
+		from: from,
+	}
+	if cfg.SMTPUsername != "" {
+		mailer.auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	return mailer, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := buildMessage(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if m.auth != nil {
+		if err := client.Auth(m.auth); err != nil {
+			return fmt.Errorf("failed to log in to SMTP server: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.from.Address); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return client.Quit()
+}
+
+// buildMessage encodes msg as a multipart/alternative email, the plain text
+// first so clients without HTML show that.
+func buildMessage(from *netmail.Address, msg Message, now time.Time) ([]byte, error) {
+	to, err := netmail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("%w: recipient %q: %v", ErrInvalidEmail, msg.To, err)
+	}
+	messageID, err := newMessageID(from.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", msg.Text},
+		{"text/html; charset=UTF-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	headers := [][2]string{
+		{"From", from.String()},
+		{"To", to.String()},
+		{"Subject", mime.QEncoding.Encode("UTF-8", msg.Subject)},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"Message-ID", messageID},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + parts.Boundary()},
+	}
+	if msg.Unsubscribe != "" {
+		// RFC 8058, mail clients show an unsubscribe button that POSTs to the URL
+		headers = append(headers,
+			[2]string{"List-Unsubscribe", "<" + msg.Unsubscribe + ">"},
+			[2]string{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"})
+	}
+
+	var out bytes.Buffer
+	for _, header := range headers {
+		fmt.Fprintf(&out, "%s: %s\r\n", header[0], header[1])
+	}
+	out.WriteString("\r\n")
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
+
+// newMessageID returns a random Message-ID on the domain of the sender.
+func newMessageID(sender string) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(sender, "@"); at >= 0 {
+		domain = sender[at+1:]
+	}
+	return "<" + hex.EncodeToString(buf) + "@" + domain + ">", nil
+}
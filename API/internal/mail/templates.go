@@ -0,0 +1,162 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DefaultLanguage is used for users whose language has no templates.
+const DefaultLanguage = "en"
+
+// The templates live in templates/<language>/<email>.txt and .html. The txt
+// file defines the "subject" next to the plain text body, the html file
+// defines the "content" that goes into layout.html.
+//
+//go:embed templates
+var templateFS embed.FS
+
+// Data is what the templates see, each email fills what it needs. Lang and
+// Subject are set while rendering.
+type Data struct {
+	Lang     string `json:"-"`
+	Subject  string `json:"-"`
+	Name     string `json:"name,omitempty"`
+	Link     string `json:"link,omitempty"`
+	Device   string `json:"device,omitempty"`
+	Location string `json:"location,omitempty"`
+	IP       string `json:"ip,omitempty"`
+	Time     string `json:"time,omitempty"`
+	Until    string `json:"until,omitempty"`
+
+	Unsubscribe string  `json:"unsubscribe,omitempty"`
+	Digest      *Digest `json:"digest,omitempty"`
+}
+
+// Digest is the content of the weekly digest.
+type Digest struct {
+	NewFollowers int64        `json:"new_followers"`
+	Unread       int64        `json:"unread"`
+	Posts        []DigestPost `json:"posts,omitempty"`
+}
+
+// DigestPost is one of the top posts of the accounts the user follows.
+type DigestPost struct {
+	Author   string `json:"author"`
+	Caption  string `json:"caption,omitempty"`
+	Link     string `json:"link"`
+	ImageURL string `json:"image_url,omitempty"`
+	Likes    int    `json:"likes"`
+	Comments int    `json:"comments"`
+}
+
+// Templates holds the parsed templates of every email and language.
+type Templates struct {
+	html map[string]*htmltemplate.Template // By "<language>/<email>"
+	text map[string]*texttemplate.Template
+}
+
+// LoadTemplates parses the embedded templates. Every language must have
+// every email the default language has, so a missing translation fails at
+// startup instead of when the email is sent.
+func LoadTemplates() (*Templates, error) {
+	t := &Templates{
+		html: map[string]*htmltemplate.Template{},
+		text: map[string]*texttemplate.Template{},
+	}
+
+	languages, err := fs.ReadDir(templateFS, "templates")
+	if err != nil {
+		return nil, err
+	}
+	for _, language := range languages {
+		if !language.IsDir() {
+			continue
+		}
+		files, err := fs.Glob(templateFS, path.Join("templates", language.Name(), "*.txt"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			email := strings.TrimSuffix(path.Base(file), ".txt")
+			key := language.Name() + "/" + email
+
+			text, err := texttemplate.ParseFS(templateFS, file)
+			if err != nil {
+				return nil, err
+			}
+			if text.Lookup("subject") == nil {
+				return nil, fmt.Errorf("mail template %s defines no subject", file)
+			}
+			html, err := htmltemplate.ParseFS(templateFS, "templates/layout.html", strings.TrimSuffix(file, ".txt")+".html")
+			if err != nil {
+				return nil, err
+			}
+			t.text[key] = text
+			t.html[key] = html
+		}
+	}
+
+	for key := range t.text {
+		if !strings.HasPrefix(key, DefaultLanguage+"/") {
+			continue
+		}
+		email := strings.TrimPrefix(key, DefaultLanguage+"/")
+		for _, language := range languages {
+			if language.IsDir() && t.text[language.Name()+"/"+email] == nil {
+				return nil, fmt.Errorf("mail template %s is missing in %s", email, language.Name())
+			}
+		}
+	}
+	return t, nil
+}
+
+// Language maps User.Language, e.g. "fr" or "pt-BR", to a language there
+// are templates for, DefaultLanguage when there are none.
+func (t *Templates) Language(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if i := strings.IndexAny(language, "-_"); i >= 0 {
+		language = language[:i]
+	}
+	for key := range t.text {
+		if strings.HasPrefix(key, language+"/") {
+			return language
+		}
+	}
+	return DefaultLanguage
+}
+
+// Render executes the templates of email in language, which must be one
+// returned by Language.
+func (t *Templates) Render(email, language string, data Data) (Message, error) {
+	key := language + "/" + email
+	text, html := t.text[key], t.html[key]
+	if text == nil || html == nil {
+		return Message{}, fmt.Errorf("no mail template %s", key)
+	}
+	data.Lang = language
+
+	var subject, textBody, htmlBody bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	data.Subject = strings.TrimSpace(subject.String())
+	if err := text.Execute(&textBody, data); err != nil {
+		return Message{}, err
+	}
+	if err := html.ExecuteTemplate(&htmlBody, "layout", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		Subject:     data.Subject,
+		Text:        strings.TrimSpace(textBody.String()) + "\n",
+		HTML:        htmlBody.String(),
+		Unsubscribe: data.Unsubscribe,
+	}, nil
+}
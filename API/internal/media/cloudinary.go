@@ -0,0 +1,216 @@
+package media
+
+import (
+	"API/internal/config"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api"
+	"github.com/cloudinary/cloudinary-go/v2/api/admin"
+	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+)
+
+// cloudinaryBaseURL is where every Cloudinary asset is delivered from
+const cloudinaryBaseURL = "https://res.cloudinary.com/"
+
+// cloudinaryVersion matches the optional "v1709913547" segment in asset URLs
+var cloudinaryVersion = regexp.MustCompile(`^v\d+$`)
+
+// CloudinaryStore keeps files on Cloudinary. Images and videos are stored
+// under the key without its extension, Cloudinary's public ID, and the
+// extension picks the format they are delivered in.
+type CloudinaryStore struct {
+	cld *cloudinary.Cloudinary
+}
+
+// NewCloudinaryStore connects once with the CLOUDINARY_* credentials.
+func NewCloudinaryStore() (*CloudinaryStore, error) {
+	cld, err := config.InitCloudinary()
+	if err != nil {
+		return nil, err
+	}
+	return &CloudinaryStore{cld: cld}, nil
+}
+
+// resourceType is Cloudinary's name for the kind of asset the key holds.
+func resourceType(key string) string {
+	contentType := ContentTypeOf(key)
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return string(api.Image)
+	case strings.HasPrefix(contentType, "video/"), strings.HasPrefix(contentType, "audio/"):
+		return api.Video
+	default:
+		return api.File
+	}
+}
+
+// publicID drops the extension, except for raw files where it is part of the ID.
+func publicID(key string) string {
+	if resourceType(key) == api.File {
+		return key
+	}
+	return strings.TrimSuffix(key, path.Ext(key))
+}
+
+func (s *CloudinaryStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (*Object, error) {
+	if err := ValidKey(key); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.cld.Upload.Upload(ctx, r, uploader.UploadParams{
+		PublicID:     publicID(key),
+		ResourceType: resourceType(key),
+		Overwrite:    api.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error.Message != "" {
+		return nil, fmt.Errorf("failed to upload to Cloudinary: %s", resp.Error.Message)
+	}
+
+	return &Object{
+		Key:         key,
+		URL:         s.URL(key),
+		Size:        int64(resp.Bytes),
+		ContentType: ContentTypeOf(key),
+		ModTime:     resp.CreatedAt,
+	}, nil
+}
+
+// Open downloads the asset from its public URL.
+func (s *CloudinaryStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := ValidKey(key); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download from Cloudinary: %s", resp.Status)
+	}
+}
+
+// Delete also tries the other resource types: uploads made before this
+// store existed were all stored as videos, whatever their extension.
+func (s *CloudinaryStore) Delete(ctx context.Context, key string) error {
+	if err := ValidKey(key); err != nil {
+		return err
+	}
+
+	kinds := []string{resourceType(key)}
+	for _, kind := range []string{string(api.Image), api.Video} {
+		if kind != kinds[0] {
+			kinds = append(kinds, kind)
+		}
+	}
+
+	for _, kind := range kinds {
+		id := key
+		if kind != api.File {
+			id = strings.TrimSuffix(key, path.Ext(key))
+		}
+
+		resp, err := s.cld.Upload.Destroy(ctx, uploader.DestroyParams{PublicID: id, ResourceType: kind})
+		if err != nil {
+			return fmt.Errorf("failed to delete from Cloudinary: %v", err)
+		}
+		switch resp.Result {
+		case "ok":
+			return nil
+		case "not found":
+			continue
+		default:
+			return fmt.Errorf("failed to delete from Cloudinary, response: %v", resp)
+		}
+	}
+
+	// Already gone counts as deleted
+	return nil
+}
+
+func (s *CloudinaryStore) URL(key string) string {
+	return cloudinaryBaseURL + s.cld.Config.Cloud.CloudName + "/" + resourceType(key) + "/upload/" + key
+}
+
+func (s *CloudinaryStore) Stat(ctx context.Context, key string) (*Object, error) {
+	if err := ValidKey(key); err != nil {
+		return nil, err
+	}
+
+	asset, err := s.cld.Admin.Asset(ctx, admin.AssetParams{
+		AssetType: api.AssetType(resourceType(key)),
+		PublicID:  publicID(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if asset.Error.Message != "" {
+		if strings.Contains(strings.ToLower(asset.Error.Message), "not found") {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to stat Cloudinary asset: %s", asset.Error.Message)
+	}
+
+	return &Object{
+		Key:         key,
+		URL:         s.URL(key),
+		Size:        int64(asset.Bytes),
+		ContentType: ContentTypeOf(key),
+		ModTime:     asset.CreatedAt,
+	}, nil
+}
+
+// KeyFromURL understands both the URLs built by URL and the ones saved by
+// older uploads, which carry a version and may carry transformations.
+func (s *CloudinaryStore) KeyFromURL(url string) (string, bool) {
+	return cloudinaryKey(url, s.cld.Config.Cloud.CloudName)
+}
+
+func cloudinaryKey(url, cloudName string) (string, bool) {
+	rest, ok := strings.CutPrefix(url, cloudinaryBaseURL+cloudName+"/")
+	if !ok {
+		return "", false
+	}
+
+	_, rest, ok = strings.Cut(rest, "/upload/")
+	if !ok {
+		return "", false
+	}
+
+	// Everything up to the version is transformations, e.g. "w_1280,q_auto/v123/"
+	parts := strings.Split(rest, "/")
+	for i, part := range parts {
+		if cloudinaryVersion.MatchString(part) {
+			parts = parts[i+1:]
+			break
+		}
+	}
+
+	key := strings.Join(parts, "/")
+	if ValidKey(key) != nil {
+		return "", false
+	}
+	return key, true
+}
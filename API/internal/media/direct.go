@@ -0,0 +1,162 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudinary/cloudinary-go/v2/api"
+)
+
+// cloudinarySignatureTTL is how long Cloudinary accepts a signed upload
+const cloudinarySignatureTTL = time.Hour
+
+// ErrDirectUploadUnsupported is returned by PresignUpload for backends that
+// clients cannot upload to on their own, e.g. the local disk.
+var ErrDirectUploadUnsupported = errors.New("direct uploads are not supported by this media backend")
+
+// UploadTarget tells a client how to upload one file straight to the
+// backend. S3 takes a PUT of the file with the given headers, Cloudinary a
+// multipart POST of the fields with the file in a "file" field.
+type UploadTarget struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// DirectUploader is implemented by the backends that support PresignUpload.
+type DirectUploader interface {
+	// PresignUpload allows one upload to key until expires has passed.
+	PresignUpload(ctx context.Context, key, contentType string, expires time.Duration) (*UploadTarget, error)
+}
+
+// PresignUpload signs a direct upload to key if the backend supports it.
+func PresignUpload(ctx context.Context, store MediaStore, key, contentType string, expires time.Duration) (*UploadTarget, error) {
+	uploader, ok := store.(DirectUploader)
+	if !ok {
+		return nil, ErrDirectUploadUnsupported
+	}
+	if err := ValidKey(key); err != nil {
+		return nil, err
+	}
+	return uploader.PresignUpload(ctx, key, contentType, expires)
+}
+
+// AssetMatchesKey tells whether the asset ID a client got back from a direct
+// upload is the one it was signed for: the key itself on S3, the public ID
+// on Cloudinary.
+func AssetMatchesKey(assetID, key string) bool {
+	return assetID == key || assetID == publicID(key)
+}
+
+// PresignUpload returns a presigned PUT URL.
+func (s *S3Store) PresignUpload(ctx context.Context, key, contentType string, expires time.Duration) (*UploadTarget, error) {
+	u, err := s.client.PresignedPutObject(ctx, s.bucket, key, expires)
+	if err != nil {
+		return nil, err
+	}
+	return &UploadTarget{
+		Method:    "PUT",
+		URL:       u.String(),
+		Headers:   map[string]string{"Content-Type": contentType},
+		ExpiresAt: time.Now().Add(expires),
+	}, nil
+}
+
+// PresignUpload returns the signed parameters of an upload API call. The
+// public ID is part of the signature, so the client cannot pick another one.
+// Cloudinary lets a signature be used for an hour, whatever expires says.
+func (s *CloudinaryStore) PresignUpload(ctx context.Context, key, contentType string, expires time.Duration) (*UploadTarget, error) {
+	now := time.Now()
+	params := url.Values{
+		"public_id": {publicID(key)},
+		"timestamp": {strconv.FormatInt(now.Unix(), 10)},
+	}
+
+	signature, err := api.SignParameters(params, s.cld.Config.Cloud.APISecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UploadTarget{
+		Method: "POST",
+		URL:    "https://api.cloudinary.com/v1_1/" + s.cld.Config.Cloud.CloudName + "/" + resourceType(key) + "/upload",
+		Fields: map[string]string{
+			"api_key":   s.cld.Config.Cloud.APIKey,
+			"public_id": params.Get("public_id"),
+			"timestamp": params.Get("timestamp"),
+			"signature": signature,
+		},
+		ExpiresAt: now.Add(min(expires, cloudinarySignatureTTL)),
+	}, nil
+}
+
+// CheckStoredUpload makes sure a file a client uploaded on its own is what
+// its extension claims, see CheckUpload.
+func CheckStoredUpload(ctx context.Context, store MediaStore, key string) error {
+	src, err := store.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return CheckUpload(src, key)
+}
+
+// CheckUpload makes sure the content of an upload is what the extension of
+// name claims: an image within MaxImagePixels, or a file that at least
+// starts like a video container. Videos are probed properly when they are
+// processed.
+func CheckUpload(src io.Reader, name string) error {
+	r := bufio.NewReader(src)
+
+	if strings.HasPrefix(ContentTypeOf(name), "image/") {
+		config, _, err := image.DecodeConfig(r)
+		if err != nil {
+			return ErrUnsupportedImage
+		}
+		if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxImagePixels {
+			return fmt.Errorf("%w: %dx%d", ErrImageTooLarge, config.Width, config.Height)
+		}
+		return nil
+	}
+
+	head, _ := r.Peek(16)
+	if !LooksLikeVideo(head) {
+		return fmt.Errorf("%w: %s is not a %s file", ErrUnsupportedVideo, path.Base(name), strings.TrimPrefix(path.Ext(name), "."))
+	}
+	return nil
+}
+
+// LooksLikeVideo checks the first bytes of a file for the containers the
+// API accepts: MP4 and QuickTime, Matroska and WebM, AVI, FLV and WMV.
+func LooksLikeVideo(head []byte) bool {
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}): // EBML
+		return true
+	case bytes.HasPrefix(head, []byte("FLV")):
+		return true
+	case bytes.HasPrefix(head, []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}): // ASF
+		return true
+	case len(head) < 12:
+		return false
+	case string(head[:4]) == "RIFF" && string(head[8:12]) == "AVI ":
+		return true
+	}
+
+	switch string(head[4:8]) {
+	case "ftyp", "moov", "mdat", "wide", "free", "skip": // ISO base media and older QuickTime
+		return true
+	}
+	return false
+}
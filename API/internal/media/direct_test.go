@@ -0,0 +1,123 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/png"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+func TestLooksLikeVideo(t *testing.T) {
+	cases := map[string]bool{
+		"\x00\x00\x00\x20ftypisom\x00\x00\x02\x00": true,  // MP4
+		"\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00": true,  // QuickTime
+		"\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01\x42": true,  // WebM
+		"RIFF\x00\x00\x00\x00AVI LIST":             true,  // AVI
+		"\xFF\xD8\xFF\xE0\x00\x10JFIF\x00\x01":     false, // JPEG
+		"<html><body>":                             false,
+		"short":                                    false,
+	}
+	for head, want := range cases {
+		if got := LooksLikeVideo([]byte(head)); got != want {
+			t.Errorf("LooksLikeVideo(%q) = %v, want %v", head, got, want)
+		}
+	}
+}
+
+func TestCheckStoredUpload(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir(), "http://localhost/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(20, 10)); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"originals/photo.png":  buf.Bytes(),
+		"originals/fake.png":   []byte("<script>alert(1)</script>"),
+		"originals/clip.mp4":   []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00isomiso2"),
+		"originals/notes.webm": []byte("just some text, no video"),
+	}
+	for key, data := range files {
+		if _, err := store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), ContentTypeOf(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := CheckStoredUpload(ctx, store, "originals/photo.png"); err != nil {
+		t.Errorf("expected the PNG to pass, got %v", err)
+	}
+	if err := CheckStoredUpload(ctx, store, "originals/fake.png"); !errors.Is(err, ErrUnsupportedImage) {
+		t.Errorf("expected ErrUnsupportedImage, got %v", err)
+	}
+	if err := CheckStoredUpload(ctx, store, "originals/clip.mp4"); err != nil {
+		t.Errorf("expected the MP4 to pass, got %v", err)
+	}
+	if err := CheckStoredUpload(ctx, store, "originals/notes.webm"); !errors.Is(err, ErrUnsupportedVideo) {
+		t.Errorf("expected ErrUnsupportedVideo, got %v", err)
+	}
+	if err := CheckStoredUpload(ctx, store, "originals/missing.mp4"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPresignUpload(t *testing.T) {
+	ctx := context.Background()
+
+	local, err := NewLocalStore(t.TempDir(), "http://localhost/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PresignUpload(ctx, local, "originals/a.mp4", "video/mp4", time.Minute); !errors.Is(err, ErrDirectUploadUnsupported) {
+		t.Errorf("expected ErrDirectUploadUnsupported for the local store, got %v", err)
+	}
+
+	cld, err := cloudinary.NewFromParams("demo", "key", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := PresignUpload(ctx, &CloudinaryStore{cld: cld}, "originals/a.mp4", "video/mp4", 15*time.Minute)
+	if err != nil {
+		t.Fatalf("Cloudinary PresignUpload: %v", err)
+	}
+	if target.Method != "POST" || target.URL != "https://api.cloudinary.com/v1_1/demo/video/upload" {
+		t.Errorf("unexpected target %+v", target)
+	}
+	if target.Fields["public_id"] != "originals/a" || !AssetMatchesKey("originals/a", "originals/a.mp4") {
+		t.Errorf("expected the public ID without extension, got %q", target.Fields["public_id"])
+	}
+	want, _ := api.SignParameters(url.Values{
+		"public_id": {target.Fields["public_id"]},
+		"timestamp": {target.Fields["timestamp"]},
+	}, "secret")
+	if target.Fields["signature"] != want {
+		t.Errorf("signature %q does not match %q", target.Fields["signature"], want)
+	}
+
+	client, err := minio.New("localhost:9000", &minio.Options{
+		Creds:  credentials.NewStaticV4("access", "secret", ""),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err = PresignUpload(ctx, &S3Store{client: client, bucket: "media"}, "originals/a.mp4", "video/mp4", 15*time.Minute)
+	if err != nil {
+		t.Fatalf("S3 PresignUpload: %v", err)
+	}
+	if target.Method != "PUT" || !strings.Contains(target.URL, "/media/originals/a.mp4?") || !strings.Contains(target.URL, "X-Amz-Signature=") {
+		t.Errorf("unexpected target %+v", target)
+	}
+}
@@ -0,0 +1,61 @@
+package media
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"io"
+	"math/bits"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// ContentIndex lets StoreImage and ProcessVideo reuse an object stored
+// before with the same content instead of storing it twice.
+type ContentIndex interface {
+	// ReuseContent returns the key and URL of an object whose content has
+	// the given SHA-256, and keeps it from being collected while it is put
+	// to use. ok is false when there is none.
+	ReuseContent(sha256 string) (key, url string, ok bool, err error)
+}
+
+// SHA256 is the hex encoded SHA-256 of data.
+func SHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// SHA256Of reads r to the end and returns its hex encoded SHA-256.
+func SHA256Of(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DHash is the 64 bit difference hash of an image: it is shrunk to 9x8 gray
+// pixels and every bit tells whether a pixel is brighter than its right
+// neighbour. Resized, recompressed or slightly edited copies of an image get
+// the same or a close hash, see HashDistance.
+func DHash(img image.Image) uint64 {
+	small := image.NewGray(image.Rect(0, 0, 9, 8))
+	xdraw.BiLinear.Scale(small, small.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if small.GrayAt(x, y).Y > small.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// HashDistance is the number of bits two perceptual hashes differ in, 0 for
+// the same picture and around 32 for unrelated ones.
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
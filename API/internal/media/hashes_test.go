@@ -0,0 +1,94 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// memoryIndex is a ContentIndex over what StoreImage stored before.
+type memoryIndex map[string]StoredVariant
+
+func (m memoryIndex) ReuseContent(sum string) (string, string, bool, error) {
+	stored, ok := m[sum]
+	return stored.Key, stored.URL, ok, nil
+}
+
+func TestDHash(t *testing.T) {
+	original := testImage(400, 300)
+	smaller := resize(original, 120)
+
+	brighter := image.NewRGBA(original.Bounds())
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			r, g, b, _ := original.At(x, y).RGBA()
+			brighter.Set(x, y, color.RGBA{R: uint8(min(255, r>>8+20)), G: uint8(min(255, g>>8+20)), B: uint8(min(255, b>>8+20)), A: 255})
+		}
+	}
+
+	// Mirrored, every brightness step goes the other way
+	different := image.NewRGBA(original.Bounds())
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			different.Set(399-x, y, original.At(x, y))
+		}
+	}
+
+	hash := DHash(original)
+	if d := HashDistance(hash, DHash(smaller)); d > 4 {
+		t.Errorf("a resized copy should hash close to the original, distance %d", d)
+	}
+	if d := HashDistance(hash, DHash(brighter)); d > 4 {
+		t.Errorf("a brightened copy should hash close to the original, distance %d", d)
+	}
+	if d := HashDistance(hash, DHash(different)); d < 16 {
+		t.Errorf("an unrelated image should hash far from the original, distance %d", d)
+	}
+}
+
+func TestStoreImageReusesContent(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir(), "http://localhost/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(400, 300)); err != nil {
+		t.Fatal(err)
+	}
+	processed, err := ProcessImage(bytes.NewReader(buf.Bytes()), PostImageVariants)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := memoryIndex{}
+	first, err := StoreImage(ctx, store, index, "posts", processed)
+	if err != nil {
+		t.Fatalf("StoreImage: %v", err)
+	}
+	for _, variant := range first {
+		if variant.Reused || variant.SHA256 == "" {
+			t.Errorf("nothing was stored yet, got %+v", variant)
+		}
+		index[variant.SHA256] = variant
+	}
+
+	// The same upload again comes out identical and is not stored twice
+	again, err := ProcessImage(bytes.NewReader(buf.Bytes()), PostImageVariants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := StoreImage(ctx, store, index, "posts", again)
+	if err != nil {
+		t.Fatalf("StoreImage: %v", err)
+	}
+	for name, variant := range second {
+		if !variant.Reused || variant.SHA256 != first[name].SHA256 {
+			t.Errorf("expected %s to be reused, got %+v", name, variant)
+		}
+	}
+}
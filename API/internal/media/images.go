@@ -0,0 +1,290 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // register decoders
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"path"
+
+	"github.com/buckket/go-blurhash"
+	"github.com/rwcarlsen/goexif/exif"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxImagePixels guards against decompression bombs, a small file that
+	// decodes to gigabytes of pixels
+	MaxImagePixels = 50_000_000
+	// jpegQuality is used for every variant, sharp enough for a 1080px feed
+	jpegQuality = 85
+)
+
+var (
+	// ErrUnsupportedImage is returned for files that are not a JPEG, PNG, GIF or WebP.
+	ErrUnsupportedImage = errors.New("unsupported image format, use JPEG, PNG, GIF or WebP")
+	// ErrImageTooLarge is returned for images over MaxImagePixels.
+	ErrImageTooLarge = errors.New("image has too many pixels")
+)
+
+// ImageVariant is one size an image is stored in. Images are only ever
+// scaled down, a small upload keeps its own size.
+type ImageVariant struct {
+	Name     string
+	MaxWidth int
+	Square   bool // Center crop to a square first, e.g. for avatars and grid thumbnails
+}
+
+// PostImageVariants are the sizes stored for every post image.
+var PostImageVariants = []ImageVariant{
+	{Name: "thumbnail", MaxWidth: 320, Square: true},
+	{Name: "medium", MaxWidth: 640},
+	{Name: "full", MaxWidth: 1080},
+}
+
+// StoryImageVariants are the sizes stored for photo stories, always shown full screen.
+var StoryImageVariants = []ImageVariant{
+	{Name: "full", MaxWidth: 1080},
+}
+
+// AvatarVariants are the sizes stored for profile pictures.
+var AvatarVariants = []ImageVariant{
+	{Name: "avatar", MaxWidth: 320, Square: true},
+}
+
+// EncodedVariant is a variant ready to be stored, always a JPEG.
+type EncodedVariant struct {
+	Name   string
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// ProcessedImage is the result of ProcessImage. Width and Height are those
+// of the upright original.
+type ProcessedImage struct {
+	Width    int
+	Height   int
+	BlurHash string
+	DHash    uint64 // Perceptual hash of the upright original
+	Variants []EncodedVariant
+}
+
+// AspectRatio is width over height of the upright image.
+func (p *ProcessedImage) AspectRatio() float64 {
+	return float64(p.Width) / float64(p.Height)
+}
+
+// Variant returns the named variant, or nil.
+func (p *ProcessedImage) Variant(name string) *EncodedVariant {
+	for i := range p.Variants {
+		if p.Variants[i].Name == name {
+			return &p.Variants[i]
+		}
+	}
+	return nil
+}
+
+// ProcessImage decodes an upload, turns it upright according to its EXIF
+// orientation and re-encodes it in every variant. Re-encoding drops all
+// metadata, EXIF, GPS position and camera serials included. Animated GIFs
+// keep their first frame only.
+func ProcessImage(r io.Reader, variants []ImageVariant) (*ProcessedImage, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxImagePixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	if format == "jpeg" {
+		img = applyOrientation(img, exifOrientation(data))
+	}
+
+	bounds := img.Bounds()
+	processed := &ProcessedImage{Width: bounds.Dx(), Height: bounds.Dy()}
+
+	small := resize(img, 32)
+	processed.BlurHash, err = blurhash.Encode(4, 3, small)
+	if err != nil {
+		return nil, err
+	}
+	processed.DHash = DHash(small)
+
+	for _, variant := range variants {
+		source := img
+		if variant.Square {
+			source = cropSquare(img)
+		}
+		scaled := resize(source, variant.MaxWidth)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		processed.Variants = append(processed.Variants, EncodedVariant{
+			Name:   variant.Name,
+			Width:  scaled.Bounds().Dx(),
+			Height: scaled.Bounds().Dy(),
+			Data:   buf.Bytes(),
+		})
+	}
+
+	return processed, nil
+}
+
+// StoredVariant is where a variant ended up.
+type StoredVariant struct {
+	Key    string
+	URL    string
+	Size   int64
+	SHA256 string
+	Reused bool // Already stored with the same content, it must not be deleted with this upload
+}
+
+// StoreImage puts every variant of the image in the store next to each
+// other, e.g. "posts/<id>/thumbnail.jpg". A variant the index already knows
+// is not stored again, index may be nil. If one fails the others are
+// removed again.
+func StoreImage(ctx context.Context, store MediaStore, index ContentIndex, folder string, image *ProcessedImage) (map[string]StoredVariant, error) {
+	base := NewKey(folder, "")
+	stored := make(map[string]StoredVariant, len(image.Variants))
+	rollback := func() {
+		for _, done := range stored {
+			if !done.Reused {
+				store.Delete(ctx, done.Key)
+			}
+		}
+	}
+
+	for _, variant := range image.Variants {
+		sum := SHA256(variant.Data)
+		size := int64(len(variant.Data))
+
+		if index != nil {
+			key, url, ok, err := index.ReuseContent(sum)
+			if err != nil {
+				rollback()
+				return nil, err
+			}
+			if ok {
+				stored[variant.Name] = StoredVariant{Key: key, URL: url, Size: size, SHA256: sum, Reused: true}
+				continue
+			}
+		}
+
+		key := path.Join(base, variant.Name+".jpg")
+		object, err := store.Put(ctx, key, bytes.NewReader(variant.Data), int64(len(variant.Data)), "image/jpeg")
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		stored[variant.Name] = StoredVariant{Key: key, URL: object.URL, Size: size, SHA256: sum}
+	}
+
+	return stored, nil
+}
+
+// exifOrientation reads the EXIF orientation tag, 1 (upright) if missing.
+func exifOrientation(data []byte) int {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 1
+	}
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+	orientation, err := tag.Int(0)
+	if err != nil || orientation < 1 || orientation > 8 {
+		return 1
+	}
+	return orientation
+}
+
+// applyOrientation turns the image upright. Orientations 5 to 8 are rotated
+// by 90 degrees, so width and height swap.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation == 1 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	outW, outH := w, h
+	if orientation >= 5 {
+		outW, outH = h, w
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, outW, outH))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // mirrored and rotated 270 clockwise
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // mirrored and rotated 90 clockwise
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 270 clockwise
+				dx, dy = y, w-1-x
+			}
+			out.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return out
+}
+
+// cropSquare keeps the centered square of the image.
+func cropSquare(img image.Image) image.Image {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+
+	out := image.NewNRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(out, out.Bounds(), img, image.Point{X: x, Y: y}, draw.Src)
+	return out
+}
+
+// resize scales the image down to maxWidth keeping its aspect ratio, on a
+// white background so transparent PNGs do not turn black as JPEGs.
+func resize(img image.Image, maxWidth int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > maxWidth {
+		h = max(1, h*maxWidth/w)
+		w = maxWidth
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(out, out.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	xdraw.CatmullRom.Scale(out, out.Bounds(), img, bounds, xdraw.Over, nil)
+	return out
+}
@@ -0,0 +1,154 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// withOrientation inserts an EXIF block holding only the orientation tag
+// right after the JPEG's start of image marker.
+func withOrientation(t *testing.T, jpegData []byte, orientation uint16) []byte {
+	t.Helper()
+
+	var tiff bytes.Buffer
+	tiff.WriteString("II*\x00")
+	binary.Write(&tiff, binary.LittleEndian, uint32(8)) // offset of the first IFD
+	binary.Write(&tiff, binary.LittleEndian, uint16(1)) // one entry
+	binary.Write(&tiff, binary.LittleEndian, uint16(0x0112))
+	binary.Write(&tiff, binary.LittleEndian, uint16(3)) // SHORT
+	binary.Write(&tiff, binary.LittleEndian, uint32(1))
+	binary.Write(&tiff, binary.LittleEndian, orientation)
+	binary.Write(&tiff, binary.LittleEndian, uint16(0)) // padding
+	binary.Write(&tiff, binary.LittleEndian, uint32(0)) // no next IFD
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, jpegData[:2]...)
+	out = append(out, segment...)
+	return append(out, jpegData[2:]...)
+}
+
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func TestProcessImageOrientationAndVariants(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(1600, 800), nil); err != nil {
+		t.Fatal(err)
+	}
+	upload := withOrientation(t, buf.Bytes(), 6)
+	if exifOrientation(upload) != 6 {
+		t.Fatal("test EXIF block was not understood")
+	}
+
+	processed, err := ProcessImage(bytes.NewReader(upload), PostImageVariants)
+	if err != nil {
+		t.Fatalf("ProcessImage: %v", err)
+	}
+
+	// Rotated 90 degrees: the upright photo is portrait
+	if processed.Width != 800 || processed.Height != 1600 || processed.AspectRatio() != 0.5 {
+		t.Errorf("expected an upright 800x1600 image, got %dx%d", processed.Width, processed.Height)
+	}
+	if processed.BlurHash == "" {
+		t.Error("expected a blurhash")
+	}
+
+	want := map[string][2]int{"thumbnail": {320, 320}, "medium": {640, 1280}, "full": {800, 1600}}
+	for name, size := range want {
+		variant := processed.Variant(name)
+		if variant == nil {
+			t.Fatalf("missing %s variant", name)
+		}
+		if variant.Width != size[0] || variant.Height != size[1] {
+			t.Errorf("%s: expected %dx%d, got %dx%d", name, size[0], size[1], variant.Width, variant.Height)
+		}
+		if bytes.Contains(variant.Data, []byte("Exif")) {
+			t.Errorf("%s still carries EXIF data", name)
+		}
+		if _, format, err := image.DecodeConfig(bytes.NewReader(variant.Data)); err != nil || format != "jpeg" {
+			t.Errorf("%s is not a JPEG: %v", name, err)
+		}
+	}
+}
+
+func TestProcessImageStoresPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(200, 100)); err != nil {
+		t.Fatal(err)
+	}
+
+	processed, err := ProcessImage(&buf, AvatarVariants)
+	if err != nil {
+		t.Fatalf("ProcessImage: %v", err)
+	}
+	if avatar := processed.Variant("avatar"); avatar.Width != 100 || avatar.Height != 100 {
+		t.Errorf("expected the avatar cropped to 100x100 and not upscaled, got %dx%d", avatar.Width, avatar.Height)
+	}
+
+	store, err := NewLocalStore(t.TempDir(), "http://localhost/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := StoreImage(context.Background(), store, nil, "avatars", processed)
+	if err != nil {
+		t.Fatalf("StoreImage: %v", err)
+	}
+	if key := stored["avatar"].Key; !strings.HasPrefix(key, "avatars/") || !strings.HasSuffix(key, "/avatar.jpg") {
+		t.Errorf("unexpected key %q", key)
+	}
+}
+
+func TestProcessImageRejectsOtherFiles(t *testing.T) {
+	_, err := ProcessImage(strings.NewReader("just some text, not an image"), PostImageVariants)
+	if !errors.Is(err, ErrUnsupportedImage) {
+		t.Fatalf("expected ErrUnsupportedImage, got %v", err)
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// A 2x1 image with a red pixel on the left and a blue one on the right
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	red, blue := color.NRGBA{R: 255, A: 255}, color.NRGBA{B: 255, A: 255}
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	cases := map[int]struct {
+		w, h   int
+		redAt  image.Point
+		blueAt image.Point
+	}{
+		2: {2, 1, image.Pt(1, 0), image.Pt(0, 0)},
+		3: {2, 1, image.Pt(1, 0), image.Pt(0, 0)},
+		6: {1, 2, image.Pt(0, 0), image.Pt(0, 1)},
+		8: {1, 2, image.Pt(0, 1), image.Pt(0, 0)},
+	}
+	for orientation, want := range cases {
+		out := applyOrientation(src, orientation)
+		if out.Bounds().Dx() != want.w || out.Bounds().Dy() != want.h {
+			t.Errorf("orientation %d: expected %dx%d, got %v", orientation, want.w, want.h, out.Bounds())
+			continue
+		}
+		if out.At(want.redAt.X, want.redAt.Y) != red || out.At(want.blueAt.X, want.blueAt.Y) != blue {
+			t.Errorf("orientation %d: pixels ended up in the wrong place", orientation)
+		}
+	}
+}
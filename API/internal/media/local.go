@@ -0,0 +1,134 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore keeps files in a directory on disk. The server exposes that
+// directory with Fiber's static handler under the path of BaseURL.
+type LocalStore struct {
+	Root    string
+	BaseURL string
+}
+
+func NewLocalStore(root, baseURL string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{Root: root, BaseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	if err := ValidKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file first so readers never see half a file.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (*Object, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return nil, err
+	}
+
+	return s.Stat(ctx, key)
+}
+
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) URL(key string) string {
+	return s.BaseURL + "/" + key
+}
+
+func (s *LocalStore) Stat(ctx context.Context, key string) (*Object, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Object{
+		Key:         key,
+		URL:         s.URL(key),
+		Size:        info.Size(),
+		ContentType: ContentTypeOf(key),
+		ModTime:     info.ModTime(),
+	}, nil
+}
+
+func (s *LocalStore) KeyFromURL(url string) (string, bool) {
+	key, ok := strings.CutPrefix(url, s.BaseURL+"/")
+	if !ok || ValidKey(key) != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// MountPath is the URL path the files have to be served under for URL to work.
+func (s *LocalStore) MountPath() string {
+	parsed, err := url.Parse(s.BaseURL)
+	if err != nil || parsed.Path == "" {
+		return "/media"
+	}
+	return parsed.Path
+}
@@ -0,0 +1,141 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3PartSize is the part size of multipart uploads, which minio-go buffers
+// in memory. Left at 0 it sizes parts for the 5 TiB maximum, over 500 MiB
+// each, when the size of the object is unknown.
+const s3PartSize = 16 << 20
+
+// S3Store keeps files in an S3 compatible bucket, e.g. MinIO in development.
+type S3Store struct {
+	client    *minio.Client
+	bucket    string
+	publicURL string
+}
+
+// NewS3Store connects to the bucket, creating it if it does not exist yet.
+// Objects are served from S3_PUBLIC_URL, or path-style from the endpoint.
+func NewS3Store(ctx context.Context, cfg Config) (*S3Store, error) {
+	if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+		return nil, errors.New("S3_ENDPOINT and S3_BUCKET are required for the s3 media backend")
+	}
+
+	client, err := minio.New(cfg.S3Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+		Secure: cfg.S3UseSSL,
+		Region: cfg.S3Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.S3Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.S3Bucket, minio.MakeBucketOptions{Region: cfg.S3Region}); err != nil {
+			return nil, err
+		}
+	}
+
+	publicURL := cfg.S3PublicURL
+	if publicURL == "" {
+		scheme := "https"
+		if !cfg.S3UseSSL {
+			scheme = "http"
+		}
+		publicURL = scheme + "://" + cfg.S3Endpoint + "/" + cfg.S3Bucket
+	}
+
+	return &S3Store{client: client, bucket: cfg.S3Bucket, publicURL: strings.TrimSuffix(publicURL, "/")}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (*Object, error) {
+	if err := ValidKey(key); err != nil {
+		return nil, err
+	}
+	if contentType == "" {
+		contentType = ContentTypeOf(key)
+	}
+
+	info, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    s3PartSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Object{
+		Key:         key,
+		URL:         s.URL(key),
+		Size:        info.Size,
+		ContentType: contentType,
+		ModTime:     info.LastModified,
+	}, nil
+}
+
+// Open checks the object exists first, GetObject itself only fails on the first read.
+func (s *S3Store) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if _, err := s.Stat(ctx, key); err != nil {
+		return nil, err
+	}
+	return s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := ValidKey(key); err != nil {
+		return err
+	}
+	// S3 treats removing a missing key as success already
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Store) URL(key string) string {
+	return s.publicURL + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (*Object, error) {
+	if err := ValidKey(key); err != nil {
+		return nil, err
+	}
+
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &Object{
+		Key:         key,
+		URL:         s.URL(key),
+		Size:        info.Size,
+		ContentType: info.ContentType,
+		ModTime:     info.LastModified,
+	}, nil
+}
+
+func (s *S3Store) KeyFromURL(rawURL string) (string, bool) {
+	escaped, ok := strings.CutPrefix(rawURL, s.publicURL+"/")
+	if !ok {
+		return "", false
+	}
+	key, err := url.PathUnescape(escaped)
+	if err != nil || ValidKey(key) != nil {
+		return "", false
+	}
+	return key, true
+}
@@ -0,0 +1,133 @@
+// Package media stores uploaded files. Controllers depend on the MediaStore
+// interface and the backend is picked by MEDIA_BACKEND, so development and
+// tests can keep files on disk or in MinIO instead of Cloudinary.
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned by Stat and Open when no object is stored under the key.
+var ErrNotFound = errors.New("media object not found")
+
+// Object describes a stored file.
+type Object struct {
+	Key         string
+	URL         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// MediaStore keeps uploaded files under slash separated keys such as
+// "avatars/6f1c....jpg". The extension in the key is what backends use to
+// tell images from videos, so keys should always carry one (see NewKey).
+type MediaStore interface {
+	// Put stores the size bytes of r under key, replacing anything already
+	// there. size is -1 when unknown, which makes some backends buffer.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (*Object, error)
+	// Open reads the object back, or returns ErrNotFound.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL is the public address the object is served from.
+	URL(key string) string
+	// Stat describes the object, or returns ErrNotFound.
+	Stat(ctx context.Context, key string) (*Object, error)
+	// KeyFromURL is the reverse of URL, for the URLs already saved on users
+	// and posts. It reports false for URLs this store did not produce.
+	KeyFromURL(url string) (string, bool)
+}
+
+// NewKey returns a fresh key in folder keeping the extension of filename.
+func NewKey(folder, filename string) string {
+	return path.Join(folder, uuid.NewString()+strings.ToLower(filepath.Ext(filename)))
+}
+
+// ValidKey rejects keys that could escape the store, e.g. "../secrets".
+func ValidKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") || path.Clean(key) != key {
+		return fmt.Errorf("invalid media key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "." || part == ".." {
+			return fmt.Errorf("invalid media key %q", key)
+		}
+	}
+	return nil
+}
+
+// ContentTypeOf guesses a content type from the extension of the key.
+func ContentTypeOf(key string) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// Config selects and configures the backend.
+type Config struct {
+	Backend string // cloudinary, local or s3
+
+	// local
+	LocalDir     string
+	LocalBaseURL string
+
+	// s3
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3UseSSL    bool
+	S3PublicURL string
+}
+
+// ConfigFromEnv reads the MEDIA_* and S3_* variables. The local backend is
+// the default so a fresh checkout works without any account.
+func ConfigFromEnv() Config {
+	return Config{
+		Backend:      getenv("MEDIA_BACKEND", "local"),
+		LocalDir:     getenv("MEDIA_LOCAL_DIR", "./uploads"),
+		LocalBaseURL: getenv("MEDIA_LOCAL_BASE_URL", "http://localhost:8090/media"),
+		S3Endpoint:   os.Getenv("S3_ENDPOINT"),
+		S3Region:     os.Getenv("S3_REGION"),
+		S3Bucket:     os.Getenv("S3_BUCKET"),
+		S3AccessKey:  os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:  os.Getenv("S3_SECRET_KEY"),
+		S3UseSSL:     os.Getenv("S3_USE_SSL") != "false",
+		S3PublicURL:  os.Getenv("S3_PUBLIC_URL"),
+	}
+}
+
+// New builds the configured backend.
+func New(ctx context.Context, cfg Config) (MediaStore, error) {
+	switch cfg.Backend {
+	case "cloudinary":
+		return NewCloudinaryStore()
+	case "local":
+		return NewLocalStore(cfg.LocalDir, cfg.LocalBaseURL)
+	case "s3":
+		return NewS3Store(ctx, cfg)
+	default:
+		return nil, fmt.Errorf("unknown MEDIA_BACKEND %q, expected cloudinary, local or s3", cfg.Backend)
+	}
+}
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,104 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir(), "http://localhost:8090/media/")
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+
+	key := NewKey("avatars", "Me.JPG")
+	if !strings.HasPrefix(key, "avatars/") || !strings.HasSuffix(key, ".jpg") {
+		t.Fatalf("unexpected key %q", key)
+	}
+
+	object, err := store.Put(ctx, key, strings.NewReader("not really a jpeg"), -1, "image/jpeg")
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if object.Size != 17 || object.ContentType != "image/jpeg" {
+		t.Errorf("unexpected object %+v", object)
+	}
+	if object.URL != "http://localhost:8090/media/"+key {
+		t.Errorf("unexpected URL %q", object.URL)
+	}
+	if store.MountPath() != "/media" {
+		t.Errorf("unexpected mount path %q", store.MountPath())
+	}
+
+	reader, err := store.Open(ctx, key)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	content, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(content) != "not really a jpeg" {
+		t.Errorf("Open returned %q", content)
+	}
+
+	if got, ok := store.KeyFromURL(object.URL); !ok || got != key {
+		t.Errorf("KeyFromURL(%q) = %q, %v", object.URL, got, ok)
+	}
+	if _, ok := store.KeyFromURL("https://example.com/media/" + key); ok {
+		t.Error("expected a foreign URL to be rejected")
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("deleting a missing object should succeed, got %v", err)
+	}
+	if _, err := store.Open(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound opening a deleted object, got %v", err)
+	}
+
+	// Nothing but the folder is left behind, no temporary files
+	entries, _ := os.ReadDir(filepath.Join(store.Root, "avatars"))
+	if len(entries) != 0 {
+		t.Errorf("expected an empty folder, found %d entries", len(entries))
+	}
+}
+
+func TestValidKey(t *testing.T) {
+	for _, key := range []string{"avatars/a.jpg", "posts/2024/b.mp4"} {
+		if err := ValidKey(key); err != nil {
+			t.Errorf("ValidKey(%q): %v", key, err)
+		}
+	}
+	for _, key := range []string{"", "/etc/passwd", "../secret", "avatars/../../x", "a//b", "a\\b", "avatars/"} {
+		if err := ValidKey(key); err == nil {
+			t.Errorf("expected %q to be rejected", key)
+		}
+	}
+}
+
+func TestCloudinaryKey(t *testing.T) {
+	cases := map[string]string{
+		"https://res.cloudinary.com/demo/image/upload/avatars/abc.jpg":                    "avatars/abc.jpg",
+		"https://res.cloudinary.com/demo/video/upload/v1738815446/Instagram/xyz.mp4":      "Instagram/xyz.mp4",
+		"https://res.cloudinary.com/demo/video/upload/w_1280,q_auto/v123/Instagram/a.jpg": "Instagram/a.jpg",
+	}
+	for url, want := range cases {
+		if got, ok := cloudinaryKey(url, "demo"); !ok || got != want {
+			t.Errorf("cloudinaryKey(%q) = %q, %v, want %q", url, got, ok, want)
+		}
+	}
+
+	if _, ok := cloudinaryKey("https://res.cloudinary.com/other/image/upload/a.jpg", "demo"); ok {
+		t.Error("expected another cloud's URL to be rejected")
+	}
+}
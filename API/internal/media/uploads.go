@@ -0,0 +1,202 @@
+package media
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrChecksumMismatch is returned by Append when a chunk does not match
+	// the checksum the client sent with it. The chunk is discarded.
+	ErrChecksumMismatch = errors.New("chunk checksum mismatch")
+	// ErrUploadBusy is returned by Append while another chunk of the same
+	// upload is being written.
+	ErrUploadBusy = errors.New("upload is busy with another chunk")
+	// ErrUploadTooLarge is returned by Append for a chunk going past the
+	// declared length of the upload.
+	ErrUploadTooLarge = errors.New("chunk goes past the upload length")
+)
+
+// ChecksumAlgorithms are the algorithms accepted in Upload-Checksum.
+var ChecksumAlgorithms = []string{"sha1", "sha256"}
+
+// Checksum is a parsed Upload-Checksum header, "<algorithm> <base64 digest>".
+type Checksum struct {
+	Algorithm string
+	Digest    []byte
+}
+
+// ParseChecksum reads an Upload-Checksum header.
+func ParseChecksum(header string) (*Checksum, error) {
+	algorithm, encoded, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok {
+		return nil, fmt.Errorf("invalid checksum %q", header)
+	}
+	digest, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checksum digest: %w", err)
+	}
+
+	checksum := &Checksum{Algorithm: strings.ToLower(algorithm), Digest: digest}
+	if checksum.newHash() == nil {
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+	return checksum, nil
+}
+
+func (c *Checksum) newHash() hash.Hash {
+	switch c.Algorithm {
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	}
+	return nil
+}
+
+// ParseUploadMetadata reads an Upload-Metadata header, comma separated
+// "key base64value" pairs where the value may be left out.
+func ParseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("invalid metadata %q", pair)
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata value for %q: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// Spool keeps unfinished uploads on local disk until they are complete and
+// can go to the store. Uploads are not shared between instances, a load
+// balancer in front of several instances has to keep each upload on one.
+type Spool struct {
+	Dir string
+
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+// NewSpool creates the directory if needed.
+func NewSpool(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &Spool{Dir: dir, busy: map[string]bool{}}, nil
+}
+
+// SpoolDirFromEnv reads UPLOAD_SPOOL_DIR, a directory in the system's temp
+// directory by default.
+func SpoolDirFromEnv() string {
+	if dir := os.Getenv("UPLOAD_SPOOL_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "api-uploads")
+}
+
+func (s *Spool) path(id string) (string, error) {
+	if err := ValidKey(id); err != nil || strings.Contains(id, "/") {
+		return "", fmt.Errorf("invalid upload id %q", id)
+	}
+	return filepath.Join(s.Dir, id), nil
+}
+
+// Append writes a chunk at offset, which is where the previous chunk ended.
+// A chunk that breaks off, goes past length or fails its checksum is cut
+// off again, so the file never holds more than the confirmed offset and the
+// client can resume from there. Returns the new offset.
+func (s *Spool) Append(id string, offset, length int64, chunk io.Reader, checksum *Checksum) (int64, error) {
+	target, err := s.path(id)
+	if err != nil {
+		return offset, err
+	}
+
+	s.mu.Lock()
+	if s.busy[id] {
+		s.mu.Unlock()
+		return offset, ErrUploadBusy
+	}
+	s.busy[id] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.busy, id)
+		s.mu.Unlock()
+	}()
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return offset, err
+	}
+	defer file.Close()
+
+	// Drop whatever an earlier interrupted chunk left behind
+	if err := file.Truncate(offset); err != nil {
+		return offset, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	var h hash.Hash
+	if checksum != nil {
+		h = checksum.newHash()
+		chunk = io.TeeReader(chunk, h)
+	}
+
+	// Read one byte more than allowed to notice an oversized chunk
+	written, err := io.Copy(file, io.LimitReader(chunk, length-offset+1))
+	switch {
+	case err != nil:
+	case offset+written > length:
+		err = ErrUploadTooLarge
+	case h != nil && !bytes.Equal(h.Sum(nil), checksum.Digest):
+		err = ErrChecksumMismatch
+	}
+	if err != nil {
+		file.Truncate(offset)
+		return offset, err
+	}
+
+	return offset + written, file.Sync()
+}
+
+// Open reads a spooled upload.
+func (s *Spool) Open(id string) (*os.File, error) {
+	target, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(target)
+}
+
+// Remove deletes a spooled upload, a missing one is not an error.
+func (s *Spool) Remove(id string) error {
+	target, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
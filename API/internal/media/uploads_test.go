@@ -0,0 +1,92 @@
+package media
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	header := "filename " + base64.StdEncoding.EncodeToString([]byte("clip.mov")) + ",is_private"
+	metadata, err := ParseUploadMetadata(header)
+	if err != nil {
+		t.Fatalf("ParseUploadMetadata: %v", err)
+	}
+	if metadata["filename"] != "clip.mov" {
+		t.Errorf("unexpected filename %q", metadata["filename"])
+	}
+	if value, ok := metadata["is_private"]; !ok || value != "" {
+		t.Errorf("expected a key without value, got %q", value)
+	}
+
+	if _, err := ParseUploadMetadata("filename not-base64!"); err == nil {
+		t.Error("expected an error for a value that is not base64")
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	if _, err := ParseChecksum("md5 " + base64.StdEncoding.EncodeToString([]byte("x"))); err == nil {
+		t.Error("expected md5 to be rejected")
+	}
+	checksum, err := ParseChecksum("SHA1 " + base64.StdEncoding.EncodeToString([]byte("digest")))
+	if err != nil || checksum.Algorithm != "sha1" || string(checksum.Digest) != "digest" {
+		t.Errorf("unexpected checksum %+v, %v", checksum, err)
+	}
+}
+
+func sha1Checksum(data string) *Checksum {
+	sum := sha1.Sum([]byte(data))
+	return &Checksum{Algorithm: "sha1", Digest: sum[:]}
+}
+
+func TestSpoolAppendAndResume(t *testing.T) {
+	spool, err := NewSpool(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const id = "3f1c6a0e-upload"
+	const length = 10
+
+	offset, err := spool.Append(id, 0, length, strings.NewReader("hello"), sha1Checksum("hello"))
+	if err != nil || offset != 5 {
+		t.Fatalf("first chunk: offset %d, %v", offset, err)
+	}
+
+	// A corrupted chunk is thrown away, the offset stays where it was
+	offset, err = spool.Append(id, 5, length, strings.NewReader("w0rld"), sha1Checksum("world"))
+	if !errors.Is(err, ErrChecksumMismatch) || offset != 5 {
+		t.Fatalf("expected a checksum mismatch at offset 5, got %d, %v", offset, err)
+	}
+
+	if _, err := spool.Append(id, 5, length, strings.NewReader("world!"), nil); !errors.Is(err, ErrUploadTooLarge) {
+		t.Fatalf("expected ErrUploadTooLarge, got %v", err)
+	}
+
+	offset, err = spool.Append(id, 5, length, strings.NewReader("world"), nil)
+	if err != nil || offset != length {
+		t.Fatalf("resumed chunk: offset %d, %v", offset, err)
+	}
+
+	file, err := spool.Open(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(file)
+	file.Close()
+	if string(content) != "helloworld" {
+		t.Errorf("unexpected content %q", content)
+	}
+
+	if err := spool.Remove(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := spool.Remove(id); err != nil {
+		t.Errorf("removing a missing upload should succeed, got %v", err)
+	}
+	if _, err := spool.Append("../escape", 0, length, strings.NewReader("x"), nil); err == nil {
+		t.Error("expected an invalid upload id to be rejected")
+	}
+}
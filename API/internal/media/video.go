@@ -0,0 +1,370 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RenditionMaxWidth is the width videos are transcoded down to, the same as
+// the largest image variant.
+const RenditionMaxWidth = 1080
+
+var (
+	// ErrUnsupportedVideo is returned for files ffprobe finds no video stream in.
+	ErrUnsupportedVideo = errors.New("unsupported video, no video stream found")
+	// ErrVideoTooLong is returned for videos over the allowed duration.
+	ErrVideoTooLong = errors.New("video is too long")
+)
+
+// VideoInfo is what Probe found out about a video. Width and Height are
+// those of the upright video, phones record portrait video as rotated
+// landscape.
+type VideoInfo struct {
+	Duration time.Duration
+	Width    int
+	Height   int
+	Codec    string
+	HasAudio bool
+}
+
+// AspectRatio is width over height of the upright video.
+func (v *VideoInfo) AspectRatio() float64 {
+	return float64(v.Width) / float64(v.Height)
+}
+
+// VideoProcessor does the heavy lifting on video files. It works on local
+// paths, ProcessVideo takes care of getting files in and out of the store.
+type VideoProcessor interface {
+	// Probe reads duration, resolution and codec of the video.
+	Probe(ctx context.Context, path string) (*VideoInfo, error)
+	// Poster grabs the frame at the given time as a JPEG.
+	Poster(ctx context.Context, path string, at time.Duration) ([]byte, error)
+	// Transcode writes the standard rendition, an H.264/AAC MP4 at most
+	// RenditionMaxWidth wide that starts playing before it is fully downloaded.
+	Transcode(ctx context.Context, src, dst string) error
+}
+
+// PosterTime picks the poster frame, one second in so it is not the black
+// first frame, or the middle of very short clips.
+func PosterTime(duration time.Duration) time.Duration {
+	return min(time.Second, duration/2)
+}
+
+// ProcessedVideo is the result of ProcessVideo.
+type ProcessedVideo struct {
+	Info   VideoInfo // Of the rendition
+	Video  StoredVariant
+	Poster *ProcessedImage
+	Frames map[string]StoredVariant // The poster in every PostImageVariants size
+}
+
+// Keys lists what ProcessVideo stored itself, to remove it again. Reused
+// objects are left out, they belong to someone else too.
+func (p *ProcessedVideo) Keys() []string {
+	var keys []string
+	for _, file := range p.Files() {
+		if !file.Reused {
+			keys = append(keys, file.Key)
+		}
+	}
+	return keys
+}
+
+// Files lists the rendition and every poster frame.
+func (p *ProcessedVideo) Files() []StoredVariant {
+	files := []StoredVariant{p.Video}
+	for _, frame := range p.Frames {
+		files = append(files, frame)
+	}
+	return files
+}
+
+// ProcessVideo turns the original upload stored under sourceKey into the
+// standard rendition and a poster frame, both stored under folder unless
+// the index, which may be nil, has them already. The original itself is
+// left alone.
+func ProcessVideo(ctx context.Context, processor VideoProcessor, store MediaStore, index ContentIndex, sourceKey, folder string, maxDuration time.Duration) (*ProcessedVideo, error) {
+	dir, err := os.MkdirTemp("", "video-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source"+path.Ext(sourceKey))
+	if err := download(ctx, store, sourceKey, source); err != nil {
+		return nil, err
+	}
+
+	info, err := processor.Probe(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	if info.Duration > maxDuration {
+		return nil, fmt.Errorf("%w: %s, at most %s is allowed", ErrVideoTooLong, info.Duration.Round(time.Second), maxDuration)
+	}
+
+	frame, err := processor.Poster(ctx, source, PosterTime(info.Duration))
+	if err != nil {
+		return nil, err
+	}
+	poster, err := ProcessImage(bytes.NewReader(frame), PostImageVariants)
+	if err != nil {
+		return nil, fmt.Errorf("poster frame: %w", err)
+	}
+
+	rendition := filepath.Join(dir, "rendition.mp4")
+	if err := processor.Transcode(ctx, source, rendition); err != nil {
+		return nil, err
+	}
+	renditionInfo, err := processor.Probe(ctx, rendition)
+	if err != nil {
+		return nil, err
+	}
+
+	frames, err := StoreImage(ctx, store, index, folder, poster)
+	if err != nil {
+		return nil, err
+	}
+	processed := &ProcessedVideo{Info: *renditionInfo, Poster: poster, Frames: frames}
+	deleteFrames := func() {
+		for _, key := range processed.Keys() {
+			store.Delete(ctx, key)
+		}
+	}
+
+	video, err := storeRendition(ctx, store, index, rendition, NewKey(folder, "video.mp4"))
+	if err != nil {
+		deleteFrames()
+		return nil, err
+	}
+	processed.Video = *video
+	return processed, nil
+}
+
+// storeRendition puts the transcoded file under key, or reuses a rendition
+// with the same content.
+func storeRendition(ctx context.Context, store MediaStore, index ContentIndex, rendition, key string) (*StoredVariant, error) {
+	file, err := os.Open(rendition)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sum, err := SHA256Of(file)
+	if err != nil {
+		return nil, err
+	}
+	if index != nil {
+		reusedKey, url, ok, err := index.ReuseContent(sum)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &StoredVariant{Key: reusedKey, URL: url, SHA256: sum, Reused: true}, nil
+		}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	object, err := store.Put(ctx, key, file, info.Size(), "video/mp4")
+	if err != nil {
+		return nil, err
+	}
+	return &StoredVariant{Key: key, URL: object.URL, Size: object.Size, SHA256: sum}, nil
+}
+
+func download(ctx context.Context, store MediaStore, key, dst string) error {
+	src, err := store.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	file, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, src); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// FFmpegProcessor implements VideoProcessor with the ffmpeg and ffprobe binaries.
+type FFmpegProcessor struct {
+	FFmpegPath  string
+	FFprobePath string
+}
+
+// NewFFmpegProcessor finds ffmpeg and ffprobe in FFMPEG_PATH and
+// FFPROBE_PATH, or on the PATH.
+func NewFFmpegProcessor() (*FFmpegProcessor, error) {
+	ffmpeg, err := lookPath("FFMPEG_PATH", "ffmpeg")
+	if err != nil {
+		return nil, err
+	}
+	ffprobe, err := lookPath("FFPROBE_PATH", "ffprobe")
+	if err != nil {
+		return nil, err
+	}
+	return &FFmpegProcessor{FFmpegPath: ffmpeg, FFprobePath: ffprobe}, nil
+}
+
+func lookPath(env, name string) (string, error) {
+	if configured := os.Getenv(env); configured != "" {
+		name = configured
+	}
+	found, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%s not found, install it or set %s: %w", name, env, err)
+	}
+	return found, nil
+}
+
+func (p *FFmpegProcessor) Probe(ctx context.Context, path string) (*VideoInfo, error) {
+	out, err := run(ctx, p.FFprobePath, append(inputArgs(path),
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format", "-show_streams",
+	)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseProbe(out)
+}
+
+func (p *FFmpegProcessor) Poster(ctx context.Context, path string, at time.Duration) ([]byte, error) {
+	return run(ctx, p.FFmpegPath, slices.Concat([]string{
+		"-v", "error",
+		"-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64),
+	}, inputArgs(path), []string{
+		"-frames:v", "1",
+		"-f", "image2", "-c:v", "mjpeg",
+		"pipe:1",
+	})...)
+}
+
+func (p *FFmpegProcessor) Transcode(ctx context.Context, src, dst string) error {
+	_, err := run(ctx, p.FFmpegPath, slices.Concat([]string{
+		"-v", "error", "-y",
+	}, inputArgs(src), []string{
+		// Never upscale, and keep the height even as H.264 requires
+		"-vf", fmt.Sprintf("scale='min(%d,iw)':-2", RenditionMaxWidth),
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-b:a", "128k",
+		"-movflags", "+faststart",
+		// Drops metadata such as the GPS position phones record
+		"-map_metadata", "-1",
+		dst,
+	})...)
+	return err
+}
+
+// videoDemuxers are the ffmpeg demuxers of the containers LooksLikeVideo
+// accepts, mov also reads the MP4 renditions.
+const videoDemuxers = "mov,matroska,avi,flv,asf"
+
+// inputArgs opens path as a plain local file in one of videoDemuxers. Left
+// to guess, ffmpeg would also open playlists and concat lists whose entries
+// read other local files or fetch URLs.
+func inputArgs(path string) []string {
+	return []string{
+		"-protocol_whitelist", "file",
+		"-format_whitelist", videoDemuxers,
+		"-i", "file:" + path,
+	}
+}
+
+// run executes the command and returns its stdout, or an error carrying stderr.
+func run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", filepath.Base(name), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+type probeOutput struct {
+	Streams []struct {
+		CodecType string            `json:"codec_type"`
+		CodecName string            `json:"codec_name"`
+		Width     int               `json:"width"`
+		Height    int               `json:"height"`
+		Tags      map[string]string `json:"tags"`
+		SideData  []struct {
+			Rotation float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// parseProbe reads the JSON output of ffprobe. Rotation is either a "rotate"
+// tag (older ffmpeg) or a display matrix side data entry.
+func parseProbe(data []byte) (*VideoInfo, error) {
+	var out probeOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("reading ffprobe output: %w", err)
+	}
+
+	info := &VideoInfo{}
+	found := false
+	for _, stream := range out.Streams {
+		switch stream.CodecType {
+		case "audio":
+			info.HasAudio = true
+		case "video":
+			// Cover art in audio files shows up as a video stream too, keep the first
+			if found {
+				continue
+			}
+			found = true
+			info.Codec = stream.CodecName
+			info.Width, info.Height = stream.Width, stream.Height
+
+			rotation, _ := strconv.ParseFloat(stream.Tags["rotate"], 64)
+			for _, side := range stream.SideData {
+				if side.Rotation != 0 {
+					rotation = side.Rotation
+				}
+			}
+			if int(rotation)%180 != 0 {
+				info.Width, info.Height = info.Height, info.Width
+			}
+		}
+	}
+	if !found || info.Width <= 0 || info.Height <= 0 {
+		return nil, ErrUnsupportedVideo
+	}
+
+	seconds, err := strconv.ParseFloat(out.Format.Duration, 64)
+	if err != nil || seconds <= 0 {
+		return nil, ErrUnsupportedVideo
+	}
+	info.Duration = time.Duration(seconds * float64(time.Second))
+
+	return info, nil
+}
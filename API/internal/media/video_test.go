@@ -0,0 +1,121 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/jpeg"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProcessor stands in for ffmpeg, which is not available in tests. The
+// "rendition" is a copy of the source.
+type fakeProcessor struct {
+	info       VideoInfo
+	transcoded bool
+}
+
+func (f *fakeProcessor) Probe(ctx context.Context, path string) (*VideoInfo, error) {
+	info := f.info
+	return &info, nil
+}
+
+func (f *fakeProcessor) Poster(ctx context.Context, path string, at time.Duration) ([]byte, error) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, testImage(f.info.Width, f.info.Height), nil)
+	return buf.Bytes(), err
+}
+
+func (f *fakeProcessor) Transcode(ctx context.Context, src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	f.transcoded = true
+	return os.WriteFile(dst, data, 0o644)
+}
+
+func TestParseProbe(t *testing.T) {
+	// A portrait phone video: stored landscape with a display matrix rotation
+	output := `{
+		"streams": [
+			{"codec_type": "video", "codec_name": "hevc", "width": 1920, "height": 1080,
+			 "side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]},
+			{"codec_type": "audio", "codec_name": "aac"}
+		],
+		"format": {"duration": "12.480000"}
+	}`
+
+	info, err := parseProbe([]byte(output))
+	if err != nil {
+		t.Fatalf("parseProbe: %v", err)
+	}
+	if info.Width != 1080 || info.Height != 1920 {
+		t.Errorf("expected an upright 1080x1920 video, got %dx%d", info.Width, info.Height)
+	}
+	if info.Codec != "hevc" || !info.HasAudio || info.Duration != 12480*time.Millisecond {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	audioOnly := `{"streams": [{"codec_type": "audio", "codec_name": "mp3"}], "format": {"duration": "200"}}`
+	if _, err := parseProbe([]byte(audioOnly)); !errors.Is(err, ErrUnsupportedVideo) {
+		t.Errorf("expected ErrUnsupportedVideo for an audio file, got %v", err)
+	}
+}
+
+func TestPosterTime(t *testing.T) {
+	if got := PosterTime(30 * time.Second); got != time.Second {
+		t.Errorf("expected the frame one second in, got %s", got)
+	}
+	if got := PosterTime(time.Second); got != 500*time.Millisecond {
+		t.Errorf("expected the middle of a short clip, got %s", got)
+	}
+}
+
+func TestProcessVideo(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir(), "http://localhost/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sourceKey := NewKey("originals", "clip.MOV")
+	if _, err := store.Put(ctx, sourceKey, strings.NewReader("fake video"), -1, "video/quicktime"); err != nil {
+		t.Fatal(err)
+	}
+
+	processor := &fakeProcessor{info: VideoInfo{Duration: 20 * time.Second, Width: 720, Height: 1280, Codec: "h264"}}
+
+	if _, err := ProcessVideo(ctx, processor, store, nil, sourceKey, "stories", 15*time.Second); !errors.Is(err, ErrVideoTooLong) {
+		t.Fatalf("expected ErrVideoTooLong, got %v", err)
+	}
+	if processor.transcoded {
+		t.Error("a video over the limit should not be transcoded")
+	}
+
+	processed, err := ProcessVideo(ctx, processor, store, nil, sourceKey, "posts", time.Minute)
+	if err != nil {
+		t.Fatalf("ProcessVideo: %v", err)
+	}
+	if !strings.HasPrefix(processed.Video.Key, "posts/") || !strings.HasSuffix(processed.Video.Key, ".mp4") {
+		t.Errorf("unexpected video key %q", processed.Video.Key)
+	}
+	if processed.Info.Width != 720 || processed.Poster.BlurHash == "" {
+		t.Errorf("unexpected result %+v", processed)
+	}
+
+	if len(processed.Keys()) != 1+len(PostImageVariants) {
+		t.Errorf("expected the video and every poster variant, got %v", processed.Keys())
+	}
+	for _, key := range processed.Keys() {
+		if _, err := store.Stat(ctx, key); err != nil {
+			t.Errorf("%s was not stored: %v", key, err)
+		}
+	}
+	if _, err := store.Stat(ctx, sourceKey); err != nil {
+		t.Errorf("the original should be left alone, got %v", err)
+	}
+}
@@ -1,29 +1,45 @@
 package middleware
 
 import (
+	models "API/internal/Models"
+	"API/internal/database"
 	"API/internal/utils"
 	"context"
+	"errors"
+	"log"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
-func AuthRequired() fiber.Handler {
+// loadUser returns the user from the Redis cache, falling back to Postgres
+// and filling the cache on a miss.
+func loadUser(ctx context.Context, db database.Service, userID uint) (*models.User, error) {
+	user, err := utils.GetCachedUser(ctx, userID)
+	if err != nil {
+		log.Printf("Error reading user %d from cache: %v", userID, err)
+	}
+	if user != nil {
+		return user, nil
+	}
+
+	user, err = db.FindUserById(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := utils.CacheUser(ctx, user); err != nil {
+		log.Printf("Error caching user %d: %v", userID, err)
+	}
+	return user, nil
+}
+
+func AuthRequired(db database.Service) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
-
-		// Check token in Redis first (faster than JWT verification)
-		tokenKey := "token:" + authHeader
 		ctx := context.Background()
 
-		// Try to get from Redis cache first
-		if cachedClaims, err := utils.RedisClient.Get(ctx, tokenKey).Result(); err == nil {
-			// Token found in cache, set user context
-			c.Locals("user", cachedClaims)
-			return c.Next()
-		}
-
-		// Not in cache, verify JWT
 		claims, err := utils.ExtractTokenFromHeader(authHeader)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -32,10 +48,54 @@ func AuthRequired() fiber.Handler {
 			})
 		}
 
-		// Store in Redis for future requests
-		utils.RedisClient.Set(ctx, tokenKey, claims, 24*time.Hour)
+		// A valid signature is not enough, the token or its session may have been logged out
+		revoked, revokeErr := utils.IsTokenRevoked(ctx, claims)
+		if revokeErr != nil {
+			log.Printf("Error checking token deny-list: %v", revokeErr)
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error":  "Authentication is temporarily unavailable",
+				"status": fiber.StatusServiceUnavailable,
+			})
+		}
+		if revoked {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":  "Token has been revoked",
+				"status": fiber.StatusUnauthorized,
+			})
+		}
+
+		userID, subjectErr := claims.UserID()
+		if subjectErr != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":  "Invalid token",
+				"status": fiber.StatusUnauthorized,
+			})
+		}
+
+		user, userErr := loadUser(ctx, db, userID)
+		if userErr != nil {
+			if errors.Is(userErr, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error":  "Account no longer exists",
+					"status": fiber.StatusUnauthorized,
+				})
+			}
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Database error", userErr.Error())
+		}
+
+		if user.IsBanned(time.Now()) {
+			return utils.SendErrorResponse(c, fiber.StatusForbidden, "Account suspended", BanDetails(user))
+		}
 
-		c.Locals("user", claims)
+		// Roles come from the user, not the token, so a demotion applies at once
+		c.Locals(principalKey, &Principal{
+			UserID:    userID,
+			SessionID: claims.SessionID,
+			TokenID:   claims.ID,
+			ExpiresAt: claims.ExpiresAt.Time,
+			Roles:     userRoles(user),
+			User:      user,
+		})
 		return c.Next()
 	}
 }
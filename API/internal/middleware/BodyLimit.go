@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"API/internal/utils"
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BodyLimitRoute raises the body limit of the requests matching Method and
+// Path. A Path ending in "/" matches everything below it.
+type BodyLimitRoute struct {
+	Method string
+	Path   string
+	Limit  int
+}
+
+func (r BodyLimitRoute) matches(c *fiber.Ctx) bool {
+	if c.Method() != r.Method {
+		return false
+	}
+	if strings.HasSuffix(r.Path, "/") {
+		return strings.HasPrefix(c.Path(), r.Path)
+	}
+	return c.Path() == r.Path
+}
+
+// BodyLimit answers 413 to requests whose body is larger than limit, or
+// than the limit of the first of routes they match. The server streams
+// request bodies (fiber.Config.StreamRequestBody) so a route can take more
+// than the rest, this is what keeps everything else small. It must run
+// before anything reading the body.
+func BodyLimit(limit int, routes ...BodyLimitRoute) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		allowed := limit
+		for _, route := range routes {
+			if route.matches(c) {
+				allowed = route.Limit
+				break
+			}
+		}
+
+		req := c.Request()
+		length := req.Header.ContentLength()
+		if length > allowed {
+			return tooLarge(c, allowed)
+		}
+		// Chunked bodies announce no length, read at most one byte too many
+		if length < 0 && req.IsBodyStream() {
+			var body bytes.Buffer
+			if _, err := io.Copy(&body, io.LimitReader(req.BodyStream(), int64(allowed)+1)); err != nil {
+				return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Failed to read request body", err.Error())
+			}
+			if body.Len() > allowed {
+				return tooLarge(c, allowed)
+			}
+			req.SetBody(body.Bytes())
+		}
+
+		return c.Next()
+	}
+}
+
+func tooLarge(c *fiber.Ctx, limit int) error {
+	// The rest of the body is never read, the connection cannot be reused
+	c.Set(fiber.HeaderConnection, "close")
+	return utils.SendErrorResponse(c, fiber.StatusRequestEntityTooLarge, "Request body is too large", fiber.Map{
+		"max_size": limit,
+	})
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	models "API/internal/Models"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// principalKey is where AuthRequired stores the Principal in c.Locals
+const principalKey = "principal"
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID    uint
+	SessionID string    // Refresh token family, the sid claim
+	TokenID   string    // jti of the access token, used to revoke it
+	ExpiresAt time.Time // When the access token expires
+	Roles     []string
+	User      *models.User // Cached copy, may be a few minutes stale for counters
+}
+
+// HasRole reports whether the principal holds any of the given roles.
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if slices.Contains(p.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentPrincipal returns the principal set by AuthRequired.
+func CurrentPrincipal(c *fiber.Ctx) (*Principal, bool) {
+	principal, ok := c.Locals(principalKey).(*Principal)
+	return principal, ok && principal != nil
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"API/internal/utils"
+	"context"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RateLimitPolicy is a named limit of Limit requests per Window, counted per
+// whatever Key returns. The name keeps policies that share a key apart.
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int64
+	Window time.Duration
+	Key    func(c *fiber.Ctx) string
+}
+
+// ByIP counts requests per client IP.
+func ByIP(c *fiber.Ctx) string {
+	return "ip:" + c.IP()
+}
+
+// ByUser counts requests per signed in user, and per IP before AuthRequired.
+func ByUser(c *fiber.Ctx) string {
+	if principal, ok := CurrentPrincipal(c); ok {
+		return "user:" + strconv.FormatUint(uint64(principal.UserID), 10)
+	}
+	return ByIP(c)
+}
+
+// RateLimit enforces the policy across every instance through Redis and
+// reports the window in the RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers, plus Retry-After once the limit is hit.
+// If Redis is down requests go through rather than failing the whole API.
+func RateLimit(policy RateLimitPolicy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := policy.Name + ":" + policy.Key(c)
+		result, err := utils.RateLimit(context.Background(), key, policy.Limit, policy.Window)
+		if err != nil {
+			log.Printf("Rate limit check failed for %s: %v", key, err)
+			return c.Next()
+		}
+
+		reset := strconv.Itoa(int(math.Ceil(result.Reset.Seconds())))
+		c.Set("RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+		c.Set("RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+		c.Set("RateLimit-Reset", reset)
+
+		if !result.Allowed {
+			c.Set(fiber.HeaderRetryAfter, reset)
+			return utils.SendErrorResponse(c, fiber.StatusTooManyRequests, "Too many requests, please slow down", fiber.Map{
+				"code": "rate_limited",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	models "API/internal/Models"
+	"API/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireRole only lets through principals holding one of the given roles.
+// It must run after AuthRequired.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := CurrentPrincipal(c)
+		if !ok {
+			return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+		}
+
+		if !principal.HasRole(roles...) {
+			return utils.SendErrorResponse(c, fiber.StatusForbidden, "You are not allowed to do this", fiber.Map{
+				"code": "forbidden",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// userRoles returns the roles of the user, treating rows from before roles
+// existed as regular users.
+func userRoles(user *models.User) []string {
+	if user.Role == "" {
+		return []string{models.RoleUser}
+	}
+	return []string{user.Role}
+}
+
+// BanDetails is what a banned or suspended user is told about it.
+func BanDetails(user *models.User) fiber.Map {
+	return fiber.Map{
+		"code":       "account_suspended",
+		"reason":     user.BanReason,
+		"expires_at": user.BanExpiresAt,
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"API/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireVerifiedEmail blocks the route until the user verified their email.
+// It must run after AuthRequired.
+func RequireVerifiedEmail() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := CurrentPrincipal(c)
+		if !ok {
+			return utils.SendErrorResponse(c, fiber.StatusUnauthorized, "Invalid or missing authentication", nil)
+		}
+
+		if !principal.User.EmailVerified {
+			return utils.SendErrorResponse(c, fiber.StatusForbidden, "Please verify your email address first", fiber.Map{
+				"code": "email_unverified",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	models "API/internal/Models"
+	"API/internal/config"
+	"API/internal/database"
+	"API/internal/utils"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// adminTestDB stands in for Postgres behind the admin routes. It holds the
+// users and keeps the audit entries the handlers hand to the database, so
+// the tests see what would have been written. Any other method panics.
+type adminTestDB struct {
+	database.Service
+	users map[uint]*models.User
+	audit []models.AuditLog
+}
+
+func (db *adminTestDB) FindUserById(id uint) (*models.User, error) {
+	user, ok := db.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (db *adminTestDB) BanUser(userID uint, reason string, expiresAt *time.Time, entry models.AuditLog) error {
+	now := time.Now()
+	db.users[userID].BannedAt = &now
+	db.audit = append(db.audit, entry)
+	return nil
+}
+
+func (db *adminTestDB) SetUserRole(userID uint, role string, entry models.AuditLog) error {
+	db.users[userID].Role = role
+	db.audit = append(db.audit, entry)
+	return nil
+}
+
+func (db *adminTestDB) CreateAuditLog(entry models.AuditLog) error {
+	db.audit = append(db.audit, entry)
+	return nil
+}
+
+func (db *adminTestDB) RevokeUserRefreshTokens(userID uint) ([]string, error) {
+	return nil, nil
+}
+
+func (db *adminTestDB) DeleteBlockedImage(id uint, entry models.AuditLog) (bool, error) {
+	db.audit = append(db.audit, entry)
+	return true, nil
+}
+
+func (db *adminTestDB) RequeueOutboxMessage(id uint, entry models.AuditLog) (bool, error) {
+	db.audit = append(db.audit, entry)
+	return true, nil
+}
+
+// IDs of the accounts newAdminTestServer creates
+const (
+	testUserID      = 1
+	testModeratorID = 2
+	testAdminID     = 3
+	testOtherModID  = 4
+)
+
+// newTestServer serves every route from db, with Redis in memory and an
+// HS256 signing key.
+func newTestServer(t *testing.T, db database.Service) *FiberServer {
+	t.Helper()
+
+	utils.RedisClient = redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { utils.RedisClient = nil })
+
+	key, err := config.ParseSigningKey("test", config.AlgHS256, []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("ParseSigningKey: %v", err)
+	}
+	utils.SetJWTKeys(&config.JWTKeys{Active: key, Keys: map[string]*config.SigningKey{key.ID: key}})
+
+	s := &FiberServer{App: newApp(ProxyConfig{}), db: db}
+	s.RegisterFiberRoutes()
+	return s
+}
+
+func newAdminTestServer(t *testing.T) (*FiberServer, *adminTestDB) {
+	t.Helper()
+
+	db := &adminTestDB{users: map[uint]*models.User{
+		testUserID:      {ID: testUserID, Username: "user", Role: models.RoleUser},
+		testModeratorID: {ID: testModeratorID, Username: "moderator", Role: models.RoleModerator},
+		testAdminID:     {ID: testAdminID, Username: "admin", Role: models.RoleAdmin},
+		testOtherModID:  {ID: testOtherModID, Username: "moderator2", Role: models.RoleModerator},
+	}}
+	return newTestServer(t, db), db
+}
+
+// adminRequest sends the request as the user and returns the status code.
+func adminRequest(t *testing.T, s *FiberServer, as uint, method, path, body string) int {
+	t.Helper()
+
+	user := &models.User{ID: as}
+	token, err := utils.GenerateToken(user, "session-"+strconv.Itoa(int(as)))
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	req, err := http.NewRequest(method, path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.App.Test(req, -1)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode
+}
+
+func TestAdminRoutesRequireStaff(t *testing.T) {
+	s, db := newAdminTestServer(t)
+
+	for _, tc := range []struct {
+		name         string
+		as           uint
+		method, path string
+		body         string
+	}{
+		{"user looks up an account", testUserID, http.MethodGet, "/api/v1/admin/users/2", ""},
+		{"user bans", testUserID, http.MethodPost, "/api/v1/admin/users/4/ban", `{"reason":"spam"}`},
+		{"moderator changes a role", testModeratorID, http.MethodPut, "/api/v1/admin/users/1/role", `{"role":"moderator"}`},
+		{"moderator reads the audit log", testModeratorID, http.MethodGet, "/api/v1/admin/audit-log", ""},
+		{"moderator retries an email", testModeratorID, http.MethodPost, "/api/v1/admin/outbox/1/retry", ""},
+		{"moderator bans an admin", testModeratorID, http.MethodPost, "/api/v1/admin/users/3/ban", `{"reason":"spam"}`},
+		{"moderator bans a moderator", testModeratorID, http.MethodPost, "/api/v1/admin/users/4/ban", `{"reason":"spam"}`},
+		{"moderator bans themselves", testModeratorID, http.MethodPost, "/api/v1/admin/users/2/ban", `{"reason":"spam"}`},
+		{"admin demotes themselves", testAdminID, http.MethodPut, "/api/v1/admin/users/3/role", `{"role":"user"}`},
+	} {
+		if status := adminRequest(t, s, tc.as, tc.method, tc.path, tc.body); status != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d", tc.name, status)
+		}
+	}
+
+	if len(db.audit) != 0 {
+		t.Errorf("refused actions were audited: %+v", db.audit)
+	}
+	for _, user := range db.users {
+		if user.BannedAt != nil {
+			t.Errorf("%s was banned by a refused request", user.Username)
+		}
+	}
+	if db.users[testUserID].Role != models.RoleUser || db.users[testAdminID].Role != models.RoleAdmin {
+		t.Errorf("roles were changed by a refused request")
+	}
+}
+
+func TestAdminActionsAreAudited(t *testing.T) {
+	s, db := newAdminTestServer(t)
+
+	for _, tc := range []struct {
+		as           uint
+		method, path string
+		body         string
+		action       string
+		targetUserID uint
+		targetType   string
+		targetID     uint
+	}{
+		{testModeratorID, http.MethodPost, "/api/v1/admin/users/1/ban", `{"reason":"spam"}`, models.AuditUserBanned, testUserID, "", 0},
+		{testModeratorID, http.MethodPost, "/api/v1/admin/users/1/logout", "", models.AuditUserForcedLogout, testUserID, "", 0},
+		{testModeratorID, http.MethodDelete, "/api/v1/admin/media/blocklist/7", `{"reason":"false positive"}`, models.AuditImageUnblocked, 0, models.AuditTargetBlockedImage, 7},
+		{testAdminID, http.MethodPut, "/api/v1/admin/users/4/role", `{"role":"user"}`, models.AuditUserRoleChanged, testOtherModID, "", 0},
+		{testAdminID, http.MethodPost, "/api/v1/admin/outbox/9/retry", "", models.AuditOutboxRetried, 0, models.AuditTargetOutbox, 9},
+	} {
+		before := len(db.audit)
+		if status := adminRequest(t, s, tc.as, tc.method, tc.path, tc.body); status != http.StatusOK {
+			t.Fatalf("%s %s: expected 200, got %d", tc.method, tc.path, status)
+		}
+		if len(db.audit) != before+1 {
+			t.Fatalf("%s %s: expected one audit entry, got %d", tc.method, tc.path, len(db.audit)-before)
+		}
+
+		entry := db.audit[before]
+		if entry.Action != tc.action || entry.ActorID != tc.as || entry.ActorRole != db.users[tc.as].Role {
+			t.Errorf("%s %s: unexpected entry %+v", tc.method, tc.path, entry)
+		}
+		if tc.targetUserID != 0 && (entry.TargetUserID == nil || *entry.TargetUserID != tc.targetUserID) {
+			t.Errorf("%s %s: expected target user %d, got %v", tc.method, tc.path, tc.targetUserID, entry.TargetUserID)
+		}
+		if tc.targetType != "" && (entry.TargetType != tc.targetType || entry.TargetID == nil || *entry.TargetID != tc.targetID) {
+			t.Errorf("%s %s: expected target %s %d, got %s %v", tc.method, tc.path, tc.targetType, tc.targetID, entry.TargetType, entry.TargetID)
+		}
+		if !json.Valid([]byte(entry.Metadata)) {
+			t.Errorf("%s %s: metadata is not JSON: %q", tc.method, tc.path, entry.Metadata)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/utils"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// cacheTestDB counts how often AuthRequired has to load the user.
+type cacheTestDB struct {
+	database.Service
+	user    models.User
+	lookups int
+}
+
+func (db *cacheTestDB) FindUserById(id uint) (*models.User, error) {
+	db.lookups++
+	if id != db.user.ID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	user := db.user
+	return &user, nil
+}
+
+func (db *cacheTestDB) FindActiveSessions(userID uint, since time.Time) ([]models.Session, error) {
+	return nil, nil
+}
+
+func TestAuthRequiredCachesUser(t *testing.T) {
+	db := &cacheTestDB{user: models.User{ID: testUserID, Username: "user", Role: models.RoleUser}}
+	s := newTestServer(t, db)
+
+	for range 3 {
+		if status := adminRequest(t, s, testUserID, http.MethodGet, "/api/v1/sessions", ""); status != http.StatusOK {
+			t.Fatalf("expected 200, got %d", status)
+		}
+	}
+	if db.lookups != 1 {
+		t.Errorf("expected the user to be loaded once, got %d lookups", db.lookups)
+	}
+
+	// Until the cache is dropped, requests see the user as it was
+	now := time.Now()
+	db.user.BannedAt = &now
+	if status := adminRequest(t, s, testUserID, http.MethodGet, "/api/v1/sessions", ""); status != http.StatusOK {
+		t.Fatalf("expected the cached user to be used, got %d", status)
+	}
+
+	if err := utils.InvalidateUserCache(context.Background(), testUserID); err != nil {
+		t.Fatalf("InvalidateUserCache: %v", err)
+	}
+	if status := adminRequest(t, s, testUserID, http.MethodGet, "/api/v1/sessions", ""); status != http.StatusForbidden {
+		t.Errorf("expected the ban to apply once the cache is dropped, got %d", status)
+	}
+	if db.lookups != 2 {
+		t.Errorf("expected the user to be loaded again, got %d lookups", db.lookups)
+	}
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	db := &cacheTestDB{user: models.User{ID: testUserID, Username: "user", Role: models.RoleUser}}
+	s := newTestServer(t, db)
+
+	// Renaming "all" is refused by the handler, past the middleware
+	if status := adminRequest(t, s, testUserID, http.MethodPut, "/api/v1/collections/all", `{"name":"Trips"}`); status != http.StatusForbidden {
+		t.Errorf("expected 403 with an unverified email, got %d", status)
+	}
+	// Reading is allowed before verifying
+	if status := adminRequest(t, s, testUserID, http.MethodGet, "/api/v1/sessions", ""); status != http.StatusOK {
+		t.Errorf("expected 200 on a route without the check, got %d", status)
+	}
+
+	db.user.EmailVerified = true
+	if err := utils.InvalidateUserCache(context.Background(), testUserID); err != nil {
+		t.Fatalf("InvalidateUserCache: %v", err)
+	}
+	if status := adminRequest(t, s, testUserID, http.MethodPut, "/api/v1/collections/all", `{"name":"Trips"}`); status != http.StatusBadRequest {
+		t.Errorf("expected the handler to answer once verified, got %d", status)
+	}
+}
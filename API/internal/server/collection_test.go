@@ -0,0 +1,66 @@
+package server
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// collectionTestDB keeps the collections of the test user. Names in taken
+// were created by a concurrent request: they are not listed yet, but the
+// unique index rejects them.
+type collectionTestDB struct {
+	database.Service
+	collections []models.Collection
+	taken       map[string]bool
+}
+
+func (db *collectionTestDB) FindUserById(id uint) (*models.User, error) {
+	if id != testUserID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &models.User{ID: testUserID, Username: "user", Role: models.RoleUser, EmailVerified: true}, nil
+}
+
+func (db *collectionTestDB) FindCollectionsByUser(userID uint) ([]models.Collection, error) {
+	return db.collections, nil
+}
+
+func (db *collectionTestDB) CreateCollection(collection models.Collection) (*models.Collection, error) {
+	if db.taken[strings.ToLower(collection.Name)] {
+		return nil, database.ErrCollectionNameTaken
+	}
+	collection.ID = uint(len(db.collections) + 1)
+	db.collections = append(db.collections, collection)
+	return &collection, nil
+}
+
+func TestCreateCollection(t *testing.T) {
+	db := &collectionTestDB{taken: map[string]bool{"trips": true}}
+	s := newTestServer(t, db)
+
+	for _, tc := range []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"longest name", `{"name":"` + strings.Repeat("a", 100) + `"}`, http.StatusCreated},
+		{"same name in another case", `{"name":"` + strings.Repeat("A", 100) + `"}`, http.StatusConflict},
+		// 100 characters, but 500 once escaped for the size:100 column
+		{"name too long once escaped", `{"name":"` + strings.Repeat("&", 100) + `"}`, http.StatusBadRequest},
+		{"name created concurrently", `{"name":"Trips"}`, http.StatusConflict},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if status := adminRequest(t, s, testUserID, http.MethodPost, "/api/v1/collections", tc.body); status != tc.status {
+				t.Errorf("expected %d, got %d", tc.status, status)
+			}
+		})
+	}
+	if len(db.collections) != 1 {
+		t.Errorf("expected one collection to be created, got %d", len(db.collections))
+	}
+}
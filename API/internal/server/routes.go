@@ -1,7 +1,9 @@
 package server
 
 import (
+	models "API/internal/Models"
 	"API/internal/controllers"
+	"API/internal/media"
 	"API/internal/middleware"
 	"API/internal/utils"
 	"time"
@@ -10,6 +12,31 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/cors"
 )
 
+// Rate limits per route group and per action. Group limits are a coarse cap
+// on any client, action limits follow what a normal user would ever need.
+var (
+	authLimit       = middleware.RateLimitPolicy{Name: "auth", Limit: 60, Window: time.Minute, Key: middleware.ByIP}
+	apiLimit        = middleware.RateLimitPolicy{Name: "api", Limit: 600, Window: time.Minute, Key: middleware.ByUser}
+	registerLimit   = middleware.RateLimitPolicy{Name: "register", Limit: 5, Window: time.Hour, Key: middleware.ByIP}
+	loginLimit      = middleware.RateLimitPolicy{Name: "login", Limit: 20, Window: time.Minute, Key: middleware.ByIP}
+	passwordLimit   = middleware.RateLimitPolicy{Name: "password", Limit: 10, Window: time.Hour, Key: middleware.ByIP}
+	postLimit       = middleware.RateLimitPolicy{Name: "posts", Limit: 25, Window: time.Hour, Key: middleware.ByUser}
+	storyLimit      = middleware.RateLimitPolicy{Name: "stories", Limit: 100, Window: 24 * time.Hour, Key: middleware.ByUser}
+	uploadLimit     = middleware.RateLimitPolicy{Name: "uploads", Limit: 100, Window: time.Hour, Key: middleware.ByUser}
+	saveLimit       = middleware.RateLimitPolicy{Name: "saves", Limit: 60, Window: time.Minute, Key: middleware.ByUser}
+	collectionLimit = middleware.RateLimitPolicy{Name: "collections", Limit: 50, Window: 24 * time.Hour, Key: middleware.ByUser}
+)
+
+// Request bodies are read into memory, only the routes taking photos and
+// videos accept more than fiber's default of 4MB.
+const mediaBodyLimit = 100 * 1024 * 1024 // A carousel of full resolution photos, larger files use resumable uploads
+
+var bodyLimits = []middleware.BodyLimitRoute{
+	{Method: fiber.MethodPost, Path: "/api/v1/posts", Limit: mediaBodyLimit},
+	{Method: fiber.MethodPost, Path: "/api/v1/stories", Limit: mediaBodyLimit},
+	{Method: fiber.MethodPatch, Path: "/api/v1/uploads/", Limit: models.MaxUploadChunkSize},
+}
+
 func NewServer() *fiber.App {
 	app := fiber.New(fiber.Config{
 		Prefork:              false,
@@ -34,26 +61,137 @@ func (s *FiberServer) RegisterFiberRoutes() {
 	// Apply CORS middleware
 	s.App.Use(cors.New(cors.Config{
 		AllowOrigins:     "*",
-		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS,PATCH",
-		AllowHeaders:     "Accept,Authorization,Content-Type",
+		AllowMethods:     "GET,HEAD,POST,PUT,DELETE,OPTIONS,PATCH",
+		AllowHeaders:     "Accept,Authorization,Content-Type,Tus-Resumable,Upload-Length,Upload-Metadata,Upload-Offset,Upload-Checksum,X-Device-ID",
+		ExposeHeaders:    "Location,Tus-Resumable,Tus-Version,Tus-Extension,Tus-Max-Size,Tus-Max-Chunk-Size,Tus-Checksum-Algorithm,Upload-Offset,Upload-Length,Upload-Expires,X-Device-ID",
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
+	s.App.Use(middleware.BodyLimit(fiber.DefaultBodyLimit, bodyLimits...))
 
-	authController := controllers.NewAuthController(s.db)
+	authController := controllers.NewAuthController(s.db, s.media, s.emails)
+	sessionController := controllers.NewSessionController(s.db)
+	collectionController := controllers.NewCollectionController(s.db)
+	postController := controllers.NewPostController(s.db, s.media)
+	twoFactorController := controllers.NewTwoFactorController(s.db, s.emails)
+	passkeyController := controllers.NewPasskeyController(s.db, s.emails)
+	oidcController := controllers.NewOIDCController(s.db, s.emails)
+	adminController := controllers.NewAdminController(s.db)
+	storyController := controllers.NewStoryController(s.db, s.media)
+	mediaJobController := controllers.NewMediaJobController(s.db)
+	uploadController := controllers.NewUploadController(s.db, s.media, s.spool)
+	digestController := controllers.NewDigestController(s.db)
 
 	// Public routes
-	auth := s.App.Group("/api/v1/auth")
-	auth.Post("/register", authController.Register)
-	auth.Post("/login", authController.Login)
-	auth.Post("/forgot-password", authController.ForgotPassword)
+	auth := s.App.Group("/api/v1/auth", middleware.RateLimit(authLimit))
+	auth.Post("/register", middleware.RateLimit(registerLimit), authController.Register)
+	auth.Post("/login", middleware.RateLimit(loginLimit), authController.Login)
+	auth.Post("/forgot-password", middleware.RateLimit(passwordLimit), authController.ForgotPassword)
 	auth.Get("/verify/:token", authController.VerifyEmail)
-	auth.Get("/reset-password/:Token", authController.RestPassword)
+	auth.Post("/reset-password", middleware.RateLimit(passwordLimit), authController.ResetPassword)
+	auth.Post("/refresh", sessionController.Refresh)
+	auth.Post("/2fa/verify", middleware.RateLimit(loginLimit), twoFactorController.Verify)
+	auth.Post("/passkey/begin", passkeyController.BeginLogin)
+	auth.Post("/passkey/finish", middleware.RateLimit(loginLimit), passkeyController.FinishLogin)
+	auth.Get("/oidc/:provider", oidcController.Start)
+	auth.Get("/oidc/:provider/callback", oidcController.Callback)
+
+	// One-click unsubscribe from the weekly digest, signed instead of logged in. Only the POST
+	// unsubscribes, the GET behind the link in the email asks to confirm
+	digest := s.App.Group("/api/v1/digest", middleware.RateLimit(authLimit))
+	digest.Get("/unsubscribe", digestController.ConfirmUnsubscribe)
+	digest.Post("/unsubscribe", digestController.Unsubscribe)
 
 	// Protected routes
-	protected := s.App.Group("/api/v1", middleware.AuthRequired())
+	protected := s.App.Group("/api/v1", middleware.AuthRequired(s.db), middleware.RateLimit(apiLimit))
+	verified := middleware.RequireVerifiedEmail() // Write actions need a verified email
+	protected.Post("/auth/verify/resend", authController.ResendVerification)
+	protected.Post("/auth/phone/send-code", authController.SendPhoneCode)
+	protected.Post("/auth/phone/verify", authController.VerifyPhone)
 	protected.Delete("/user/:ID", authController.DeleteUser)
 	protected.Put("/user/:ID", authController.EditUser)
+	protected.Post("/auth/logout", sessionController.Logout)
+	protected.Post("/auth/logout-all", sessionController.LogoutAll)
+	protected.Get("/sessions", sessionController.ListSessions)
+	protected.Delete("/sessions/:ID", sessionController.RevokeSession)
+
+	// Two-factor authentication
+	protected.Get("/2fa", twoFactorController.Status)
+	protected.Post("/2fa/enroll", twoFactorController.Enroll)
+	protected.Post("/2fa/enroll/confirm", twoFactorController.Confirm)
+	protected.Post("/2fa/disable", twoFactorController.Disable)
+	protected.Post("/2fa/recovery-codes", twoFactorController.RegenerateRecoveryCodes)
+
+	// Passkeys
+	protected.Get("/passkeys", passkeyController.ListPasskeys)
+	protected.Post("/passkeys/register/begin", passkeyController.BeginRegistration)
+	protected.Post("/passkeys/register/finish", passkeyController.FinishRegistration)
+	protected.Put("/passkeys/:ID", passkeyController.RenamePasskey)
+	protected.Delete("/passkeys/:ID", passkeyController.DeletePasskey)
+
+	// Posts: create, archive, pin and recently deleted
+	protected.Post("/posts", verified, middleware.RateLimit(postLimit), postController.CreatePost)
+	protected.Get("/posts/trash", postController.ListTrashedPosts)
+	protected.Delete("/posts/:ID", postController.DeletePost)
+	protected.Post("/posts/:ID/restore", verified, postController.RestorePost)
+	protected.Put("/posts/:ID/archive", verified, postController.ArchivePost)
+	protected.Delete("/posts/:ID/archive", postController.UnarchivePost)
+	protected.Put("/posts/:ID/pin", verified, postController.PinPost)
+	protected.Delete("/posts/:ID/pin", postController.UnpinPost)
+
+	// Stories, and the status of videos processing in the background
+	protected.Post("/stories", verified, middleware.RateLimit(storyLimit), storyController.CreateStory)
+	protected.Get("/media-jobs/:ID", mediaJobController.GetMediaJob)
+
+	// Resumable (tus) uploads for large photos and videos, used with upload_id
+	protected.Options("/uploads", uploadController.Options)
+	protected.Post("/uploads", verified, middleware.RateLimit(uploadLimit), uploadController.CreateUpload)
+	protected.Head("/uploads/:uploadID", uploadController.UploadStatus)
+	protected.Patch("/uploads/:uploadID", verified, uploadController.AppendChunk)
+	protected.Delete("/uploads/:uploadID", uploadController.CancelUpload)
+	// Signed uploads straight to S3 or Cloudinary, finalized before use
+	protected.Post("/uploads/direct", verified, middleware.RateLimit(uploadLimit), uploadController.CreateDirectUpload)
+	protected.Post("/uploads/:uploadID/finalize", verified, uploadController.FinalizeUpload)
+
+	// Saved posts & collections
+	protected.Post("/posts/:ID/save", verified, middleware.RateLimit(saveLimit), collectionController.SavePost)
+	protected.Delete("/posts/:ID/save", collectionController.UnsavePost)
+	protected.Get("/collections", collectionController.ListCollections)
+	protected.Post("/collections", verified, middleware.RateLimit(collectionLimit), collectionController.CreateCollection)
+	protected.Get("/collections/:ID/posts", collectionController.ListCollectionPosts)
+	protected.Put("/collections/:ID/posts", verified, collectionController.MoveSavedPosts)
+	protected.Put("/collections/:ID", verified, collectionController.RenameCollection)
+	protected.Delete("/collections/:ID", collectionController.DeleteCollection)
+	protected.Get("/insights", collectionController.Insights)
+
+	// Admin: moderators handle accounts and the image blocklist, admins also verify, change roles,
+	// read the audit log, see what the media garbage collector would delete and retry failed emails
+	admin := protected.Group("/admin", middleware.RequireRole(models.RoleModerator, models.RoleAdmin))
+	adminOnly := middleware.RequireRole(models.RoleAdmin)
+	admin.Get("/users", adminController.SearchUser)
+	admin.Get("/users/:ID", adminController.GetUser)
+	admin.Post("/users/:ID/ban", adminController.BanUser)
+	admin.Delete("/users/:ID/ban", adminController.UnbanUser)
+	admin.Post("/users/:ID/logout", adminController.ForceLogout)
+	admin.Put("/users/:ID/verified", adminOnly, adminController.SetVerified)
+	admin.Put("/users/:ID/role", adminOnly, adminController.SetRole)
+	admin.Get("/audit-log", adminOnly, adminController.ListAuditLogs)
+	admin.Get("/media/orphans", adminOnly, adminController.ListOrphanedMedia)
+	admin.Get("/media/blocklist", adminController.ListBlockedImages)
+	admin.Post("/media/blocklist", adminController.BlockImage)
+	admin.Delete("/media/blocklist/:ID", adminController.UnblockImage)
+	admin.Get("/media/review", adminController.ListMediaForReview)
+	admin.Delete("/media/review/:ID", adminController.ResolveMediaReview)
+	admin.Get("/outbox", adminOnly, adminController.ListOutbox)
+	admin.Post("/outbox/:ID/retry", adminOnly, adminController.RetryOutboxMessage)
+
+	// Uploads kept on disk are served by the API itself
+	if local, ok := s.media.(*media.LocalStore); ok {
+		s.App.Static(local.MountPath(), local.Root)
+	}
+
+	// Public keys for services verifying our JWTs
+	s.App.Get("/.well-known/jwks.json", s.jwksHandler)
 
 	// Health check
 	s.App.Get("/api/health", s.healthHandler)
@@ -71,3 +209,8 @@ func (s *FiberServer) HelloWorldHandler(c *fiber.Ctx) error {
 func (s *FiberServer) healthHandler(c *fiber.Ctx) error {
 	return c.JSON(s.db.Health())
 }
+
+func (s *FiberServer) jwksHandler(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(utils.JWKS())
+}
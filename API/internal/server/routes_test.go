@@ -1,9 +1,13 @@
 package server
 
 import (
+	models "API/internal/Models"
+	"API/internal/middleware"
+	"bytes"
 	"github.com/gofiber/fiber/v2"
 	"io"
 	"net/http"
+	"strconv"
 	"testing"
 )
 
@@ -37,3 +41,129 @@ func TestHandler(t *testing.T) {
 		t.Errorf("expected response body to be %v; got %v", expected, string(body))
 	}
 }
+
+func TestBodyLimit(t *testing.T) {
+	app := newApp(ProxyConfig{})
+	app.Use(middleware.BodyLimit(fiber.DefaultBodyLimit, bodyLimits...))
+	echoLength := func(c *fiber.Ctx) error {
+		return c.SendString(strconv.Itoa(len(c.Body())))
+	}
+	app.Post("/api/v1/auth/login", echoLength)
+	app.Post("/api/v1/posts", echoLength)
+	app.Patch("/api/v1/uploads/:uploadID", echoLength)
+
+	large := bytes.Repeat([]byte("a"), fiber.DefaultBodyLimit+1)
+	for _, tc := range []struct {
+		method, path string
+		chunked      bool
+		status       int
+	}{
+		{http.MethodPost, "/api/v1/auth/login", false, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/api/v1/auth/login", true, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/api/v1/posts", false, http.StatusOK},
+		{http.MethodPatch, "/api/v1/uploads/abc", true, http.StatusOK},
+		{http.MethodPatch, "/api/v1/uploads/abc", false, http.StatusOK},
+	} {
+		req, err := http.NewRequest(tc.method, tc.path, bytes.NewReader(large))
+		if err != nil {
+			t.Fatalf("error creating request. Err: %v", err)
+		}
+		if tc.chunked {
+			req.ContentLength = -1
+			req.TransferEncoding = []string{"chunked"}
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s %s (chunked %v): expected %d, got %d %s", tc.method, tc.path, tc.chunked, tc.status, resp.StatusCode, body)
+		}
+		if tc.status == http.StatusOK && string(body) != strconv.Itoa(len(large)) {
+			t.Errorf("%s %s: the handler saw %s bytes", tc.method, tc.path, body)
+		}
+	}
+
+	// A tus chunk is limited to MaxUploadChunkSize, however the upload is sent
+	chunk := bytes.Repeat([]byte("a"), models.MaxUploadChunkSize+1)
+	for _, chunked := range []bool{false, true} {
+		req, err := http.NewRequest(http.MethodPatch, "/api/v1/uploads/abc", bytes.NewReader(chunk))
+		if err != nil {
+			t.Fatalf("error creating request. Err: %v", err)
+		}
+		if chunked {
+			req.ContentLength = -1
+			req.TransferEncoding = []string{"chunked"}
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("PATCH chunk over the limit (chunked %v): expected 413, got %d", chunked, resp.StatusCode)
+		}
+	}
+}
+
+func TestClientIPBehindProxy(t *testing.T) {
+	// app.Test connects from 0.0.0.0
+	for _, tc := range []struct {
+		name  string
+		proxy ProxyConfig
+		want  string
+	}{
+		{"no proxy", ProxyConfig{}, "ip:0.0.0.0"},
+		{"trusted proxy", ProxyConfig{Header: "X-Real-IP", TrustedProxies: []string{"0.0.0.0"}}, "ip:203.0.113.7"},
+		{"untrusted proxy", ProxyConfig{Header: "X-Real-IP", TrustedProxies: []string{"10.0.0.0/8"}}, "ip:0.0.0.0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			app := newApp(tc.proxy)
+			app.Get("/", func(c *fiber.Ctx) error {
+				return c.SendString(middleware.ByIP(c))
+			})
+
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatalf("error creating request. Err: %v", err)
+			}
+			req.Header.Set("X-Real-IP", "203.0.113.7")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("error making request to server. Err: %v", err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("error reading response body. Err: %v", err)
+			}
+			if string(body) != tc.want {
+				t.Errorf("expected the key %q, got %q", tc.want, body)
+			}
+		})
+	}
+}
+
+func TestProxyConfigFromEnv(t *testing.T) {
+	t.Setenv("PROXY_HEADER", "X-Real-IP")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.1")
+	cfg, err := ProxyConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ProxyConfigFromEnv: %v", err)
+	}
+	if len(cfg.TrustedProxies) != 2 || cfg.TrustedProxies[1] != "192.168.1.1" {
+		t.Errorf("unexpected trusted proxies %v", cfg.TrustedProxies)
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "not-an-ip")
+	if _, err := ProxyConfigFromEnv(); err == nil {
+		t.Errorf("expected an invalid entry to fail")
+	}
+
+	// Without trusted proxies every client could pick its own IP
+	t.Setenv("TRUSTED_PROXIES", "")
+	if _, err := ProxyConfigFromEnv(); err == nil {
+		t.Errorf("expected a header without trusted proxies to fail")
+	}
+}
@@ -1,26 +1,85 @@
 package server
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
 
 	"API/internal/database"
+	"API/internal/mail"
+	"API/internal/media"
 )
 
 type FiberServer struct {
 	*fiber.App
 
-	db database.Service
+	db     database.Service
+	media  media.MediaStore
+	spool  *media.Spool
+	emails *mail.Emails
 }
 
-func New() *FiberServer {
+func New(store media.MediaStore, spool *media.Spool, emails *mail.Emails, proxy ProxyConfig) *FiberServer {
 	server := &FiberServer{
-		App: fiber.New(fiber.Config{
-			ServerHeader: "API",
-			AppName:      "API",
-		}),
+		App: newApp(proxy),
 
-		db: database.New(),
+		db:     database.New(),
+		media:  store,
+		spool:  spool,
+		emails: emails,
 	}
 
 	return server
 }
+
+// ProxyConfig describes the load balancer in front of the API. Rate limits
+// and login lockouts count per client IP, without it every client would
+// share the IP of the proxy.
+type ProxyConfig struct {
+	Header         string   // Where the proxy puts the client IP, empty without a proxy
+	TrustedProxies []string // IPs and CIDR ranges the header is believed from
+}
+
+// ProxyConfigFromEnv reads PROXY_HEADER and TRUSTED_PROXIES, a comma
+// separated list of IPs and CIDR ranges. The header must be one the proxy
+// overwrites, such as X-Real-IP: of a list Fiber takes the first address,
+// which the client sent itself when the proxy only appends to it.
+func ProxyConfigFromEnv() (ProxyConfig, error) {
+	cfg := ProxyConfig{Header: strings.TrimSpace(os.Getenv("PROXY_HEADER"))}
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return ProxyConfig{}, fmt.Errorf("invalid TRUSTED_PROXIES entry %q, expected an IP or CIDR range", entry)
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, entry)
+	}
+
+	if cfg.Header != "" && len(cfg.TrustedProxies) == 0 {
+		return ProxyConfig{}, errors.New("PROXY_HEADER needs TRUSTED_PROXIES, otherwise any client can choose its IP")
+	}
+	return cfg, nil
+}
+
+func newApp(proxy ProxyConfig) *fiber.App {
+	return fiber.New(fiber.Config{
+		ServerHeader: "API",
+		AppName:      "API",
+		// Bodies past BodyLimit are streamed, middleware.BodyLimit caps them
+		// per route
+		BodyLimit:                    fiber.DefaultBodyLimit,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+		// c.IP() comes from the header only on requests from a trusted proxy
+		ProxyHeader:             proxy.Header,
+		EnableTrustedProxyCheck: proxy.Header != "",
+		TrustedProxies:          proxy.TrustedProxies,
+		EnableIPValidation:      true,
+	})
+}
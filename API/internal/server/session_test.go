@@ -0,0 +1,261 @@
+package server
+
+import (
+	models "API/internal/Models"
+	"API/internal/database"
+	"API/internal/utils"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// sessionTestDB keeps the refresh tokens of one user in memory, with the
+// rotation rules of the real RotateRefreshToken.
+type sessionTestDB struct {
+	database.Service
+	mu     sync.Mutex
+	user   models.User
+	tokens []*models.RefreshToken // ID is the index + 1
+}
+
+func (db *sessionTestDB) FindUserById(id uint) (*models.User, error) {
+	if id != db.user.ID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	user := db.user
+	return &user, nil
+}
+
+func (db *sessionTestDB) FindRefreshTokenByHash(hash string) (*models.RefreshToken, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, token := range db.tokens {
+		if token.TokenHash == hash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (db *sessionTestDB) addToken(token models.RefreshToken) *models.RefreshToken {
+	token.ID = uint(len(db.tokens) + 1)
+	db.tokens = append(db.tokens, &token)
+	return &token
+}
+
+func (db *sessionTestDB) RotateRefreshToken(oldID uint, next models.RefreshToken) (*models.RefreshToken, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	old := db.tokens[oldID-1]
+	if old.UsedAt != nil || old.RevokedAt != nil {
+		return nil, database.ErrRefreshTokenReused
+	}
+	now := time.Now()
+	old.UsedAt = &now
+	return db.addToken(next), nil
+}
+
+func (db *sessionTestDB) RevokeRefreshTokenFamily(familyID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range db.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (db *sessionTestDB) TouchSession(familyID, ip string) error {
+	return nil
+}
+
+func (db *sessionTestDB) FindActiveSessions(userID uint, since time.Time) ([]models.Session, error) {
+	return nil, nil
+}
+
+const testFamilyID = "family-1"
+
+// newSessionTestServer logs the user in: one refresh token in testFamilyID,
+// returned raw along with an access token of the session.
+func newSessionTestServer(t *testing.T) (*FiberServer, *sessionTestDB, string, string) {
+	t.Helper()
+
+	db := &sessionTestDB{user: models.User{ID: testUserID, Username: "user", Role: models.RoleUser, EmailVerified: true}}
+	s := newTestServer(t, db)
+
+	db.addToken(models.RefreshToken{
+		UserID:    testUserID,
+		FamilyID:  testFamilyID,
+		TokenHash: utils.HashToken("refresh-0"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	accessToken, err := utils.GenerateToken(&db.user, testFamilyID)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	return s, db, "refresh-0", accessToken
+}
+
+type refreshResponse struct {
+	JWT          string `json:"JWT"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func refresh(t *testing.T, s *FiberServer, refreshToken string) (int, refreshResponse) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, "/api/v1/auth/refresh", strings.NewReader(`{"refresh_token":"`+refreshToken+`"}`))
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.App.Test(req, -1)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body refreshResponse
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decoding refresh response: %v", err)
+		}
+	}
+	return resp.StatusCode, body
+}
+
+// listSessions calls a protected route with the access token.
+func listSessions(t *testing.T, s *FiberServer, accessToken string) int {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := s.App.Test(req, -1)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	s, db, refreshToken, _ := newSessionTestServer(t)
+
+	status, first := refresh(t, s, refreshToken)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	if first.RefreshToken == "" || first.RefreshToken == refreshToken {
+		t.Fatalf("expected a new refresh token, got %q", first.RefreshToken)
+	}
+	if status := listSessions(t, s, first.JWT); status != http.StatusOK {
+		t.Errorf("expected the new access token to work, got %d", status)
+	}
+
+	status, second := refresh(t, s, first.RefreshToken)
+	if status != http.StatusOK {
+		t.Fatalf("expected the successor to refresh, got %d", status)
+	}
+	if len(db.tokens) != 3 || db.tokens[0].UsedAt == nil || db.tokens[1].UsedAt == nil || db.tokens[2].UsedAt != nil {
+		t.Errorf("expected a chain of two used tokens and a fresh one")
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Errorf("the successor was handed out twice")
+	}
+
+	if status, _ := refresh(t, s, "unknown"); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown token, got %d", status)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	s, db, refreshToken, accessToken := newSessionTestServer(t)
+
+	status, rotated := refresh(t, s, refreshToken)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+
+	// Whoever presents the old token again stole it, or was stolen from
+	if status, _ := refresh(t, s, refreshToken); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 on reuse, got %d", status)
+	}
+	for _, token := range db.tokens {
+		if token.RevokedAt == nil {
+			t.Errorf("token %d of the family was not revoked", token.ID)
+		}
+	}
+	if status, _ := refresh(t, s, rotated.RefreshToken); status != http.StatusUnauthorized {
+		t.Errorf("expected the successor to stop working, got %d", status)
+	}
+
+	// Access tokens of the family are on the deny-list until they expire
+	for _, token := range []string{accessToken, rotated.JWT} {
+		if status := listSessions(t, s, token); status != http.StatusUnauthorized {
+			t.Errorf("expected 401 with an access token of the revoked family, got %d", status)
+		}
+	}
+}
+
+func TestRefreshConcurrentReuse(t *testing.T) {
+	s, db, refreshToken, _ := newSessionTestServer(t)
+
+	const attempts = 5
+	statuses := make([]int, attempts)
+	var wg sync.WaitGroup
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i], _ = refresh(t, s, refreshToken)
+		}()
+	}
+	wg.Wait()
+
+	refreshed := 0
+	for _, status := range statuses {
+		if status == http.StatusOK {
+			refreshed++
+		}
+	}
+	if refreshed != 1 {
+		t.Errorf("expected exactly one refresh to succeed, got %d: %v", refreshed, statuses)
+	}
+
+	// The losers presented a used token, so the winner's successor dies too
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, token := range db.tokens {
+		if token.RevokedAt == nil {
+			t.Errorf("token %d of the family was not revoked", token.ID)
+		}
+	}
+}
+
+func TestRefreshExpiredToken(t *testing.T) {
+	s, db, refreshToken, _ := newSessionTestServer(t)
+	db.tokens[0].ExpiresAt = time.Now().Add(-time.Minute)
+
+	if status, _ := refresh(t, s, refreshToken); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an expired token, got %d", status)
+	}
+	if db.tokens[0].UsedAt != nil {
+		t.Errorf("an expired token was rotated")
+	}
+}
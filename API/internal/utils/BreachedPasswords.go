@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachedPasswordsDir holds a local copy of the Pwned Passwords range files:
+// one <PREFIX>.txt per 5-hex-digit SHA-1 prefix with "SUFFIX:COUNT" lines,
+// as written by the HIBP downloader. Only the prefix file of the password
+// being checked is read, so the full hash never leaves this function.
+// Leave BREACHED_PASSWORDS_DIR unset to turn the check off.
+var BreachedPasswordsDir string
+
+func InitBreachedPasswords() error {
+	BreachedPasswordsDir = os.Getenv("BREACHED_PASSWORDS_DIR")
+	if BreachedPasswordsDir == "" {
+		return nil
+	}
+
+	info, err := os.Stat(BreachedPasswordsDir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("BREACHED_PASSWORDS_DIR is not a directory")
+	}
+	return nil
+}
+
+// IsBreachedPassword reports whether the password appears in the local
+// breached password list. It is always false when the check is off.
+func IsBreachedPassword(password string) (bool, error) {
+	if BreachedPasswordsDir == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(BreachedPasswordsDir, prefix+".txt"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// notBreached backs the notbreached validator tag. A broken list should not
+// lock people out of signing up, so lookup errors let the password through.
+func notBreached(password string) bool {
+	breached, err := IsBreachedPassword(password)
+	if err != nil {
+		log.Printf("breached password lookup failed: %v", err)
+		return true
+	}
+	return !breached
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBreachedPasswords(t *testing.T) {
+	// SHA-1("password") = 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	// SHA-1("password1") = E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D
+	dir := t.TempDir()
+	files := map[string]string{
+		"5BAA6.txt": "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n",
+		"E38AD.txt": "214943DAAD1D64C102FAEC29DE4AFE9DA3D:2413945\r\n",
+	}
+	for name, lines := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(lines), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	BreachedPasswordsDir = dir
+	defer func() { BreachedPasswordsDir = "" }()
+
+	if breached, err := IsBreachedPassword("password"); err != nil || !breached {
+		t.Fatalf("expected password to be breached, got %v, %v", breached, err)
+	}
+	if breached, err := IsBreachedPassword("not in any list 42"); err != nil || breached {
+		t.Fatalf("expected unlisted password to pass, got %v, %v", breached, err)
+	}
+
+	type request struct {
+		Password string `validate:"required,password,notbreached"`
+	}
+	if err := NewValidator().Struct(request{Password: "password2"}); err != nil {
+		t.Fatalf("password2 is not in the list: %v", err)
+	}
+	if err := NewValidator().Struct(request{Password: "password1"}); err == nil {
+		t.Fatal("expected breached password to be rejected")
+	}
+}
@@ -1,9 +1,9 @@
 package utils
 
 import (
-	models "API/internal/Models"
-	"API/internal/config"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"mime/multipart"
@@ -30,6 +30,22 @@ func SendErrorResponse(c *fiber.Ctx, status int, message string, details interfa
 	return c.Status(status).JSON(response)
 }
 
+// ParsePagination reads ?limit= and ?offset= from the query string, keeping
+// the page size between 1 and 50.
+func ParsePagination(c *fiber.Ctx) (int, int) {
+	limit := c.QueryInt("limit", 20)
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+
+	return limit, offset
+}
+
 func GenerateUniqueFilename(original string) string {
 	extension := filepath.Ext(original)
 	name := strings.TrimSuffix(original, extension)
@@ -45,6 +61,22 @@ func GenerateVerificationToken() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
+// GenerateSecureToken returns a URL-safe random token built from n random bytes.
+func GenerateSecureToken(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// HashToken returns the hex SHA-256 of a token, which is what gets stored in
+// the database instead of the token itself.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func FormatValidationErrors(err error) map[string]string {
 	errors := make(map[string]string)
 
@@ -75,29 +107,37 @@ func formatErrorMessage(field, tag string) string {
 		return field + " is too long"
 	case "e164":
 		return "Invalid phone number format"
+	case "password":
+		return field + " must be 8 to 72 characters with at least one letter and one digit"
+	case "notbreached":
+		return field + " has appeared in a data breach, please choose another one"
 	default:
 		return "Invalid " + field
 	}
 }
 
+// List of allowed image extensions
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+}
+
+// IsImageFilename tells photos apart from other files by their extension.
+func IsImageFilename(filename string) bool {
+	return imageExtensions[strings.ToLower(filepath.Ext(filename))]
+}
+
 func ValidateImageFile(file *multipart.FileHeader) error {
 
 	if file == nil {
 		return nil // Allow nil files
 	}
-	// Get file extension
-	ext := strings.ToLower(filepath.Ext(file.Filename))
 
-	// List of allowed image extensions
-	allowedTypes := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
-		".gif":  true,
-	}
-
-	if !allowedTypes[ext] {
-		return fmt.Errorf("invalid file type. Only JPG, JPEG, PNG and GIF are allowed")
+	if !IsImageFilename(file.Filename) {
+		return fmt.Errorf("invalid file type. Only JPG, JPEG, PNG, GIF and WEBP are allowed")
 	}
 
 	// Open the file for MIME type checking
@@ -123,22 +163,25 @@ func ValidateImageFile(file *multipart.FileHeader) error {
 	return nil
 }
 
-func ValidateVideoFile(file *multipart.FileHeader) error {
-	// Get file extension
-	ext := strings.ToLower(filepath.Ext(file.Filename))
+// List of allowed video extensions
+var videoExtensions = map[string]bool{
+	".mp4":  true,
+	".mov":  true,
+	".avi":  true,
+	".wmv":  true,
+	".flv":  true,
+	".webm": true,
+	".mkv":  true,
+}
 
-	// List of allowed video extensions
-	allowedTypes := map[string]bool{
-		".mp4":  true,
-		".mov":  true,
-		".avi":  true,
-		".wmv":  true,
-		".flv":  true,
-		".webm": true,
-		".mkv":  true,
-	}
+// IsVideoFilename tells videos apart from photos by their extension, the
+// upload still has to pass ValidateVideoFile.
+func IsVideoFilename(filename string) bool {
+	return videoExtensions[strings.ToLower(filepath.Ext(filename))]
+}
 
-	if !allowedTypes[ext] {
+func ValidateVideoFile(file *multipart.FileHeader) error {
+	if !IsVideoFilename(file.Filename) {
 		return fmt.Errorf("invalid file type. Only MP4, MOV, AVI, WMV, FLV, WEBM, and MKV are allowed")
 	}
 
@@ -194,26 +237,3 @@ func ProcessHashtags(tags []string) []string {
 	}
 	return processedTags
 }
-
-func CleanupUserAssets(user *models.User) error {
-	// Initialize Cloudinary client
-	cld, err := config.InitCloudinary()
-	if err != nil {
-		return fmt.Errorf("failed to initialize cloudinary: %v", err)
-	}
-
-	// Delete user avatar
-	if user.Avatar != "" {
-		publicID, err := ExtractPublicID(user.Avatar)
-		if err == nil {
-			DeleteImageFromCloudinary(cld, publicID)
-		}
-	}
-
-	// Delete user posts and their images
-	// This would need to be implemented based on your post storage structure
-
-	// Delete any other user-related files or resources
-
-	return nil
-}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var geoIPClient = &http.Client{Timeout: 2 * time.Second}
+
+// LocateIP returns an approximate "City, Country" for an IP address, or an
+// empty string when it cannot be found. Lookups go to the service in GEOIP_URL
+// (an ip-api.com style JSON endpoint where %s is replaced by the IP) and are
+// cached in Redis for a day. Without GEOIP_URL nothing leaves the server.
+func LocateIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if parsed.IsLoopback() || parsed.IsPrivate() || parsed.IsLinkLocalUnicast() {
+		return "Local network"
+	}
+
+	endpoint := os.Getenv("GEOIP_URL")
+	if endpoint == "" {
+		return ""
+	}
+
+	ctx := context.Background()
+	cacheKey := "geoip:" + ip
+	if RedisClient != nil {
+		if cached, err := RedisClient.Get(ctx, cacheKey).Result(); err == nil {
+			return cached
+		}
+	}
+
+	resp, err := geoIPClient.Get(fmt.Sprintf(endpoint, ip))
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	var body struct {
+		City        string `json:"city"`
+		Country     string `json:"country"`
+		CountryName string `json:"country_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return ""
+	}
+
+	country := body.Country
+	if body.CountryName != "" {
+		country = body.CountryName
+	}
+
+	parts := make([]string, 0, 2)
+	for _, part := range []string{body.City, country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	location := strings.Join(parts, ", ")
+
+	if RedisClient != nil && location != "" {
+		RedisClient.Set(ctx, cacheKey, location, 24*time.Hour)
+	}
+	return location
+}
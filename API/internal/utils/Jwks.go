@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"API/internal/config"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// JWK is the public half of a signing key in RFC 7517 form.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`   // RSA modulus
+	E         string `json:"e,omitempty"`   // RSA exponent
+	Curve     string `json:"crv,omitempty"` // OKP curve
+	X         string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKS returns the public keys other services can use to verify our tokens.
+// HS256 keys are shared secrets and are never published.
+func JWKS() fiber.Map {
+	keys := make([]JWK, 0)
+	if jwtKeys == nil {
+		return fiber.Map{"keys": keys}
+	}
+
+	for _, key := range jwtKeys.Keys {
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Algorithm: config.AlgRS256,
+				Use:       "sig",
+				N:         base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Algorithm: config.AlgEdDSA,
+				Use:       "sig",
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	// Stable output so caches and diffs behave
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KeyID < keys[j].KeyID })
+
+	return fiber.Map{"keys": keys}
+}
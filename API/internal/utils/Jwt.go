@@ -1,66 +1,109 @@
 package utils
 
 import (
+	models "API/internal/Models"
+	"API/internal/config"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-var secretKey = []byte("your-secret-key-here") // In production, use environment variable
+// jwtKeys holds the signing and verification keys, set by InitJWT
+var jwtKeys *config.JWTKeys
 
+// InitJWT loads the signing keys from config. It needs to be called when the app starts.
+func InitJWT() error {
+	keys, err := config.LoadJWTKeys()
+	if err != nil {
+		return err
+	}
+	SetJWTKeys(keys)
+	return nil
+}
+
+// SetJWTKeys replaces the key set, mostly useful in tests.
+func SetJWTKeys(keys *config.JWTKeys) {
+	jwtKeys = keys
+}
+
+const (
+	// AccessTokenTTL is kept short because access tokens are only revoked through the Redis deny-list
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long a refresh token can sit unused before the session ends
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// Claims only identifies who the token is for. Everything else about the
+// user is loaded by AuthRequired, so profile changes never wait for a token
+// to expire and nothing personal ends up in the token.
 type Claims struct {
-	UserID         uint   `json:"user_ID"`
-	Email          string `json:"email"`
-	Name           string `json:"name"`
-	Avatar         string `json:"avatar"`
-	JWTToken       string `json:"token"`
-	Bio            string `json:"bio"`
-	IsVerified     bool   `json:"is_verified"`
-	FollowerCount  int    `json:"follower_count"`
-	FollowingCount int    `json:"following_count"`
-	Username       string `json:"username"`
-	Phone          string `json:"phone"`
-	Website        string `json:"website"`
-	Privacy        bool   `json:"privacy"`
-	EmailVerified  bool   `json:"email_verified"`
-	Language       string `json:"language"`
+	SessionID string   `json:"sid"`   // Refresh token family the access token was issued for
+	Roles     []string `json:"roles"` // Roles at the time the token was issued
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID uint, email, name, username, avatar, token, bio, website, phone, language string, is_verified, privacy, email_verified bool, following_count, follower_count int) (string, error) {
+// UserID returns the user the token was issued for, taken from the subject.
+func (c *Claims) UserID() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid token subject: %v", err)
+	}
+	return uint(id), nil
+}
+
+// GenerateToken issues a short-lived access token for the user. sessionID is
+// the refresh token family, so a whole session can be revoked at once.
+func GenerateToken(user *models.User, sessionID string) (string, error) {
+	now := time.Now()
 	claims := Claims{
-		UserID:         userID,
-		Email:          email,
-		Name:           name,
-		Username:       username,
-		Avatar:         avatar,
-		JWTToken:       token,
-		Bio:            bio,
-		Website:        website,
-		Phone:          phone,
-		FollowerCount:  follower_count,
-		FollowingCount: following_count,
-		IsVerified:     is_verified,
-		Privacy:        privacy,
-		EmailVerified:  email_verified,
-		Language:       language,
+		SessionID: sessionID,
+		Roles:     []string{user.Role},
 
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return jwtToken.SignedString(secretKey)
+	if jwtKeys == nil || jwtKeys.Active == nil {
+		return "", errors.New("JWT signing keys are not initialized")
+	}
+	active := jwtKeys.Active
+
+	jwtToken := jwt.NewWithClaims(jwt.GetSigningMethod(active.Algorithm), claims)
+	jwtToken.Header["kid"] = active.ID
+	return jwtToken.SignedString(active.Private)
 }
+
+// ValidateToken verifies a token against the key named in its kid header. The
+// algorithm is pinned to the one configured for that key, so a token cannot
+// pick its own (e.g. HS256 signed with an RSA public key, or "none").
 func ValidateToken(tokenString string) (*Claims, error) {
+	if jwtKeys == nil {
+		return nil, errors.New("JWT signing keys are not initialized")
+	}
+
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		key, ok := jwtKeys.Keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+		}
+
+		return key.Public, nil
+	}, jwt.WithValidMethods([]string{config.AlgHS256, config.AlgRS256, config.AlgEdDSA}))
 
 	if err != nil {
 		return nil, err
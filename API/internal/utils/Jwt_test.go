@@ -0,0 +1,190 @@
+package utils
+
+import (
+	models "API/internal/Models"
+	"API/internal/config"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testKeys(t *testing.T) (hs, rs, ed *config.SigningKey) {
+	t.Helper()
+
+	hs, err := config.ParseSigningKey("hs", config.AlgHS256, []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("HS256 key: %v", err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	rs = &config.SigningKey{ID: "rs", Algorithm: config.AlgRS256, Private: rsaKey, Public: &rsaKey.PublicKey}
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating Ed25519 key: %v", err)
+	}
+	ed = &config.SigningKey{ID: "ed", Algorithm: config.AlgEdDSA, Private: edPrivate, Public: edPublic}
+
+	return hs, rs, ed
+}
+
+func useKeys(active *config.SigningKey, keys ...*config.SigningKey) {
+	set := &config.JWTKeys{Active: active, Keys: map[string]*config.SigningKey{}}
+	for _, key := range keys {
+		set.Keys[key.ID] = key
+	}
+	SetJWTKeys(set)
+}
+
+func TestGenerateAndValidateToken(t *testing.T) {
+	hs, rs, ed := testKeys(t)
+	user := &models.User{ID: 42, Email: "jane@example.com"}
+
+	for _, key := range []*config.SigningKey{hs, rs, ed} {
+		useKeys(key, hs, rs, ed)
+
+		token, err := GenerateToken(user, "session-1")
+		if err != nil {
+			t.Fatalf("%s: GenerateToken: %v", key.Algorithm, err)
+		}
+
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+		if err != nil {
+			t.Fatalf("%s: parsing header: %v", key.Algorithm, err)
+		}
+		if parsed.Header["kid"] != key.ID || parsed.Header["alg"] != key.Algorithm {
+			t.Errorf("%s: expected kid %s, got header %v", key.Algorithm, key.ID, parsed.Header)
+		}
+
+		claims, err := ValidateToken(token)
+		if err != nil {
+			t.Fatalf("%s: ValidateToken: %v", key.Algorithm, err)
+		}
+		if userID, _ := claims.UserID(); userID != 42 || claims.SessionID != "session-1" {
+			t.Errorf("%s: unexpected claims %+v", key.Algorithm, claims)
+		}
+	}
+}
+
+func TestValidateTokenKeyRotation(t *testing.T) {
+	_, rs, ed := testKeys(t)
+	user := &models.User{ID: 7}
+
+	useKeys(rs, rs)
+	oldToken, err := GenerateToken(user, "")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	// Rotated: new tokens use ed, the old key still verifies
+	useKeys(ed, rs, ed)
+	if _, err := ValidateToken(oldToken); err != nil {
+		t.Errorf("token signed before rotation should still be valid: %v", err)
+	}
+
+	// Old key retired
+	useKeys(ed, ed)
+	if _, err := ValidateToken(oldToken); err == nil {
+		t.Error("token signed with a retired key should be rejected")
+	}
+}
+
+func TestValidateTokenPinsAlgorithm(t *testing.T) {
+	_, rs, _ := testKeys(t)
+	useKeys(rs, rs)
+
+	// Classic confusion attack: HS256 keyed with the RSA public key
+	publicDER, err := x509.MarshalPKIXPublicKey(rs.Public)
+	if err != nil {
+		t.Fatalf("marshalling public key: %v", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "1"}})
+	forged.Header["kid"] = rs.ID
+	forgedString, err := forged.SignedString(publicPEM)
+	if err != nil {
+		t.Fatalf("signing forged token: %v", err)
+	}
+	if _, err := ValidateToken(forgedString); err == nil {
+		t.Error("HS256 token for an RS256 key should be rejected")
+	}
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "1"}})
+	unsigned.Header["kid"] = rs.ID
+	unsignedString, err := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("signing unsigned token: %v", err)
+	}
+	if _, err := ValidateToken(unsignedString); err == nil {
+		t.Error("unsigned token should be rejected")
+	}
+}
+
+func TestJWKSOnlyPublishesAsymmetricKeys(t *testing.T) {
+	hs, rs, ed := testKeys(t)
+	useKeys(ed, hs, rs, ed)
+
+	keys := JWKS()["keys"].([]JWK)
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 published keys, got %d", len(keys))
+	}
+	if keys[0].KeyID != "ed" || keys[0].KeyType != "OKP" || keys[0].X == "" {
+		t.Errorf("unexpected Ed25519 JWK %+v", keys[0])
+	}
+	if keys[1].KeyID != "rs" || keys[1].KeyType != "RSA" || keys[1].N == "" || keys[1].E != "AQAB" {
+		t.Errorf("unexpected RSA JWK %+v", keys[1])
+	}
+}
+
+func TestLoadJWTKeysFromConfig(t *testing.T) {
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating Ed25519 key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edPrivate)
+	if err != nil {
+		t.Fatalf("marshalling key: %v", err)
+	}
+
+	dir := t.TempDir()
+	edPath := filepath.Join(dir, "ed.pem")
+	hsPath := filepath.Join(dir, "hs.key")
+	if err := os.WriteFile(edPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hsPath, []byte("0123456789abcdef0123456789abcdef\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("JWT_KEYS", fmt.Sprintf("old:HS256:%s,new:EdDSA:%s", hsPath, edPath))
+	t.Setenv("JWT_ACTIVE_KID", "new")
+
+	keys, err := config.LoadJWTKeys()
+	if err != nil {
+		t.Fatalf("LoadJWTKeys: %v", err)
+	}
+	if keys.Active.ID != "new" || keys.Active.Algorithm != config.AlgEdDSA {
+		t.Errorf("unexpected active key %+v", keys.Active)
+	}
+	if len(keys.Keys) != 2 {
+		t.Errorf("expected 2 keys, got %d", len(keys.Keys))
+	}
+
+	// Declaring a key with the wrong algorithm is a config error
+	t.Setenv("JWT_KEYS", fmt.Sprintf("new:RS256:%s", edPath))
+	if _, err := config.LoadJWTKeys(); err == nil {
+		t.Error("expected an Ed25519 key declared as RS256 to be rejected")
+	}
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Failed logins are counted per account and per IP inside a sliding
+// failureWindow. Each failure after the first few makes the next attempt wait
+// longer, and past the thresholds the account or IP is locked out.
+const (
+	failureWindow          = 15 * time.Minute
+	freeLoginFailures      = 3
+	maxLoginDelay          = 30 * time.Second
+	accountLockoutFailures = 10
+	ipLockoutFailures      = 50
+	// LoginLockoutDuration is how long an account or IP stays locked
+	LoginLockoutDuration = 15 * time.Minute
+)
+
+func loginFailuresKey(scope, id string) string {
+	return "login:failures:" + scope + ":" + id
+}
+
+func loginLockKey(scope, id string) string {
+	return "login:lock:" + scope + ":" + id
+}
+
+// LoginDelay is how long to wait after the given number of consecutive
+// failures: nothing for the first few, then doubling up to maxLoginDelay.
+func LoginDelay(failures int64) time.Duration {
+	if failures < freeLoginFailures {
+		return 0
+	}
+
+	delay := time.Second << (failures - freeLoginFailures)
+	if delay > maxLoginDelay || delay <= 0 {
+		return maxLoginDelay
+	}
+	return delay
+}
+
+// LoginRetryAfter reports how long the account and IP must wait before the
+// next login attempt, 0 if it may go ahead.
+func LoginRetryAfter(ctx context.Context, account, ip string) (time.Duration, error) {
+	if RedisClient == nil {
+		return 0, nil
+	}
+
+	var wait time.Duration
+	for _, scope := range []struct{ name, id string }{{"account", account}, {"ip", ip}} {
+		lock, err := RedisClient.PTTL(ctx, loginLockKey(scope.name, scope.id)).Result()
+		if err != nil {
+			return 0, err
+		}
+		if lock > wait {
+			wait = lock
+		}
+	}
+
+	// Progressive delay, counted from the most recent failure of the account
+	failures, err := RedisClient.ZRangeWithScores(ctx, loginFailuresKey("account", account), -1, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(failures) == 1 {
+		count, err := RedisClient.ZCard(ctx, loginFailuresKey("account", account)).Result()
+		if err != nil {
+			return 0, err
+		}
+		last := time.UnixMilli(int64(failures[0].Score))
+		if remaining := time.Until(last.Add(LoginDelay(count))); remaining > wait {
+			wait = remaining
+		}
+	}
+
+	return wait, nil
+}
+
+// RecordLoginFailure counts a failed attempt. It reports true when this
+// failure locked the account, so the owner can be told exactly once.
+func RecordLoginFailure(ctx context.Context, account, ip string) (bool, error) {
+	if RedisClient == nil {
+		return false, nil
+	}
+
+	now := time.Now()
+	member := strconv.FormatInt(now.UnixNano(), 10)
+	cutoff := strconv.FormatInt(now.Add(-failureWindow).UnixMilli(), 10)
+
+	counts := make(map[string]int64, 2)
+	for _, scope := range []struct{ name, id string }{{"account", account}, {"ip", ip}} {
+		key := loginFailuresKey(scope.name, scope.id)
+		pipe := RedisClient.TxPipeline()
+		pipe.ZRemRangeByScore(ctx, key, "-inf", cutoff)
+		pipe.ZAdd(ctx, key, &redis.Z{Score: float64(now.UnixMilli()), Member: member})
+		count := pipe.ZCard(ctx, key)
+		pipe.Expire(ctx, key, failureWindow)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return false, err
+		}
+		counts[scope.name] = count.Val()
+	}
+
+	if counts["ip"] >= ipLockoutFailures {
+		if err := RedisClient.Set(ctx, loginLockKey("ip", ip), 1, LoginLockoutDuration).Err(); err != nil {
+			return false, err
+		}
+	}
+
+	if counts["account"] >= accountLockoutFailures {
+		return RedisClient.SetNX(ctx, loginLockKey("account", account), 1, LoginLockoutDuration).Result()
+	}
+	return false, nil
+}
+
+// ResetLoginFailures clears the account's failures after a successful login.
+// IP counters are kept, one good password does not vouch for the whole IP.
+func ResetLoginFailures(ctx context.Context, account string) error {
+	if RedisClient == nil {
+		return nil
+	}
+	return RedisClient.Del(ctx, loginFailuresKey("account", account)).Err()
+}
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginDelay(t *testing.T) {
+	cases := map[int64]time.Duration{
+		0:  0,
+		2:  0,
+		3:  time.Second,
+		4:  2 * time.Second,
+		7:  16 * time.Second,
+		8:  maxLoginDelay,
+		70: maxLoginDelay,
+	}
+	for failures, want := range cases {
+		if got := LoginDelay(failures); got != want {
+			t.Errorf("LoginDelay(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/oauth2"
+)
+
+// OAuthStateTTL is how long the user has to finish signing in at the provider
+const OAuthStateTTL = 10 * time.Minute
+
+// OIDCProviderConfig describes one OpenID Connect provider.
+type OIDCProviderConfig struct {
+	Name         string // Used in the route, e.g. "google"
+	Issuer       string // Discovery is done from <Issuer>/.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string // openid is always requested
+}
+
+// OIDCProvider is a discovered provider ready to start and finish logins.
+type OIDCProvider struct {
+	Name     string
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// OIDCIdentity is what we learn about the user from the ID token.
+type OIDCIdentity struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Picture           string `json:"picture"`
+}
+
+// OIDCProviders holds the configured providers by name, set up by InitOIDC.
+var OIDCProviders = map[string]*OIDCProvider{}
+
+// NewOIDCProvider runs discovery against the issuer.
+func NewOIDCProvider(ctx context.Context, cfg OIDCProviderConfig) (*OIDCProvider, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery for %s failed: %v", cfg.Name, err)
+	}
+
+	scopes := []string{oidc.ScopeOpenID}
+	for _, scope := range cfg.Scopes {
+		if scope != oidc.ScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return &OIDCProvider{
+		Name: cfg.Name,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+// InitOIDC sets up the providers listed in OIDC_PROVIDERS (e.g. "google,apple").
+// Each one is configured with OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET,
+// _REDIRECT_URL and optionally _SCOPES (space separated, default
+// "email profile"). Any provider speaking OpenID Connect works, including a
+// local mock issuer during development.
+func InitOIDC(ctx context.Context) error {
+	providers := map[string]*OIDCProvider{}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		cfg := OIDCProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if len(cfg.Scopes) == 0 {
+			cfg.Scopes = []string{"email", "profile"}
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+			return fmt.Errorf("OIDC provider %s needs %sISSUER, %sCLIENT_ID and %sREDIRECT_URL", name, prefix, prefix, prefix)
+		}
+
+		provider, err := NewOIDCProvider(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		providers[name] = provider
+	}
+
+	OIDCProviders = providers
+	return nil
+}
+
+// AuthCodeURL is where the user is sent to sign in. The verifier is the PKCE
+// secret, only its S256 challenge goes in the URL.
+func (p *OIDCProvider) AuthCodeURL(state, verifier, nonce string) string {
+	return p.oauth.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce))
+}
+
+// Exchange trades the authorization code for tokens and verifies the ID token,
+// including that it was issued for this login (nonce).
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*OIDCIdentity, error) {
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %v", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("provider did not return an ID token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("ID token nonce does not match")
+	}
+
+	var identity OIDCIdentity
+	if err := idToken.Claims(&identity); err != nil {
+		return nil, fmt.Errorf("invalid ID token claims: %v", err)
+	}
+	if identity.Subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+	return &identity, nil
+}
+
+// OAuthState is what we remember about a login between the redirect to the
+// provider and the callback.
+type OAuthState struct {
+	Provider string `json:"provider"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+}
+
+func oauthStateKey(state string) string {
+	return "oauth:state:" + HashToken(state)
+}
+
+func StoreOAuthState(ctx context.Context, state string, data OAuthState) error {
+	if RedisClient == nil {
+		return errRedisUnavailable
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return RedisClient.Set(ctx, oauthStateKey(state), encoded, OAuthStateTTL).Err()
+}
+
+// TakeOAuthState returns and deletes the state, so a callback URL only works
+// once. It returns nil when the state is unknown or expired.
+func TakeOAuthState(ctx context.Context, state string) (*OAuthState, error) {
+	if RedisClient == nil {
+		return nil, errRedisUnavailable
+	}
+
+	pipe := RedisClient.TxPipeline()
+	get := pipe.Get(ctx, oauthStateKey(state))
+	pipe.Del(ctx, oauthStateKey(state))
+	pipe.Exec(ctx)
+
+	encoded, err := get.Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var data OAuthState
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// UsernameCandidate turns a name or email into something that fits the
+// username rules: lowercase letters, digits, dots and underscores.
+func UsernameCandidate(identity *OIDCIdentity) string {
+	source := identity.PreferredUsername
+	if source == "" && identity.Email != "" {
+		source = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+	if source == "" {
+		source = identity.Name
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(source) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '.':
+			b.WriteRune(r)
+		case r == ' ' || r == '-':
+			b.WriteRune('_')
+		}
+	}
+
+	candidate := strings.Trim(b.String(), "._")
+	if len(candidate) > 24 {
+		candidate = candidate[:24]
+	}
+	if len(candidate) < 3 {
+		candidate = "user"
+	}
+	return candidate
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer is a minimal OpenID Connect provider: discovery, JWKS and a token
+// endpoint that checks the PKCE verifier against the challenge it was given.
+type mockIssuer struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	m := &mockIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                m.server.URL,
+			"authorization_endpoint":                m.server.URL + "/authorize",
+			"token_endpoint":                        m.server.URL + "/token",
+			"jwks_uri":                              m.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "mock",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if r.Form.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            m.server.URL,
+			"aud":            "client-id",
+			"sub":            "subject-123",
+			"iat":            time.Now().Unix(),
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"nonce":          m.nonce,
+			"email":          "jane@example.com",
+			"email_verified": true,
+			"name":           "Jane Doe",
+		})
+		idToken.Header["kid"] = "mock"
+		signed, _ := idToken.SignedString(key)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     signed,
+		})
+	})
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func TestOIDCLoginWithPKCEAndNonce(t *testing.T) {
+	issuer := newMockIssuer(t)
+	ctx := context.Background()
+
+	provider, err := NewOIDCProvider(ctx, OIDCProviderConfig{
+		Name:        "mock",
+		Issuer:      issuer.server.URL,
+		ClientID:    "client-id",
+		RedirectURL: "http://localhost:8090/api/v1/auth/oidc/mock/callback",
+		Scopes:      []string{"email", "profile"},
+	})
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+
+	authURL, err := url.Parse(provider.AuthCodeURL("state-1", "verifier-0123456789-0123456789-0123456789", "nonce-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authURL.Query()
+	if query.Get("state") != "state-1" || query.Get("code_challenge_method") != "S256" || query.Get("scope") != "openid email profile" {
+		t.Errorf("unexpected authorization URL %s", authURL)
+	}
+	issuer.challenge = query.Get("code_challenge")
+	issuer.nonce = query.Get("nonce")
+
+	identity, err := provider.Exchange(ctx, "good-code", "verifier-0123456789-0123456789-0123456789", "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Subject != "subject-123" || identity.Email != "jane@example.com" || !identity.EmailVerified {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	if _, err := provider.Exchange(ctx, "good-code", "some-other-verifier-0123456789-0123456789", "nonce-1"); err == nil {
+		t.Error("exchange with the wrong PKCE verifier should fail")
+	}
+
+	if _, err := provider.Exchange(ctx, "good-code", "verifier-0123456789-0123456789-0123456789", "nonce-2"); err == nil {
+		t.Error("ID token for another login (nonce) should be rejected")
+	}
+}
+
+func TestUsernameCandidate(t *testing.T) {
+	cases := map[string]*OIDCIdentity{
+		"jane.doe":  {PreferredUsername: "Jane.Doe"},
+		"j_smith":   {Email: "j-smith@example.com"},
+		"anna_lena": {Name: "Anna Lena"},
+		"user":      {Name: "李"},
+	}
+	for want, identity := range cases {
+		if got := UsernameCandidate(identity); got != want {
+			t.Errorf("UsernameCandidate(%+v) = %q, want %q", identity, got, want)
+		}
+	}
+}
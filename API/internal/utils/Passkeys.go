@@ -0,0 +1,167 @@
+package utils
+
+import (
+	models "API/internal/Models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// WebAuthnCeremonyTTL is how long a passkey registration or login can take
+// between the begin and finish calls
+const WebAuthnCeremonyTTL = 5 * time.Minute
+
+// WebAuthn is the relying party configuration, set up by InitWebAuthn.
+var WebAuthn *webauthn.WebAuthn
+
+// NewWebAuthn builds the relying party for the given domain and origins.
+func NewWebAuthn(rpID string, origins []string) (*webauthn.WebAuthn, error) {
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: TOTPIssuer,
+		RPOrigins:     origins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: WebAuthnCeremonyTTL},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: WebAuthnCeremonyTTL},
+		},
+	})
+}
+
+// InitWebAuthn reads the relying party from WEBAUTHN_RP_ID (the site's domain)
+// and WEBAUTHN_RP_ORIGINS (comma separated origins of the web app).
+func InitWebAuthn() error {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		rpID = "localhost"
+	}
+
+	origins := []string{"http://localhost:8090"}
+	if value := os.Getenv("WEBAUTHN_RP_ORIGINS"); value != "" {
+		origins = strings.Split(value, ",")
+	}
+
+	relyingParty, err := NewWebAuthn(rpID, origins)
+	if err != nil {
+		return err
+	}
+	WebAuthn = relyingParty
+	return nil
+}
+
+// PasskeyUserHandle is the opaque user handle stored on the authenticator,
+// which is how a discoverable login finds the account.
+func PasskeyUserHandle(userID uint) []byte {
+	return []byte(strconv.FormatUint(uint64(userID), 10))
+}
+
+func ParsePasskeyUserHandle(handle []byte) (uint, error) {
+	id, err := strconv.ParseUint(string(handle), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user handle: %v", err)
+	}
+	return uint(id), nil
+}
+
+// PasskeyUser adapts a user and their stored passkeys to webauthn.User.
+type PasskeyUser struct {
+	User     *models.User
+	Passkeys []models.Passkey
+}
+
+func (u PasskeyUser) WebAuthnID() []byte {
+	return PasskeyUserHandle(u.User.ID)
+}
+
+func (u PasskeyUser) WebAuthnName() string {
+	return u.User.Username
+}
+
+func (u PasskeyUser) WebAuthnDisplayName() string {
+	return u.User.Name
+}
+
+// WebAuthnCredentials skips records that cannot be decoded, which only makes
+// that one passkey unusable instead of the whole account.
+func (u PasskeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.Passkeys))
+	for _, passkey := range u.Passkeys {
+		credential, err := DecodePasskeyCredential(passkey.Credential)
+		if err != nil {
+			continue
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials
+}
+
+func EncodePasskeyCredential(credential *webauthn.Credential) ([]byte, error) {
+	return json.Marshal(credential)
+}
+
+func DecodePasskeyCredential(data []byte) (webauthn.Credential, error) {
+	var credential webauthn.Credential
+	err := json.Unmarshal(data, &credential)
+	return credential, err
+}
+
+func webAuthnSessionKey(key string) string {
+	return "webauthn:session:" + key
+}
+
+// StoreWebAuthnSession keeps the ceremony state between begin and finish.
+func StoreWebAuthnSession(ctx context.Context, key string, session *webauthn.SessionData) error {
+	if RedisClient == nil {
+		return errRedisUnavailable
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return RedisClient.Set(ctx, webAuthnSessionKey(key), data, WebAuthnCeremonyTTL).Err()
+}
+
+// TakeWebAuthnSession returns and deletes the ceremony state, so a challenge
+// can only be answered once. It returns nil when there is none.
+func TakeWebAuthnSession(ctx context.Context, key string) (*webauthn.SessionData, error) {
+	if RedisClient == nil {
+		return nil, errRedisUnavailable
+	}
+
+	pipe := RedisClient.TxPipeline()
+	get := pipe.Get(ctx, webAuthnSessionKey(key))
+	pipe.Del(ctx, webAuthnSessionKey(key))
+	pipe.Exec(ctx)
+
+	data, err := get.Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// PasskeyRegistrationOptions asks for a discoverable credential, so the user
+// can later sign in without typing a username, and excludes authenticators
+// that already hold one of the user's passkeys.
+func PasskeyRegistrationOptions(user PasskeyUser) []webauthn.RegistrationOption {
+	return []webauthn.RegistrationOption{
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()),
+	}
+}
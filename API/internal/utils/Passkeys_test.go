@@ -0,0 +1,149 @@
+package utils
+
+import (
+	models "API/internal/Models"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/descope/virtualwebauthn"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// roundTripSession mimics storing the ceremony state in Redis between calls.
+func roundTripSession(t *testing.T, session *webauthn.SessionData) webauthn.SessionData {
+	t.Helper()
+	data, err := json.Marshal(session)
+	if err != nil {
+		t.Fatalf("encoding session: %v", err)
+	}
+	var decoded webauthn.SessionData
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("decoding session: %v", err)
+	}
+	return decoded
+}
+
+// newEC2Credential builds a software key whose coordinates are a full 32
+// bytes: virtualwebauthn drops leading zero bytes, which the relying party
+// rightly rejects, so about one key in 64 would make the test flaky.
+func newEC2Credential(t *testing.T) virtualwebauthn.Credential {
+	t.Helper()
+	for {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("generating key: %v", err)
+		}
+		if len(key.X.Bytes()) != 32 || len(key.Y.Bytes()) != 32 {
+			continue
+		}
+		data, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("exporting key: %v", err)
+		}
+		return virtualwebauthn.NewCredentialWithImportedKey(virtualwebauthn.KeyTypeEC2, data)
+	}
+}
+
+func TestPasskeyRegistrationAndDiscoverableLogin(t *testing.T) {
+	relyingParty, err := NewWebAuthn("example.com", []string{"https://example.com"})
+	if err != nil {
+		t.Fatalf("NewWebAuthn: %v", err)
+	}
+	rp := virtualwebauthn.RelyingParty{Name: TOTPIssuer, ID: "example.com", Origin: "https://example.com"}
+	authenticator := virtualwebauthn.NewAuthenticator()
+	softwareKey := newEC2Credential(t)
+
+	user := PasskeyUser{User: &models.User{ID: 42, Username: "jane", Name: "Jane Doe"}}
+
+	// Registration
+	creation, session, err := relyingParty.BeginRegistration(user, PasskeyRegistrationOptions(user)...)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	creationJSON, _ := json.Marshal(creation)
+	attestationOptions, err := virtualwebauthn.ParseAttestationOptions(string(creationJSON))
+	if err != nil {
+		t.Fatalf("ParseAttestationOptions: %v", err)
+	}
+	if attestationOptions.UserID != "42" {
+		t.Errorf("expected user handle 42, got %q", attestationOptions.UserID)
+	}
+
+	attestation := virtualwebauthn.CreateAttestationResponse(rp, authenticator, softwareKey, *attestationOptions)
+	parsedAttestation, err := protocol.ParseCredentialCreationResponseBytes([]byte(attestation))
+	if err != nil {
+		t.Fatalf("parsing attestation: %v", err)
+	}
+	credential, err := relyingParty.CreateCredential(user, roundTripSession(t, session), parsedAttestation)
+	if err != nil {
+		t.Fatalf("CreateCredential: %v", err)
+	}
+
+	stored, err := EncodePasskeyCredential(credential)
+	if err != nil {
+		t.Fatalf("EncodePasskeyCredential: %v", err)
+	}
+	user.Passkeys = []models.Passkey{{UserID: 42, CredentialID: credential.ID, Credential: stored}}
+
+	authenticator.Options.UserHandle = PasskeyUserHandle(42)
+	authenticator.AddCredential(softwareKey)
+
+	// The same authenticator cannot register a second passkey for the user
+	creation, _, err = relyingParty.BeginRegistration(user, PasskeyRegistrationOptions(user)...)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	creationJSON, _ = json.Marshal(creation)
+	attestationOptions, _ = virtualwebauthn.ParseAttestationOptions(string(creationJSON))
+	if !softwareKey.IsExcludedForAttestation(*attestationOptions) {
+		t.Error("existing passkey should be excluded from registration")
+	}
+
+	// Discoverable login, no username given
+	assertion, session, err := relyingParty.BeginDiscoverableLogin()
+	if err != nil {
+		t.Fatalf("BeginDiscoverableLogin: %v", err)
+	}
+	assertionJSON, _ := json.Marshal(assertion)
+	assertionOptions, err := virtualwebauthn.ParseAssertionOptions(string(assertionJSON))
+	if err != nil {
+		t.Fatalf("ParseAssertionOptions: %v", err)
+	}
+
+	response := virtualwebauthn.CreateAssertionResponse(rp, authenticator, softwareKey, *assertionOptions)
+	parsedAssertion, err := protocol.ParseCredentialRequestResponseBytes([]byte(response))
+	if err != nil {
+		t.Fatalf("parsing assertion: %v", err)
+	}
+
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := ParsePasskeyUserHandle(userHandle)
+		if err != nil || userID != 42 {
+			return nil, errors.New("unknown user")
+		}
+		return user, nil
+	}
+
+	loginSession := roundTripSession(t, session)
+	found, loginCredential, err := relyingParty.ValidatePasskeyLogin(handler, loginSession, parsedAssertion)
+	if err != nil {
+		t.Fatalf("ValidatePasskeyLogin: %v", err)
+	}
+	if found.(PasskeyUser).User.ID != 42 || string(loginCredential.ID) != string(credential.ID) {
+		t.Errorf("login resolved the wrong user or credential")
+	}
+
+	// A login for an account the server does not know fails
+	authenticator.Options.UserHandle = PasskeyUserHandle(7)
+	response = virtualwebauthn.CreateAssertionResponse(rp, authenticator, softwareKey, *assertionOptions)
+	parsedAssertion, _ = protocol.ParseCredentialRequestResponseBytes([]byte(response))
+	if _, _, err := relyingParty.ValidatePasskeyLogin(handler, loginSession, parsedAssertion); err == nil {
+		t.Error("login with an unknown user handle should fail")
+	}
+}
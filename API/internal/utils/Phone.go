@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NormalizePhone converts a phone number typed by a user to E.164
+// ("+4915123456789"). Spaces, dashes, dots and parentheses are ignored and an
+// international "00" prefix is accepted in place of "+". Numbers without a
+// country code are rejected since there is no way to guess it reliably.
+func NormalizePhone(raw string) (string, error) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(raw) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+			// formatting only
+		default:
+			return "", fmt.Errorf("invalid character %q in phone number", r)
+		}
+	}
+
+	number := b.String()
+	if strings.HasPrefix(number, "00") {
+		number = "+" + number[2:]
+	}
+	if !strings.HasPrefix(number, "+") {
+		return "", fmt.Errorf("phone number must include the country code, e.g. +1")
+	}
+
+	digits := number[1:]
+	// E.164 allows at most 15 digits, and no country code starts with 0
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", fmt.Errorf("invalid phone number")
+	}
+
+	return number, nil
+}
+
+// LooksLikePhone reports whether a login identifier is meant as a phone number.
+func LooksLikePhone(identifier string) bool {
+	identifier = strings.TrimSpace(identifier)
+	return strings.HasPrefix(identifier, "+") || strings.HasPrefix(identifier, "00")
+}
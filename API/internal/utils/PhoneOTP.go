@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// PhoneOTPTTL is how long an SMS code can be entered
+	PhoneOTPTTL = 10 * time.Minute
+	// phoneOTPAttempts is how many wrong codes burn the current one
+	phoneOTPAttempts = 5
+)
+
+func phoneOTPKey(userID uint) string {
+	return fmt.Sprintf("phone:otp:%d", userID)
+}
+
+// GeneratePhoneOTP returns a random 6-digit code.
+func GeneratePhoneOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// StorePhoneOTP remembers the code sent to phone. A new code replaces the
+// previous one and resets the attempt counter.
+func StorePhoneOTP(ctx context.Context, userID uint, phone, code string) error {
+	if RedisClient == nil {
+		return errRedisUnavailable
+	}
+
+	key := phoneOTPKey(userID)
+	pipe := RedisClient.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, "phone", phone, "hash", HashToken(code), "attempts", 0)
+	pipe.Expire(ctx, key, PhoneOTPTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// CheckPhoneOTP reports whether code is the one last sent to phone. The code
+// is deleted once it matches or after too many wrong guesses.
+func CheckPhoneOTP(ctx context.Context, userID uint, phone, code string) (bool, error) {
+	if RedisClient == nil {
+		return false, errRedisUnavailable
+	}
+
+	key := phoneOTPKey(userID)
+	stored, err := RedisClient.HGetAll(ctx, key).Result()
+	if err == redis.Nil || len(stored) == 0 {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if stored["phone"] == phone && subtle.ConstantTimeCompare([]byte(stored["hash"]), []byte(HashToken(code))) == 1 {
+		return true, RedisClient.Del(ctx, key).Err()
+	}
+
+	attempts, err := RedisClient.HIncrBy(ctx, key, "attempts", 1).Result()
+	if err != nil {
+		return false, err
+	}
+	if attempts >= phoneOTPAttempts {
+		return false, RedisClient.Del(ctx, key).Err()
+	}
+	return false, nil
+}
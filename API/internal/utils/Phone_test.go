@@ -0,0 +1,24 @@
+package utils
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	valid := map[string]string{
+		"+49 151 2345 6789":  "+4915123456789",
+		"0049-151-2345-6789": "+4915123456789",
+		"+1 (415) 555.2671":  "+14155552671",
+		" +447911123456 ":    "+447911123456",
+	}
+	for raw, want := range valid {
+		got, err := NormalizePhone(raw)
+		if err != nil || got != want {
+			t.Errorf("NormalizePhone(%q) = %q, %v; want %q", raw, got, err, want)
+		}
+	}
+
+	for _, raw := range []string{"", "4155552671", "+0123456789", "+1234", "+1234567890123456", "+1 415 555 CALL", "1+4155552671"} {
+		if got, err := NormalizePhone(raw); err == nil {
+			t.Errorf("NormalizePhone(%q) = %q, expected an error", raw, got)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// RateLimitResult describes a key's window after a call to RateLimit.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	// Reset is how long until the oldest hit leaves the window and frees a slot
+	Reset time.Duration
+}
+
+// slidingWindowScript keeps one sorted set entry per hit, scored by its time
+// in milliseconds. Trimming, counting and adding happen in one script so
+// concurrent requests on different instances cannot both take the last slot.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', key, window)
+
+local reset = window
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, count, reset}
+`)
+
+// RateLimit records one hit for key in a sliding window of the given length
+// and reports whether it fits within limit. Without Redis everything is allowed.
+func RateLimit(ctx context.Context, key string, limit int64, window time.Duration) (RateLimitResult, error) {
+	result := RateLimitResult{Allowed: true, Limit: limit, Remaining: limit}
+	if RedisClient == nil {
+		return result, nil
+	}
+
+	values, err := slidingWindowScript.Run(ctx, RedisClient, []string{"ratelimit:" + key},
+		time.Now().UnixMilli(), window.Milliseconds(), limit, uuid.NewString()).Int64Slice()
+	if err != nil {
+		return result, err
+	}
+
+	result.Allowed = values[0] == 1
+	result.Remaining = limit - values[1]
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	result.Reset = time.Duration(values[2]) * time.Millisecond
+	return result, nil
+}
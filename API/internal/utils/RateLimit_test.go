@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestRateLimitSlidingWindow(t *testing.T) {
+	server := miniredis.RunT(t)
+	RedisClient = redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer func() { RedisClient = nil }()
+
+	ctx := context.Background()
+	for i := int64(1); i <= 3; i++ {
+		result, err := RateLimit(ctx, "test:ip:1.2.3.4", 3, time.Minute)
+		if err != nil {
+			t.Fatalf("RateLimit: %v", err)
+		}
+		if !result.Allowed || result.Remaining != 3-i {
+			t.Fatalf("hit %d: expected allowed with %d remaining, got %+v", i, 3-i, result)
+		}
+	}
+
+	result, err := RateLimit(ctx, "test:ip:1.2.3.4", 3, time.Minute)
+	if err != nil {
+		t.Fatalf("RateLimit: %v", err)
+	}
+	if result.Allowed || result.Remaining != 0 {
+		t.Fatalf("expected the fourth hit to be limited, got %+v", result)
+	}
+	if result.Reset <= 0 || result.Reset > time.Minute {
+		t.Fatalf("expected a reset within the window, got %v", result.Reset)
+	}
+
+	// Other keys have their own window
+	if result, _ := RateLimit(ctx, "test:ip:5.6.7.8", 3, time.Minute); !result.Allowed {
+		t.Fatal("expected a different key to be allowed")
+	}
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// SMSProvider sends text messages. Production providers (Twilio, SNS, ...)
+// implement it; ConsoleSMSProvider is the local development default.
+type SMSProvider interface {
+	Send(ctx context.Context, to, message string) error
+}
+
+// SMS is the provider used by the app, set up by InitSMS.
+var SMS SMSProvider = ConsoleSMSProvider{}
+
+// InitSMS picks the provider from SMS_PROVIDER. Only "console" is built in.
+func InitSMS() error {
+	switch provider := os.Getenv("SMS_PROVIDER"); provider {
+	case "", "console":
+		SMS = ConsoleSMSProvider{}
+		return nil
+	default:
+		return fmt.Errorf("unknown SMS_PROVIDER %q", provider)
+	}
+}
+
+// ConsoleSMSProvider prints messages to the server log instead of sending them.
+type ConsoleSMSProvider struct{}
+
+func (ConsoleSMSProvider) Send(ctx context.Context, to, message string) error {
+	log.Printf("SMS to %s: %s", to, message)
+	return nil
+}
+
+// SentSMS is a message captured by FakeSMSProvider.
+type SentSMS struct {
+	To      string
+	Message string
+}
+
+// FakeSMSProvider records messages so tests can read the codes back.
+type FakeSMSProvider struct {
+	mu   sync.Mutex
+	Sent []SentSMS
+}
+
+func (f *FakeSMSProvider) Send(ctx context.Context, to, message string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Sent = append(f.Sent, SentSMS{To: to, Message: message})
+	return nil
+}
+
+// Last returns the most recent message, or an empty SentSMS.
+func (f *FakeSMSProvider) Last() SentSMS {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.Sent) == 0 {
+		return SentSMS{}
+	}
+	return f.Sent[len(f.Sent)-1]
+}
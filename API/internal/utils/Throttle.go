@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+// Throttle counts one hit for key and reports whether it is still within
+// limit hits per window. When it is not, it also returns how long until the
+// window resets. Without Redis nothing is throttled.
+func Throttle(ctx context.Context, key string, limit int64, window time.Duration) (bool, time.Duration, error) {
+	if RedisClient == nil {
+		return true, 0, nil
+	}
+
+	redisKey := "throttle:" + key
+	count, err := RedisClient.Incr(ctx, redisKey).Result()
+	if err != nil {
+		return false, 0, err
+	}
+	if count == 1 {
+		if err := RedisClient.Expire(ctx, redisKey, window).Err(); err != nil {
+			return false, 0, err
+		}
+	}
+
+	if count <= limit {
+		return true, 0, nil
+	}
+
+	ttl, err := RedisClient.TTL(ctx, redisKey).Result()
+	if err != nil {
+		return false, 0, err
+	}
+	if ttl < 0 {
+		// The expiry was lost (e.g. a crash between INCR and EXPIRE), set it again
+		RedisClient.Expire(ctx, redisKey, window)
+		ttl = window
+	}
+	return false, ttl, nil
+}
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// TOTP as described in RFC 6238 with the parameters every authenticator app
+// supports: HMAC-SHA1, 6 digits and a 30 second step.
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// totpSkew is how many steps before and after the current one are
+	// accepted, to absorb clock drift on the phone
+	totpSkew = 1
+)
+
+// TOTPIssuer is shown as the account name prefix in authenticator apps
+const TOTPIssuer = "Instagram Clone"
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random base32 encoded 160 bit secret.
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPStep returns the time step t falls in.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// TOTPCode returns the code for the given time step.
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %v", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod), nil
+}
+
+// ValidateTOTP checks code against the steps around t. It returns the step
+// that matched so callers can refuse to accept the same code twice.
+func ValidateTOTP(secret, code string, t time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := TOTPStep(t)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPURI returns the otpauth:// URI authenticator apps enroll from.
+func TOTPURI(account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", TOTPIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(TOTPIssuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// TOTPQRCode renders the otpauth URI as a PNG data URL the client can show
+// directly in an <img>.
+func TOTPQRCode(uri string) (string, error) {
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
+}
+
+// GenerateRecoveryCode returns a one-time backup code like "k3vq8-m2xpr",
+// about 50 bits of entropy from an alphabet without look-alike characters.
+func GenerateRecoveryCode() (string, error) {
+	const alphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+	code := make([]byte, 0, 11)
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		// rand.Int is uniform, a byte modulo 31 would favour the first letters
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		code = append(code, alphabet[n.Int64()])
+	}
+	return string(code), nil
+}
+
+// NormalizeRecoveryCode makes user input comparable to a generated code.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.Join(strings.Fields(code), ""))
+	if len(code) == 10 && !strings.Contains(code, "-") {
+		code = code[:5] + "-" + code[5:]
+	}
+	return code
+}
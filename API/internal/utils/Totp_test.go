@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	// RFC 6238 appendix B, SHA1 secret, truncated to our 6 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range vectors {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode: %v", err)
+		}
+		if got != want {
+			t.Errorf("time %d: expected %s, got %s", unix, want, got)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+
+	previous, _ := TOTPCode(secret, TOTPStep(now)-1)
+	if step, ok := ValidateTOTP(secret, previous, now); !ok || step != TOTPStep(now)-1 {
+		t.Error("code from the previous step should be accepted")
+	}
+
+	stale, _ := TOTPCode(secret, TOTPStep(now)-3)
+	if _, ok := ValidateTOTP(secret, stale, now); ok {
+		t.Error("code from three steps ago should be rejected")
+	}
+
+	if _, ok := ValidateTOTP(secret, "12345", now); ok {
+		t.Error("short code should be rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("jane@example.com", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/Instagram%20Clone:jane@example.com?") || !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") {
+		t.Errorf("unexpected URI %s", uri)
+	}
+}
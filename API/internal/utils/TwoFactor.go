@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// TOTPEnrollmentTTL is how long a scanned but unconfirmed secret is kept
+	TOTPEnrollmentTTL = 10 * time.Minute
+	// LoginChallengeTTL is how long the user has to enter their code after the password
+	LoginChallengeTTL = 5 * time.Minute
+)
+
+var errRedisUnavailable = errors.New("redis is not initialized")
+
+func pendingTOTPKey(userID uint) string {
+	return fmt.Sprintf("2fa:enroll:%d", userID)
+}
+
+func loginChallengeKey(token string) string {
+	return "2fa:challenge:" + HashToken(token)
+}
+
+// StorePendingTOTPSecret keeps the secret of an enrollment until the user
+// confirms it with a first code.
+func StorePendingTOTPSecret(ctx context.Context, userID uint, secret string) error {
+	if RedisClient == nil {
+		return errRedisUnavailable
+	}
+	return RedisClient.Set(ctx, pendingTOTPKey(userID), secret, TOTPEnrollmentTTL).Err()
+}
+
+// PendingTOTPSecret returns the secret being enrolled, or "" if there is none.
+func PendingTOTPSecret(ctx context.Context, userID uint) (string, error) {
+	if RedisClient == nil {
+		return "", errRedisUnavailable
+	}
+	secret, err := RedisClient.Get(ctx, pendingTOTPKey(userID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return secret, err
+}
+
+func DeletePendingTOTPSecret(ctx context.Context, userID uint) error {
+	if RedisClient == nil {
+		return errRedisUnavailable
+	}
+	return RedisClient.Del(ctx, pendingTOTPKey(userID)).Err()
+}
+
+// CreateLoginChallenge returns the token a client trades, together with a
+// second factor, for a session once the password has been checked.
+func CreateLoginChallenge(ctx context.Context, userID uint) (string, error) {
+	if RedisClient == nil {
+		return "", errRedisUnavailable
+	}
+
+	token, err := GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := RedisClient.Set(ctx, loginChallengeKey(token), userID, LoginChallengeTTL).Err(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// LoginChallengeUser returns the user a challenge was issued for, or 0 when
+// the challenge does not exist or expired.
+func LoginChallengeUser(ctx context.Context, token string) (uint, error) {
+	if RedisClient == nil {
+		return 0, errRedisUnavailable
+	}
+
+	value, err := RedisClient.Get(ctx, loginChallengeKey(token)).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	userID, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(userID), nil
+}
+
+func DeleteLoginChallenge(ctx context.Context, token string) error {
+	if RedisClient == nil {
+		return errRedisUnavailable
+	}
+	return RedisClient.Del(ctx, loginChallengeKey(token)).Err()
+}
+
+// ClaimTOTPStep records that the user signed in with the code of this step
+// and reports false if that code was already used, so an intercepted code
+// cannot be replayed while it is still valid.
+func ClaimTOTPStep(ctx context.Context, userID uint, step int64) (bool, error) {
+	if RedisClient == nil {
+		return false, errRedisUnavailable
+	}
+	key := fmt.Sprintf("2fa:used:%d:%d", userID, step)
+	ttl := time.Duration(2*totpSkew+1) * totpPeriod * time.Second
+	return RedisClient.SetNX(ctx, key, 1, ttl).Result()
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strconv"
+)
+
+// unsubscribeSecret signs the unsubscribe links of digest emails, set by
+// InitUnsubscribe
+var unsubscribeSecret []byte
+
+// InitUnsubscribe reads UNSUBSCRIBE_SECRET, at least 32 random characters.
+// Changing it breaks the unsubscribe links of every email already sent.
+func InitUnsubscribe() error {
+	secret := os.Getenv("UNSUBSCRIBE_SECRET")
+	if len(secret) < 32 {
+		return errors.New("UNSUBSCRIBE_SECRET must be at least 32 characters")
+	}
+	SetUnsubscribeSecret([]byte(secret))
+	return nil
+}
+
+// SetUnsubscribeSecret replaces the secret, mostly useful in tests.
+func SetUnsubscribeSecret(secret []byte) {
+	unsubscribeSecret = secret
+}
+
+// SignUnsubscribe returns the signature of a one-click unsubscribe link for
+// the user. It never expires, the link can only ever turn emails off.
+func SignUnsubscribe(userID uint) string {
+	mac := hmac.New(sha256.New, unsubscribeSecret)
+	mac.Write([]byte("digest-unsubscribe:" + strconv.FormatUint(uint64(userID), 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyUnsubscribe reports whether signature is SignUnsubscribe(userID).
+func VerifyUnsubscribe(userID uint, signature string) bool {
+	if len(unsubscribeSecret) == 0 {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(SignUnsubscribe(userID)))
+}
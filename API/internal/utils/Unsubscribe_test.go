@@ -0,0 +1,29 @@
+package utils
+
+import "testing"
+
+func TestUnsubscribeSignature(t *testing.T) {
+	SetUnsubscribeSecret([]byte("0123456789abcdef0123456789abcdef"))
+	defer SetUnsubscribeSecret(nil)
+
+	signature := SignUnsubscribe(42)
+	if !VerifyUnsubscribe(42, signature) {
+		t.Fatal("a signature should verify for the user it was made for")
+	}
+	if VerifyUnsubscribe(43, signature) {
+		t.Error("a signature must not unsubscribe another user")
+	}
+	if VerifyUnsubscribe(42, signature[:len(signature)-1]) || VerifyUnsubscribe(42, "") {
+		t.Error("a truncated or missing signature must not verify")
+	}
+
+	SetUnsubscribeSecret([]byte("another secret of at least 32 chars"))
+	if VerifyUnsubscribe(42, signature) {
+		t.Error("a signature made with another secret must not verify")
+	}
+
+	SetUnsubscribeSecret(nil)
+	if VerifyUnsubscribe(42, SignUnsubscribe(42)) {
+		t.Error("nothing should verify without a secret")
+	}
+}
@@ -0,0 +1,54 @@
+package utils
+
+import "strings"
+
+// DescribeDevice turns a User-Agent header into a short label such as
+// "Chrome on Windows". It is only meant for humans reading their sessions
+// list, not for feature detection.
+func DescribeDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "firefox/") || strings.Contains(ua, "fxios/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	case strings.Contains(ua, "okhttp") || strings.Contains(ua, "dalvik") || strings.Contains(ua, "cfnetwork"):
+		browser = "App"
+	case strings.Contains(ua, "curl/") || strings.Contains(ua, "postman") || strings.Contains(ua, "k6/"):
+		browser = "API client"
+	}
+
+	platform := "Unknown OS"
+	switch {
+	case strings.Contains(ua, "iphone"):
+		platform = "iPhone"
+	case strings.Contains(ua, "ipad"):
+		platform = "iPad"
+	case strings.Contains(ua, "android") || strings.Contains(ua, "dalvik"):
+		platform = "Android"
+	case strings.Contains(ua, "windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "mac os") || strings.Contains(ua, "macintosh") || strings.Contains(ua, "cfnetwork"):
+		platform = "macOS"
+	case strings.Contains(ua, "cros"):
+		platform = "ChromeOS"
+	case strings.Contains(ua, "linux"):
+		platform = "Linux"
+	}
+
+	if browser == "API client" || (browser == "Unknown browser" && platform == "Unknown OS") {
+		return browser
+	}
+	return browser + " on " + platform
+}
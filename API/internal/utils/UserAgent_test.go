@@ -0,0 +1,23 @@
+package utils
+
+import "testing"
+
+func TestDescribeDevice(t *testing.T) {
+	cases := map[string]string{
+		"":                  "Unknown device",
+		"curl/8.4.0":        "API client",
+		"okhttp/4.12.0":     "App on Unknown OS",
+		"something strange": "Unknown browser",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36":                         "Chrome on Windows",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0":             "Edge on Windows",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1": "Safari on iPhone",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.1; rv:120.0) Gecko/20100101 Firefox/120.0":                                                     "Firefox on macOS",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36":                   "Chrome on Android",
+	}
+
+	for userAgent, expected := range cases {
+		if got := DescribeDevice(userAgent); got != expected {
+			t.Errorf("DescribeDevice(%q) = %q; expected %q", userAgent, got, expected)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	models "API/internal/Models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// userCacheTTL bounds how stale a cached user can get if an invalidation is missed
+const userCacheTTL = 10 * time.Minute
+
+func userCacheKey(id uint) string {
+	return fmt.Sprintf("user:%d", id)
+}
+
+// GetCachedUser returns the cached user, or nil when it is not in the cache.
+// Password and token hashes are never cached since they are not serialized.
+func GetCachedUser(ctx context.Context, id uint) (*models.User, error) {
+	if RedisClient == nil {
+		return nil, nil
+	}
+
+	data, err := RedisClient.Get(ctx, userCacheKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func CacheUser(ctx context.Context, user *models.User) error {
+	if RedisClient == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	return RedisClient.Set(ctx, userCacheKey(user.ID), data, userCacheTTL).Err()
+}
+
+// InvalidateUserCache drops the cached user; call it whenever a user row changes.
+func InvalidateUserCache(ctx context.Context, id uint) error {
+	if RedisClient == nil {
+		return nil
+	}
+	return RedisClient.Del(ctx, userCacheKey(id)).Err()
+}
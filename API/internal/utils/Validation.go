@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"unicode"
+
+	"github.com/go-playground/validator"
+)
+
+// bcrypt silently ignores everything after the first 72 bytes
+const maxPasswordBytes = 72
+
+// NewValidator returns a validator with the app's custom tags registered:
+//
+//	password     8 to 72 bytes with at least one letter and one digit
+//	notbreached  not in the local breached password list, see IsBreachedPassword
+func NewValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+		return IsStrongPassword(fl.Field().String())
+	})
+	validate.RegisterValidation("notbreached", func(fl validator.FieldLevel) bool {
+		return notBreached(fl.Field().String())
+	})
+	return validate
+}
+
+// IsStrongPassword is the password policy shared by registration, profile
+// edits and password resets.
+func IsStrongPassword(password string) bool {
+	if len(password) < 8 || len(password) > maxPasswordBytes {
+		return false
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	return hasLetter && hasDigit
+}
@@ -0,0 +1,26 @@
+package utils
+
+import "testing"
+
+func TestPasswordValidation(t *testing.T) {
+	type request struct {
+		Password string `validate:"required,password"`
+	}
+	validate := NewValidator()
+
+	cases := map[string]bool{
+		"hunter22":                      true,
+		"correct horse battery 9":       true,
+		"short1":                        false,
+		"onlyletters":                   false,
+		"1234567890":                    false,
+		string(make([]byte, 73)):        false,
+		"a1" + string(make([]byte, 71)): false,
+	}
+	for password, valid := range cases {
+		err := validate.Struct(request{Password: password})
+		if (err == nil) != valid {
+			t.Errorf("password %q: expected valid=%v, got err %v", password, valid, err)
+		}
+	}
+}